@@ -0,0 +1,233 @@
+// SAL annotations remapped to attributes kept by the cc parser, shared by
+// the user and kernel mode headers. Include it right after <sal.h>.
+
+# https://github.com/nemequ/salieri/blob/master/salieri.h
+
+#if defined(_In_)
+#undef _In_
+#define _In_  __attribute__((anno("_In_")))
+#endif
+
+#if defined(_In_opt_)
+#undef _In_opt_
+#define _In_opt_  __attribute__((anno("_In_opt_")))
+#endif
+
+#if defined(_In_z_)
+#undef _In_z_
+#define _In_z_  __attribute__((anno("_In_z_")))
+#endif
+
+#if defined(_In_opt_z_)
+#undef _In_opt_z_
+#define _In_opt_z_  __attribute__((anno("_In_opt_z_")))
+#endif
+
+#if defined(_In_reads_)
+#undef _In_reads_
+#define _In_reads_(s)  __attribute__((anno("_In_reads_"))) __attribute__((size(#s)))
+#endif
+
+#if defined(_In_reads_opt_)
+#undef _In_reads_opt_
+#define _In_reads_opt_(s)  __attribute__((anno("_In_reads_opt_"))) __attribute__((size(#s)))
+#endif
+
+#if defined(_In_reads_bytes_)
+#undef _In_reads_bytes_
+#define _In_reads_bytes_(s)  __attribute__((anno("_In_reads_bytes_"))) __attribute__((size(#s)))
+#endif
+
+#if defined(_In_reads_bytes_opt_)
+#undef _In_reads_bytes_opt_
+#define _In_reads_bytes_opt_(s)  __attribute__((anno("_In_reads_bytes_opt_"))) __attribute__((size(#s)))
+#endif
+
+#if defined(_In_reads_z_)
+#undef _In_reads_z_
+#define _In_reads_z_(s)  __attribute__((anno("_In_reads_z_"))) __attribute__((size(#s)))
+#endif
+
+#if defined(_In_reads_opt_z_)
+#undef _In_reads_opt_z_
+#define _In_reads_opt_z_(s)  __attribute__((anno("_In_reads_opt_z_"))) __attribute__((size(#s)))
+#endif
+
+#if defined(_In_reads_or_z_)
+#undef _In_reads_or_z_
+#define _In_reads_or_z_(s)  __attribute__((anno("_In_reads_or_z_"))) __attribute__((size(#s)))
+#endif
+
+#if defined(_In_reads_or_z_opt_)
+#undef _In_reads_or_z_opt_
+#define _In_reads_or_z_opt_(s)  __attribute__((anno("_In_reads_or_z_opt_"))) __attribute__((size(#s)))
+#endif
+
+#if defined(_In_reads_to_ptr_)
+#undef _In_reads_to_ptr_
+#define _In_reads_to_ptr_(s)  __attribute__((anno("_In_reads_to_ptr_"))) __attribute__((size(#s)))
+#endif
+
+#if defined(_In_reads_to_ptr_opt_)
+#undef _In_reads_to_ptr_opt_
+#define _In_reads_to_ptr_opt_(s)  __attribute__((anno("_In_reads_to_ptr_opt_"))) __attribute__((size(#s)))
+#endif
+
+#if defined(_In_reads_to_ptr_z_)
+#undef _In_reads_to_ptr_z_
+#define _In_reads_to_ptr_z_(s)  __attribute__((anno("_In_reads_to_ptr_z_"))) __attribute__((size(#s)))
+#endif
+
+#if defined(_In_reads_to_ptr_opt_z_)
+#undef _In_reads_to_ptr_opt_z_
+#define _In_reads_to_ptr_opt_z_(s)  __attribute__((anno("_In_reads_to_ptr_opt_z_"))) __attribute__((size(#s)))
+#endif
+
+
+//////////////////////// OUT///////////////////////////////////
+
+#if defined(_Out_)
+#undef _Out_
+#define _Out_  __attribute__((anno("_Out_")))
+#endif
+
+#if defined(_Out_opt_)
+#undef _Out_opt_
+#define _Out_opt_  __attribute__((anno("_Out_opt_")))
+#endif
+
+#if defined(_Out_writes_)
+#undef _Out_writes_
+#define _Out_writes_(s)  __attribute__((anno("_Out_writes_")))  __attribute__((size(#s)))
+#endif
+
+#if defined(_Out_writes_opt_)
+#undef _Out_writes_opt_
+#define _Out_writes_opt_(s)  __attribute__((anno("_Out_writes_opt_"))) __attribute__((size(#s)))
+#endif
+
+#if defined(_Out_writes_bytes_)
+#undef _Out_writes_bytes_
+#define _Out_writes_bytes_(s)  __attribute__((anno("_Out_writes_bytes_"))) __attribute__((size(#s)))
+#endif
+
+#if defined(_Out_writes_bytes_opt_)
+#undef _Out_writes_bytes_opt_
+#define _Out_writes_bytes_opt_(s)  __attribute__((anno("_Out_writes_bytes_opt_"))) __attribute__((size(#s)))
+#endif
+
+#if defined(_Out_writes_z_)
+#undef _Out_writes_z_
+#define _Out_writes_z_(s)  __attribute__((anno("_Out_writes_z_"))) __attribute__((size(#s)))
+#endif
+
+#if defined(_Out_writes_opt_z_)
+#undef _Out_writes_opt_z_
+#define _Out_writes_opt_z_(s)  __attribute__((anno("_Out_writes_opt_z_", s)))
+#endif
+
+#if defined(_Out_writes_to_)
+#undef _Out_writes_to_
+#define _Out_writes_to_(s, c)  __attribute__((anno("_Out_writes_to_"))) __attribute__((size(#s))) __attribute__((count(#c)))
+#endif
+
+#if defined(_Out_writes_to_opt_)
+#undef _Out_writes_to_opt_
+#define _Out_writes_to_opt_(s, c)  __attribute__((anno("_Out_writes_to_opt_"))) __attribute__((size(#s))) __attribute__((count(#c)))
+#endif
+
+#if defined(_Out_writes_all_)
+#undef _Out_writes_all_
+#define _Out_writes_all_(s)  __attribute__((anno("_Out_writes_all_"))) __attribute__((size(#s)))
+#endif
+
+#if defined(_Out_writes_all_opt_)
+#undef _Out_writes_all_opt_
+#define _Out_writes_all_opt_(s)  __attribute__((anno("_Out_writes_all_opt_"))) __attribute__((size(#s)))
+#endif
+
+#if defined(_Out_writes_bytes_to_)
+#undef _Out_writes_bytes_to_
+#define _Out_writes_bytes_to_(s, c)  __attribute__((anno("_Out_writes_bytes_to_"))) __attribute__((size(#s))) __attribute__((count(#c)))
+#endif
+
+#if defined(_Out_writes_bytes_to_opt_)
+#undef _Out_writes_bytes_to_opt_
+#define _Out_writes_bytes_to_opt_(s, c)  __attribute__((anno("_Out_writes_bytes_to_opt_"))) __attribute__((size(#s))) __attribute__((count(#c)))
+#endif
+
+#if defined(_Out_writes_bytes_all_)
+#undef _Out_writes_bytes_all_
+#define _Out_writes_bytes_all_(s)  __attribute__((anno("_Out_writes_bytes_all_"))) __attribute__((size(#s)))
+#endif
+
+#if defined(_Out_writes_bytes_all_opt_)
+#undef _Out_writes_bytes_all_opt_
+#define _Out_writes_bytes_all_opt_(s)  __attribute__((anno("_Out_writes_bytes_all_opt_"))) __attribute__((size(#s)))
+#endif
+
+
+#if defined(_Out_writes_to_ptr_)
+#undef _Out_writes_to_ptr_
+#define _Out_writes_to_ptr_(s)  __attribute__((anno("_Out_writes_to_ptr_"))) __attribute__((size(#s)))
+#endif
+
+#if defined(_Out_writes_to_ptr_opt_)
+#undef _Out_writes_to_ptr_opt_
+#define _Out_writes_to_ptr_opt_(s)  __attribute__((anno("_Out_writes_to_ptr_opt_"))) __attribute__((size(#s)))
+#endif
+
+#if defined(_Out_writes_to_ptr_z_)
+#undef _Out_writes_to_ptr_z_
+#define _Out_writes_to_ptr_z_(s)  __attribute__((anno("_Out_writes_to_ptr_z_"))) __attribute__((size(#s)))
+#endif
+
+#if defined(_Out_writes_to_ptr_opt_z_)
+#undef _Out_writes_to_ptr_opt_z_
+#define _Out_writes_to_ptr_opt_z_(s)  __attribute__((anno("_Out_writes_to_ptr_opt_z_"))) __attribute__((size(#s)))
+#endif
+
+
+
+#if defined(_Outptr_)
+#undef _Outptr_
+#define _Outptr_  __attribute__((anno("_Outptr_")))
+#endif
+
+
+////////////////////////IN OUT /////////////////////////////////
+
+
+#if defined(_Inout_)
+#undef _Inout_
+#define _Inout_  __attribute__((anno("_Inout_")))
+#endif
+
+//////////////////////// RELEASE /////////////////////////////////
+
+#if defined(_Frees_ptr_)
+#undef _Frees_ptr_
+#define _Frees_ptr_  __attribute__((anno("_Frees_ptr_"))) __attribute__((post("_Frees_ptr_")))
+#endif
+
+#if defined(_Frees_ptr_opt_)
+#undef _Frees_ptr_opt_
+#define _Frees_ptr_opt_  __attribute__((anno("_Frees_ptr_opt_"))) __attribute__((post("_Frees_ptr_opt_")))
+#endif
+
+#if defined(_Post_invalid_)
+#undef _Post_invalid_
+#define _Post_invalid_  __attribute__((post("_Post_invalid_")))
+#endif
+
+#if defined(_Post_ptr_invalid_)
+#undef _Post_ptr_invalid_
+#define _Post_ptr_invalid_  __attribute__((post("_Post_ptr_invalid_")))
+#endif
+
+//////////////////////// RETURN /////////////////////////////////
+
+#if defined(_Success_)
+#undef _Success_
+#define _Success_(expr)  __attribute__((success(#expr)))
+#endif
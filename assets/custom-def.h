@@ -1 +0,0 @@
-int function1 ( int x, double y);
\ No newline at end of file
@@ -0,0 +1,43 @@
+#define XSTR(x) STR(x)
+#define STR(x) #x
+
+#include <sal.h>
+#include <driverspecs.h>
+#include "annotations.h"
+
+//////////////////////// IRQL /////////////////////////////////
+
+#if defined(_IRQL_requires_max_)
+#undef _IRQL_requires_max_
+#define _IRQL_requires_max_(irql)  __attribute__((irql_max(#irql)))
+#endif
+
+#if defined(_IRQL_always_function_max_)
+#undef _IRQL_always_function_max_
+#define _IRQL_always_function_max_(irql)  __attribute__((irql_max(#irql)))
+#endif
+
+#if defined(_IRQL_requires_min_)
+#undef _IRQL_requires_min_
+#define _IRQL_requires_min_(irql)  __attribute__((irql_min(#irql)))
+#endif
+
+#if defined(_IRQL_always_function_min_)
+#undef _IRQL_always_function_min_
+#define _IRQL_always_function_min_(irql)  __attribute__((irql_min(#irql)))
+#endif
+
+#if defined(_IRQL_requires_)
+#undef _IRQL_requires_
+#define _IRQL_requires_(irql)  __attribute__((irql(#irql)))
+#endif
+
+#if defined(_IRQL_raises_)
+#undef _IRQL_raises_
+#define _IRQL_raises_(irql)  __attribute__((irql_raises(#irql)))
+#endif
+
+// ntifs.h pulls ntddk.h and wdm.h, fltKernel.h declares the filter manager
+// routines.
+#include <ntifs.h>
+#include <fltKernel.h>
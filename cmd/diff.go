@@ -0,0 +1,167 @@
+// Copyright 2018 Saferwall. All rights reserved.
+// Use of this source code is governed by Apache v2 license
+// license that can be found in the LICENSE file.
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/saferwall/winsdk2json/internal/analysis"
+	"github.com/saferwall/winsdk2json/internal/entity"
+	log "github.com/saferwall/winsdk2json/internal/logger"
+	"github.com/saferwall/winsdk2json/internal/utils"
+	"github.com/spf13/cobra"
+)
+
+// Exit codes of the diff command, errors exit with 1.
+const (
+	diffExitSame     = 0 // No change.
+	diffExitAdditive = 2 // Only additions and compatible changes.
+	diffExitBreaking = 3 // At least one removal or breaking change.
+)
+
+// Used for flags.
+var (
+	diffFormat string
+	diffOutput string
+)
+
+func init() {
+
+	diffCmd.Flags().StringVarP(&diffFormat, "format", "f", "markdown",
+		"Output format: json or markdown")
+	diffCmd.Flags().StringVarP(&diffOutput, "output", "o", "",
+		"Path to the output file, defaults to stdout")
+}
+
+var diffCmd = &cobra.Command{
+	Use:   "diff old.json new.json",
+	Short: "Compare two generated API definition files",
+	Long: `Compare two API definition files produced by the parse command, like
+w32apis-full.json or apis.json, and report the changes of each API: DLL moved,
+parameter added, type or annotation changed, API removed ...
+
+Exit codes: 0 when nothing changed, 2 when there are only additions or
+compatible changes, 3 when an API is removed or its binary interface changed,
+and 1 on errors.`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		os.Exit(runDiff(args[0], args[1]))
+	},
+}
+
+func runDiff(oldPath, newPath string) int {
+
+	logger := log.NewCustom("info").With(context.TODO())
+
+	oldAPIs, err := loadAPIs(oldPath)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	newAPIs, err := loadAPIs(newPath)
+	if err != nil {
+		logger.Fatal(err)
+	}
+
+	diff := entity.W32Diff{
+		From: filepath.Base(oldPath),
+		To:   filepath.Base(newPath),
+		APIs: analysis.DiffAPIs(oldAPIs, newAPIs),
+	}
+
+	var buf bytes.Buffer
+	switch diffFormat {
+	case "json":
+		var marshaled []byte
+		marshaled, err = json.MarshalIndent(diff, "", "   ")
+		buf.Write(marshaled)
+	case "markdown", "md":
+		err = analysis.WriteDiffMarkdown(&buf, []entity.W32Diff{diff})
+	default:
+		logger.Fatalf("unknown diff format: %s", diffFormat)
+	}
+	if err != nil {
+		logger.Fatal(err)
+	}
+
+	if diffOutput == "" {
+		os.Stdout.Write(buf.Bytes())
+	} else if _, err = utils.WriteBytesFile(diffOutput, &buf); err != nil {
+		logger.Fatalf("failed to write %s: %v", diffOutput, err)
+	}
+
+	code := diffExitSame
+	for _, change := range diff.APIs {
+		if change.Breaking {
+			return diffExitBreaking
+		}
+		code = diffExitAdditive
+	}
+	return code
+}
+
+// dbAPI is an API definition as found in the generated files. It accepts the
+// keys of the legacy format as well: callconv and retVal.
+type dbAPI struct {
+	entity.W32API
+	CallConv string `json:"callconv,omitempty"`
+	RetVal   string `json:"retVal,omitempty"`
+}
+
+// loadAPIs reads a generated API definition file, either a list of APIs like
+// w32apis-full.json or APIs grouped by DLL like apis.json.
+func loadAPIs(path string) ([]entity.W32API, error) {
+	data, err := utils.ReadAll(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading %s failed: %v", path, err)
+	}
+
+	var list []dbAPI
+	if err = json.Unmarshal(data, &list); err != nil {
+		var byDLL map[string]map[string]dbAPI
+		if err := json.Unmarshal(data, &byDLL); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal API definitions of %s: %v", path, err)
+		}
+		dlls := make([]string, 0, len(byDLL))
+		for dll := range byDLL {
+			dlls = append(dlls, dll)
+		}
+		sort.Strings(dlls)
+		for _, dll := range dlls {
+			names := make([]string, 0, len(byDLL[dll]))
+			for name := range byDLL[dll] {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				api := byDLL[dll][name]
+				if api.DLL == "" {
+					api.DLL = dll
+				}
+				if api.Name == "" {
+					api.Name = name
+				}
+				list = append(list, api)
+			}
+		}
+	}
+
+	apis := make([]entity.W32API, 0, len(list))
+	for _, api := range list {
+		if api.CallingConvention == "" {
+			api.CallingConvention = api.CallConv
+		}
+		if api.RetType == "" {
+			api.RetType = api.RetVal
+		}
+		apis = append(apis, api.W32API)
+	}
+	return apis, nil
+}
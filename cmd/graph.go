@@ -0,0 +1,147 @@
+// Copyright 2018 Saferwall. All rights reserved.
+// Use of this source code is governed by Apache v2 license
+// license that can be found in the LICENSE file.
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"strings"
+
+	"github.com/saferwall/winsdk2json/internal/analysis"
+	"github.com/saferwall/winsdk2json/internal/entity"
+	log "github.com/saferwall/winsdk2json/internal/logger"
+	"github.com/saferwall/winsdk2json/internal/utils"
+	"github.com/spf13/cobra"
+)
+
+// Used for flags.
+var (
+	graphInput    string
+	graphTypes    string
+	graphOutput   string
+	graphFormat   string
+	graphDLLs     []string
+	graphHeaders  []string
+	graphHookAPIs string
+	graphScalars  bool
+)
+
+func init() {
+
+	graphCmd.Flags().StringVarP(&graphInput, "input", "", "./assets/w32apis-full.json",
+		"Path to the API definitions produced by the parse command")
+	graphCmd.Flags().StringVarP(&graphTypes, "types", "", "./assets/types.json",
+		"Path to the types produced by the parse command, their members link the types, empty to leave them out")
+	graphCmd.Flags().StringVarP(&graphOutput, "output", "o", "",
+		"Path to the output file, defaults to stdout")
+	graphCmd.Flags().StringVarP(&graphFormat, "format", "f", "dot",
+		"Output format: dot or json")
+	graphCmd.Flags().StringSliceVarP(&graphDLLs, "dll", "", nil,
+		"Only keep APIs exported by these DLLs, i.e: kernel32.dll,wininet.dll")
+	graphCmd.Flags().StringSliceVarP(&graphHeaders, "header", "", nil,
+		"Only keep APIs declared in these headers, i.e: fileapi.h,winreg.h")
+	graphCmd.Flags().StringVarP(&graphHookAPIs, "hookapis", "", "",
+		"Only keep APIs listed in this file, new line separated")
+	graphCmd.Flags().BoolVarP(&graphScalars, "scalars", "", false,
+		"Include scalar types like DWORD or BOOL in the graph")
+}
+
+var graphCmd = &cobra.Command{
+	Use:   "graph",
+	Short: "Build the API dependency graph",
+	Long: `Build a graph linking APIs to the types they consume and produce, and
+the types to the types of their members, and export it to Graphviz DOT or
+JSON.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		runGraph()
+	},
+}
+
+func runGraph() {
+
+	logger := log.NewCustom("info").With(context.TODO())
+
+	data, err := utils.ReadAll(graphInput)
+	if err != nil {
+		logger.Fatalf("reading %s failed: %v", graphInput, err)
+	}
+	var w32apis []entity.W32API
+	if err = json.Unmarshal(data, &w32apis); err != nil {
+		logger.Fatalf("failed to unmarshal API definitions: %v", err)
+	}
+
+	types := make(map[string]entity.W32Type)
+	if graphTypes != "" {
+		data, err := utils.ReadAll(graphTypes)
+		if err != nil {
+			logger.Fatalf("reading %s failed: %v", graphTypes, err)
+		}
+		var closure analysis.TypeClosure
+		if err = json.Unmarshal(data, &closure); err != nil {
+			logger.Fatalf("failed to unmarshal types: %v", err)
+		}
+		for _, t := range closure.Types {
+			types[t.Name] = t
+		}
+	}
+
+	var hookAPIs []string
+	if graphHookAPIs != "" {
+		hookAPIs, err = utils.ReadLines(graphHookAPIs)
+		if err != nil {
+			logger.Fatal(err)
+		}
+	}
+
+	for i := range graphDLLs {
+		graphDLLs[i] = strings.ToLower(graphDLLs[i])
+	}
+	for i := range graphHeaders {
+		graphHeaders[i] = strings.ToLower(graphHeaders[i])
+	}
+
+	var filtered []entity.W32API
+	for _, w32api := range w32apis {
+		if len(graphDLLs) > 0 && !utils.StringInSlice(w32api.DLL, graphDLLs) {
+			continue
+		}
+		if len(graphHeaders) > 0 && !utils.StringInSlice(strings.ToLower(w32api.Header), graphHeaders) {
+			continue
+		}
+		if len(hookAPIs) > 0 && !utils.StringInSlice(w32api.Name, hookAPIs) {
+			continue
+		}
+		filtered = append(filtered, w32api)
+	}
+	logger.Infof("building graph for %d APIs", len(filtered))
+
+	g := analysis.BuildGraph(filtered, types, graphScalars)
+
+	var buf bytes.Buffer
+	switch graphFormat {
+	case "dot":
+		err = g.WriteDOT(&buf)
+	case "json":
+		var marshaled []byte
+		marshaled, err = json.MarshalIndent(g, "", "   ")
+		buf.Write(marshaled)
+	default:
+		logger.Fatalf("unknown graph format: %s", graphFormat)
+	}
+	if err != nil {
+		logger.Fatal(err)
+	}
+
+	if graphOutput == "" {
+		os.Stdout.Write(buf.Bytes())
+		return
+	}
+	_, err = utils.WriteBytesFile(graphOutput, &buf)
+	if err != nil {
+		logger.Fatalf("failed to write %s: %v", graphOutput, err)
+	}
+}
@@ -0,0 +1,38 @@
+// Copyright 2018 Saferwall. All rights reserved.
+// Use of this source code is governed by Apache v2 license
+// license that can be found in the LICENSE file.
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+
+	"github.com/saferwall/winsdk2json/internal/config"
+	log "github.com/saferwall/winsdk2json/internal/logger"
+	"github.com/saferwall/winsdk2json/internal/utils"
+	"github.com/saferwall/winsdk2json/pkg/winsdk"
+)
+
+// runKernel translates the kernel mode headers and produces the routines
+// exported by ntoskrnl, hal and fltmgr.
+func runKernel(ctx context.Context, conf *config.Config, opts winsdk.Options) {
+
+	logger := log.NewCustom("info").With(context.TODO())
+
+	db := parse(ctx, conf, opts)
+	images := make(map[string]int)
+	for _, w32api := range db.APIs {
+		images[w32api.DLL]++
+	}
+	for image, count := range images {
+		logger.Infof("%s: %d routines", image, count)
+	}
+
+	marshaled, err := json.MarshalIndent(db.APIs, "", "   ")
+	if err != nil {
+		logger.Fatal(err)
+	}
+	utils.WriteBytesFile(conf.Output(conf.Outputs.Kernel), bytes.NewReader(marshaled))
+}
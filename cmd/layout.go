@@ -0,0 +1,136 @@
+// Copyright 2018 Saferwall. All rights reserved.
+// Use of this source code is governed by Apache v2 license
+// license that can be found in the LICENSE file.
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+
+	"github.com/saferwall/winsdk2json/internal/analysis"
+	"github.com/saferwall/winsdk2json/internal/config"
+	"github.com/saferwall/winsdk2json/internal/entity"
+	log "github.com/saferwall/winsdk2json/internal/logger"
+	"github.com/saferwall/winsdk2json/internal/utils"
+	"github.com/saferwall/winsdk2json/pkg/winsdk"
+	"github.com/spf13/cobra"
+)
+
+// Used for flags, the translation settings are read from the configuration.
+var (
+	layoutVersions []string
+	layoutArchs    []string
+	layoutStructs  []string
+	layoutOutput   string
+)
+
+func init() {
+
+	addConfigFlags(layoutCmd, "phnt-version")
+	layoutCmd.Flags().StringSliceVarP(&layoutVersions, "versions", "", []string{
+		"WIN7", "WIN8", "WINBLUE", "THRESHOLD", "REDSTONE5", "20H1", "WIN10_22H2", "WIN11", "WIN11_22H2"},
+		"The PHNT_VERSION values to translate, oldest first")
+	layoutCmd.Flags().StringSliceVarP(&layoutArchs, "archs", "", []string{"amd64", "386"},
+		"The architectures to translate: amd64, 386 or arm64")
+	layoutCmd.Flags().StringSliceVarP(&layoutStructs, "structs", "", []string{
+		"PEB", "TEB", "PEB_LDR_DATA", "LDR_DATA_TABLE_ENTRY"},
+		"The structures to lay out")
+	layoutCmd.Flags().StringVarP(&layoutOutput, "output", "o", "./assets/layouts.json",
+		"Path to the output file")
+}
+
+var layoutCmd = &cobra.Command{
+	Use:   "layout",
+	Short: "Compute the layout of internal structures per Windows version",
+	Long: `Translate the phnt headers once for each Windows version and architecture,
+and produce the member offsets of internal structures like the PEB and TEB.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		logger := log.NewCustom("info").With(context.TODO())
+		conf, err := loadConfig(cmd)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		runLayout(cmd.Context(), conf)
+	},
+}
+
+func runLayout(ctx context.Context, conf *config.Config) {
+
+	logger := log.NewCustom("info").With(context.TODO())
+	source := []byte("#include <phnt_windows.h>\n#include <phnt.h>\n")
+
+	// The passes run concurrently, their types are stored by index and
+	// collected in the order of the architectures and versions.
+	var passes []string
+	for _, arch := range layoutArchs {
+		for _, version := range layoutVersions {
+			passes = append(passes, version+"/"+arch)
+		}
+	}
+	types := make([]map[string]entity.W32Type, len(passes))
+	err := utils.Parallel(ctx, len(passes), conf.Jobs, func(i int) error {
+		logger.Infof("translating phnt for %s", passes[i])
+		opts := parseOptions(conf)
+		opts.PhntVersion = layoutVersions[i%len(layoutVersions)]
+		opts.Arch = layoutArchs[i/len(layoutVersions)]
+		opts.Sources = []winsdk.Source{{Name: passes[i], Code: source}}
+		opts.TypesOnly = true
+		opts.Jobs = 1
+		db, err := winsdk.Parse(ctx, opts)
+		if err != nil {
+			return err
+		}
+		types[i] = db.Types
+		return nil
+	})
+	if err != nil {
+		logger.Fatal(err)
+	}
+
+	targets := make(map[string][]analysis.LayoutTarget)
+	for i, target := range passes {
+		for _, name := range layoutStructs {
+			def, ok := resolveStruct(types[i], name)
+			if !ok {
+				logger.Infof("structure %s not found for %s", name, target)
+				continue
+			}
+			targets[name] = append(targets[name], analysis.LayoutTarget{Name: target, Def: def})
+		}
+	}
+
+	var layouts []entity.W32StructLayout
+	for _, name := range layoutStructs {
+		layouts = append(layouts, analysis.BuildStructLayout(name, targets[name]))
+	}
+
+	marshaled, err := json.MarshalIndent(layouts, "", "   ")
+	if err != nil {
+		logger.Fatal(err)
+	}
+	_, err = utils.WriteBytesFile(layoutOutput, bytes.NewReader(marshaled))
+	if err != nil {
+		logger.Fatalf("failed to write %s: %v", layoutOutput, err)
+	}
+}
+
+// resolveStruct follows a typedef chain down to a structure or union
+// definition.
+func resolveStruct(types map[string]entity.W32Type, name string) (entity.W32Type, bool) {
+	for i := 0; i < 16; i++ {
+		def, ok := types[name]
+		if !ok {
+			return def, false
+		}
+		if def.Kind == entity.TypeKindStruct || def.Kind == entity.TypeKindUnion {
+			return def, true
+		}
+		if def.Kind != entity.TypeKindTypedef || def.Target == "" {
+			return def, false
+		}
+		name = def.Target
+	}
+	return entity.W32Type{}, false
+}
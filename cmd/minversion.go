@@ -0,0 +1,117 @@
+// Copyright 2018 Saferwall. All rights reserved.
+// Use of this source code is governed by Apache v2 license
+// license that can be found in the LICENSE file.
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/saferwall/winsdk2json/internal/analysis"
+	"github.com/saferwall/winsdk2json/internal/config"
+	log "github.com/saferwall/winsdk2json/internal/logger"
+	"github.com/saferwall/winsdk2json/internal/utils"
+	"github.com/saferwall/winsdk2json/pkg/winsdk"
+	"github.com/spf13/cobra"
+)
+
+// Used for flags, the translation settings are read from the configuration.
+var (
+	minverVersions []string
+	minverOutput   string
+)
+
+func init() {
+
+	addConfigFlags(minverCmd, "ntddi-version")
+	minverCmd.Flags().StringSliceVarP(&minverVersions, "versions", "", []string{
+		"WINXP", "VISTA", "WIN7", "WIN8", "WINBLUE", "WIN10", "WIN10_RS5", "WIN10_VB", "WIN10_CO", "WIN10_NI"},
+		"The NTDDI_VERSION values to translate, i.e: WIN7 or 0x06010000")
+	minverCmd.Flags().StringVarP(&minverOutput, "output", "o", "./assets/minversions.json",
+		"Path to the output file")
+}
+
+var minverCmd = &cobra.Command{
+	Use:   "minver",
+	Short: "Find the minimum Windows version of the APIs, members and values",
+	Long: `Translate the headers once for each NTDDI_VERSION and diff the passes to find
+the oldest version declaring each API, structure member and enumeration value.
+The APIs are cross-checked against the minimum client of the sdk-api docs.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		logger := log.NewCustom("info").With(context.TODO())
+		conf, err := loadConfig(cmd)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		runMinVersion(cmd.Context(), conf)
+	},
+}
+
+func runMinVersion(ctx context.Context, conf *config.Config) {
+
+	logger := log.NewCustom("info").With(context.TODO())
+
+	for _, version := range minverVersions {
+		if _, ok := analysis.ParseNTDDI(version); !ok {
+			logger.Fatalf("invalid NTDDI_VERSION: %s", version)
+		}
+	}
+	passes := make([]analysis.VersionPass, len(minverVersions))
+	// The passes run concurrently, each one translates its sources in turn.
+	err := utils.Parallel(ctx, len(passes), conf.Jobs, func(i int) error {
+		version := minverVersions[i]
+		logger.Infof("translating headers for %s", version)
+		ntddi, _ := analysis.ParseNTDDI(version)
+		opts := parseOptions(conf)
+		opts.NTDDIVersion = fmt.Sprintf("0x%08X", ntddi)
+		opts.TypesOnly = true
+		opts.Jobs = 1
+		db, err := winsdk.Parse(ctx, opts)
+		if err != nil {
+			return err
+		}
+		passes[i] = analysis.VersionPass{
+			Name:      version,
+			NTDDI:     ntddi,
+			Functions: db.Functions,
+			Types:     db.Types,
+		}
+		return nil
+	})
+	if err != nil {
+		logger.Fatal(err)
+	}
+	sort.SliceStable(passes, func(i, j int) bool { return passes[i].NTDDI < passes[j].NTDDI })
+
+	mv := analysis.BuildMinVersions(passes)
+
+	documented := make(map[string]string)
+	for _, api := range mv.APIs {
+		minClient, err := utils.GetMinClient(api.Header, api.Name, conf.SDK.Docs)
+		if err == nil && minClient != "" {
+			documented[api.Name] = minClient
+		}
+	}
+	analysis.CrossCheckMinVersions(&mv, passes, documented)
+
+	mismatches := 0
+	for _, api := range mv.APIs {
+		if api.Mismatch {
+			mismatches++
+		}
+	}
+	logger.Infof("apis: %d, documented: %d, mismatches: %d", len(mv.APIs), len(documented), mismatches)
+
+	marshaled, err := json.MarshalIndent(mv, "", "   ")
+	if err != nil {
+		logger.Fatal(err)
+	}
+	_, err = utils.WriteBytesFile(minverOutput, bytes.NewReader(marshaled))
+	if err != nil {
+		logger.Fatalf("failed to write %s: %v", minverOutput, err)
+	}
+}
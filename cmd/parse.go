@@ -8,34 +8,41 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
-	"flag"
-	"os"
-	"path/filepath"
+	"fmt"
+	"sort"
+	"strings"
 
+	"github.com/saferwall/winsdk2json/internal/analysis"
+	"github.com/saferwall/winsdk2json/internal/config"
+	"github.com/saferwall/winsdk2json/internal/entity"
 	log "github.com/saferwall/winsdk2json/internal/logger"
 	"github.com/saferwall/winsdk2json/internal/utils"
+	"github.com/saferwall/winsdk2json/pkg/winsdk"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 )
 
-// Used for flags.
+// Used for flags, the translation settings are read from the configuration.
 var (
-	sdkapiPath   string
-	includePath  string
-	phntPath     string
-	dumpAST      bool
+	configPath   string
+	printretval  bool
+	printanno    bool
+	minify       bool
 	genJSONForUI bool
 )
 
 func init() {
 
-	parseCmd.Flags().StringVarP(&includePath, "include", "i", "./winsdk/10.0.22000.0",
-		"Path to the Windows Kits include directory")
-	parseCmd.Flags().StringVarP(&sdkapiPath, "sdk-api", "", "./sdk-api",
-		"The path to the sdk-api docs directory (https://github.com/MicrosoftDocs/sdk-api)")
-	parseCmd.Flags().StringVarP(&phntPath, "phnt", "", "./phnt",
-		"The path to the Native API header files for the System Informer project.")
-	parseCmd.Flags().BoolVarP(&dumpAST, "ast", "a", false,
-		"Dump the parsed AST to disk")
+	addConfigFlags(parseCmd)
+	parseCmd.Flags().StringP("hookapis", "", "./assets/hookapis.md",
+		"The path to a a text file thats defines which APIs to trace, new line separated.")
+	parseCmd.Flags().StringP("customhookapis", "", "./assets/custom_hook_apis.md",
+		"The path to a a text file thats defines which APIs uses custom hook handlers")
+	parseCmd.Flags().BoolVarP(&printretval, "printretval", "", false, "Print return value type for each API")
+	parseCmd.Flags().BoolVarP(&printanno, "printanno", "", false, "Print list of annotation values")
+	parseCmd.Flags().BoolVarP(&minify, "minify", "m", false, "Mininify json")
+	parseCmd.Flags().BoolP("ast", "a", false,
+		"Dump the parsed AST of the first source to disk")
 	parseCmd.Flags().BoolVarP(&genJSONForUI, "ui", "u", false,
 		"Generate Win32 API JSON definitions for saferwall UI frontend.")
 }
@@ -45,62 +52,366 @@ var parseCmd = &cobra.Command{
 	Short: "Walk through the Windows SDK and parse the Win32 headers",
 	Long:  `Walk through the Windows SDK and parse the Win32 headers to produce JSON files.`,
 	Run: func(cmd *cobra.Command, args []string) {
-		run()
+		logger := log.NewCustom("info").With(context.TODO())
+		conf, err := loadConfig(cmd)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		opts := parseOptions(conf)
+		if dump, _ := cmd.Flags().GetBool("ast"); dump {
+			opts.DumpAST = &bytes.Buffer{}
+		}
+		run(cmd.Context(), conf, opts)
 	},
 }
 
-func run() {
+// addConfigFlags adds the flags overriding the translation settings of the
+// configuration to a command, but the ones it already has or skips.
+func addConfigFlags(cmd *cobra.Command, skip ...string) {
+	flags := pflag.NewFlagSet(cmd.Name(), pflag.ExitOnError)
+	flags.StringVarP(&configPath, "config", "c", "",
+		"The path to a YAML or JSON file configuring the headers to translate and the outputs")
+	flags.StringP("include", "i", "./winsdk/10.0.22000.0",
+		"Path to the Windows Kits directory, its Include directory or the include directory of a version")
+	flags.StringP("sdk-version", "", "",
+		"The Windows SDK version to translate, i.e: 10.0.19041.0, defaults to the newest one")
+	flags.StringP("msvc", "", "",
+		"Path to the MSVC toolsets, i.e: VC/Tools/MSVC, defaults to the Windows SDK directory")
+	flags.StringP("toolset", "", "",
+		"The MSVC toolset version, i.e: 14.29.30133, defaults to the newest one")
+	flags.StringP("patches", "", "",
+		"Path to a directory of YAML files patching the headers before they are preprocessed")
+	flags.BoolP("resilient", "", false,
+		"Skip the declarations failing to translate instead of aborting, and report them in diagnostics.json")
+	flags.IntP("jobs", "j", 0,
+		"The number of translations running at once, defaults to the number of CPUs")
+	flags.StringP("cache", "", "",
+		"The directory caching the translated model, defaults to winsdk2json under the user cache directory")
+	flags.BoolP("no-cache", "", false,
+		"Translate the headers even when their cached model is up to date")
+	flags.StringP("sdk-api", "", "./sdk-api",
+		"The path to the sdk-api docs directory (https://github.com/MicrosoftDocs/sdk-api)")
+	flags.StringP("phnt", "", "./phnt",
+		"The path to the Native API header files for the System Informer project.")
+	flags.StringP("phnt-version", "", "",
+		"The Windows version targeted by the phnt headers, i.e: WIN7, WIN10_22H2, WIN11 or 114")
+	flags.StringP("phnt-mode", "", "user",
+		"The phnt headers mode: user or kernel")
+	flags.StringP("profile", "", winsdk.ProfileUser,
+		"The headers to translate: user for the Win32 API, kernel for the ntoskrnl, hal and fltmgr routines")
+	flags.StringP("ntddi-version", "", "",
+		"The NTDDI_VERSION targeted by the headers, i.e: WIN10_RS5 or 0x0A000006")
 
-	logger := log.NewCustom("info").With(context.TODO())
-	if _, err := os.Stat(includePath); os.IsNotExist(err) {
-		logger.Errorf("The include directory does not exist ..")
-		flag.Usage()
-		os.Exit(0)
+	flags.VisitAll(func(flag *pflag.Flag) {
+		if cmd.Flags().Lookup(flag.Name) == nil && !utils.StringInSlice(flag.Name, skip) {
+			cmd.Flags().AddFlag(flag)
+		}
+	})
+}
+
+// loadConfig reads the --config file, or the defaults when there is none,
+// then applies the flags given on the command line on top of it.
+func loadConfig(cmd *cobra.Command) (*config.Config, error) {
+	conf := config.Default()
+	if configPath != "" {
+		var err error
+		conf, err = config.Load(configPath)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	flags := cmd.Flags()
+	for name, value := range map[string]*string{
+		"include":        &conf.SDK.Include,
+		"sdk-version":    &conf.SDK.Version,
+		"msvc":           &conf.SDK.MSVC,
+		"toolset":        &conf.SDK.Toolset,
+		"sdk-api":        &conf.SDK.Docs,
+		"phnt":           &conf.Phnt.Path,
+		"phnt-version":   &conf.Phnt.Version,
+		"phnt-mode":      &conf.Phnt.Mode,
+		"profile":        &conf.Target.Profile,
+		"ntddi-version":  &conf.Target.NTDDIVersion,
+		"hookapis":       &conf.Hooks.APIs,
+		"customhookapis": &conf.Hooks.Custom,
+		"patches":        &conf.Patches,
+		"cache":          &conf.Cache.Dir,
+	} {
+		// The --include of sdk-diff lists several directories.
+		if v, err := flags.GetString(name); err == nil && flags.Changed(name) {
+			*value = v
+		}
 	}
+	if flags.Changed("resilient") {
+		conf.Resilient, _ = flags.GetBool("resilient")
+	}
+	if flags.Changed("jobs") {
+		conf.Jobs, _ = flags.GetInt("jobs")
+	}
+	if flags.Changed("no-cache") {
+		conf.Cache.Disabled, _ = flags.GetBool("no-cache")
+	}
+	if err := conf.Resolve(); err != nil {
+		return nil, err
+	}
+	return conf, nil
+}
+
+// parseOptions returns the options translating the headers of a
+// configuration.
+func parseOptions(conf *config.Config) winsdk.Options {
+	opts := winsdk.Options{
+		Include:      conf.SDK.Include,
+		SDKVersion:   conf.SDK.Version,
+		MSVC:         conf.SDK.MSVC,
+		Toolset:      conf.SDK.Toolset,
+		Docs:         conf.SDK.Docs,
+		Phnt:         conf.Phnt.Path,
+		PhntVersion:  conf.Phnt.Version,
+		PhntMode:     conf.Phnt.Mode,
+		Arch:         conf.Target.Arch,
+		Profile:      conf.Target.Profile,
+		NTDDIVersion: conf.Target.NTDDIVersion,
+		Macros:       conf.Macros,
+		IncludePaths: conf.IncludePaths,
+		Merge:        winsdk.Merge{Precedence: conf.Merge.Precedence},
+		Patches:      conf.Patches,
+		Resilient:    conf.Resilient,
+		Jobs:         conf.Jobs,
+		Log:          logWriter{log.NewCustom("info").With(context.TODO())},
+	}
+	for _, source := range conf.Sources {
+		opts.Sources = append(opts.Sources, winsdk.Source{Name: source})
+	}
+	for _, r := range conf.Merge.Rules {
+		opts.Merge.Rules = append(opts.Merge.Rules, winsdk.MergeRule(r))
+	}
+	if !conf.Cache.Disabled {
+		opts.CacheDir = conf.Cache.Dir
+	}
+	return opts
+}
+
+// logWriter logs the lines of the progress messages of a translation.
+type logWriter struct {
+	logger log.Logger
+}
+
+func (w logWriter) Write(p []byte) (int, error) {
+	for _, line := range strings.Split(strings.TrimRight(string(p), "\n"), "\n") {
+		w.logger.Info(line)
+	}
+	return len(p), nil
+}
+
+// parse translates the headers of a configuration. The conflicting
+// definitions of the sources and the errors recovered from are written to
+// their outputs.
+func parse(ctx context.Context, conf *config.Config, opts winsdk.Options) *winsdk.Database {
 
-	filePath := filepath.Join("assets", "header.h")
-	code, err := utils.ReadAll(filePath)
+	logger := log.NewCustom("info").With(context.TODO())
+
+	db, err := winsdk.Parse(ctx, opts)
 	if err != nil {
-		logger.Fatalf("reading header.h failed: %v", err)
+		logger.Fatal(err)
 	}
+	logger.Infof("using Windows SDK %s and MSVC toolset %s", db.SDKVersion, db.Toolset)
 
-	w32apis1 := translate(code)
+	if ast, ok := opts.DumpAST.(*bytes.Buffer); ok {
+		if _, err := utils.WriteBytesFile("ast.txt", ast); err != nil {
+			logger.Fatalf("failed to write ast: %v", err)
+		}
+	}
+	if len(opts.Sources) > 1 {
+		marshaled, err := json.MarshalIndent(db.Conflicts, "", "   ")
+		if err != nil {
+			logger.Fatal(err)
+		}
+		path := conf.Output(conf.Outputs.Conflicts)
+		utils.WriteBytesFile(path, bytes.NewReader(marshaled))
+		logger.Infof("merged %d sources, %d conflicting definitions, see %s",
+			len(opts.Sources), len(db.Conflicts), path)
+	}
+	if opts.Resilient {
+		writeDiagnostics(conf.Output(conf.Outputs.Diagnostics), db.Diagnostics)
+	}
+	for _, patch := range db.Patches {
+		logger.Infof("patch %s of %s: %s", patch.Name, patch.Header, patch.Status)
+	}
+	return db
+}
+
+// writeDiagnostics writes the errors the translation recovered from and the
+// declarations skipped for them.
+func writeDiagnostics(path string, diagnostics []winsdk.Diagnostic) {
 
-	filePath = filepath.Join("assets", "header2.h")
-	code, err = utils.ReadAll(filePath)
+	logger := log.NewCustom("info").With(context.TODO())
+
+	if diagnostics == nil {
+		diagnostics = []winsdk.Diagnostic{}
+	}
+	marshaled, err := json.MarshalIndent(diagnostics, "", "   ")
 	if err != nil {
-		logger.Fatalf("reading header2.h failed: %v", err)
+		logger.Fatal(err)
 	}
+	utils.WriteBytesFile(path, bytes.NewReader(marshaled))
 
-	w32apis2 := translate(code)
+	// Several units may skip the same declaration.
+	skipped := make(map[string]bool)
+	for _, d := range diagnostics {
+		skipped[fmt.Sprintf("%s:%d-%d", d.File, d.Skipped.FromLine, d.Skipped.ToLine)] = true
+	}
+	logger.Infof("skipped %d declarations for %d errors, see %s", len(skipped), len(diagnostics), path)
+}
 
-	var uniqueIDs []string
-	for _, w32api := range w32apis1 {
-		id := w32api.DLL + "-" + w32api.Name
-		uniqueIDs = append(uniqueIDs, id)
+func run(ctx context.Context, conf *config.Config, opts winsdk.Options) {
+
+	logger := log.NewCustom("info").With(context.TODO())
+	if conf.Target.Profile == winsdk.ProfileKernel {
+		runKernel(ctx, conf, opts)
+		return
 	}
 
-	// WinINET conflicts.
-	for _, w32api := range w32apis2 {
-		id := w32api.DLL + "-" + w32api.Name
-		if !utils.StringInSlice(id, uniqueIDs) {
-			w32apis1 = append(w32apis1, w32api)
+	// Read the list of APIs we are interested to hook, and the ones using a
+	// custom hook handler.
+	hookAPIs, err := utils.ReadLines(conf.Hooks.APIs)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	if len(hookAPIs) == 0 {
+		logger.Fatalf("%s is empty", conf.Hooks.APIs)
+	}
+	var customHookAPIs []string
+	if conf.Hooks.Custom != "" {
+		customHookAPIs, err = utils.ReadLines(conf.Hooks.Custom)
+		if err != nil {
+			logger.Fatal(err)
+		}
+	}
+	if len(customHookAPIs) == 0 {
+		logger.Infof("%s is empty", conf.Hooks.Custom)
+	}
+
+	// The hook handlers need the structures layout of both architectures,
+	// the other one is translated along with the sources.
+	if minify {
+		for _, arch := range []string{"386", "amd64"} {
+			if arch != opts.Arch {
+				opts.ExtraArchs = append(opts.ExtraArchs, arch)
+			}
 		}
 	}
+	db := parse(ctx, conf, opts)
+	w32apis1, w32types, callbacks := db.APIs, db.Types, db.Callbacks
+	interfaces, guids, ioctls := db.Interfaces, db.GUIDs, db.IOCTLs
 
 	marshaled, err := json.MarshalIndent(w32apis1, "", "   ")
 	if err != nil {
 		logger.Fatal(err)
 	}
-	utils.WriteBytesFile("./assets/w32apis-full.json", bytes.NewReader(marshaled))
+	utils.WriteBytesFile(conf.Output(conf.Outputs.APIs), bytes.NewReader(marshaled))
 
-	if genJSONForUI {
+	// The APIs we hook grouped by DLL, the native ones come from the phnt
+	// headers translated along with the SDK.
+	var hooked []entity.W32API
+	apis := make(map[string]map[string]entity.W32API)
+	for _, w32api := range w32apis1 {
+		if !utils.StringInSlice(w32api.Name, hookAPIs) && !utils.StringInSlice(w32api.Name, customHookAPIs) {
+			continue
+		}
+		hooked = append(hooked, w32api)
+		if _, ok := apis[w32api.DLL]; !ok {
+			apis[w32api.DLL] = make(map[string]entity.W32API)
+		}
+		apis[w32api.DLL][w32api.Name] = w32api
+	}
+	marshaled, err = json.MarshalIndent(apis, "", " ")
+	if err != nil {
+		logger.Fatal(err)
+	}
+	utils.WriteBytesFile(conf.Output(conf.Outputs.Hooked), bytes.NewReader(marshaled))
+	logger.Infof("Parsed API count: %d, Wanted API Count: %d", len(hooked), len(hookAPIs))
 
-		// Read the list of APIs we are interested to hook.
-		wantedAPIs, err := utils.ReadLines("./assets/hookapis.md")
+	if printretval {
+		printRetVals(apis, hookAPIs)
+	}
+	if printanno {
+		printAnnotations(apis)
+	}
+
+	// Pair the APIs creating handles with the ones releasing them.
+	lifetimes := analysis.BuildLifetimes(w32apis1)
+	marshaled, err = json.MarshalIndent(lifetimes, "", "   ")
+	if err != nil {
+		logger.Fatal(err)
+	}
+	utils.WriteBytesFile(conf.Output(conf.Outputs.Lifetimes), bytes.NewReader(marshaled))
+
+	// Only keep the types reachable from the APIs we hook.
+	closure := analysis.BuildTypeClosure(hooked, w32types, callbacks)
+	for _, name := range closure.Unresolved {
+		logger.Infof("failed to resolve type: %s", name)
+	}
+	logger.Infof("types: %d, unresolved: %d", len(closure.Types), len(closure.Unresolved))
+	marshaled, err = json.MarshalIndent(closure, "", "   ")
+	if err != nil {
+		logger.Fatal(err)
+	}
+	utils.WriteBytesFile(conf.Output(conf.Outputs.Types), bytes.NewReader(marshaled))
+
+	if minify {
+		marshaled, err = json.Marshal(analysis.MinifyAPIs(apis, customHookAPIs, w32types))
 		if err != nil {
 			logger.Fatal(err)
 		}
+		utils.WriteBytesFile(conf.Output(conf.Outputs.MiniAPIs), bytes.NewReader(marshaled))
+
+		var names []string
+		for _, t := range closure.Types {
+			names = append(names, t.Name)
+		}
+		x86Types, x64Types := w32types, w32types
+		if types, ok := db.ArchTypes["386"]; ok {
+			x86Types = types
+		}
+		if types, ok := db.ArchTypes["amd64"]; ok {
+			x64Types = types
+		}
+		marshaled, err = json.Marshal(analysis.MinifyStructs(names, x86Types, x64Types))
+		if err != nil {
+			logger.Fatal(err)
+		}
+		utils.WriteBytesFile(conf.Output(conf.Outputs.MiniStructs), bytes.NewReader(marshaled))
+	}
+	marshaled, err = json.MarshalIndent(callbacks, "", "   ")
+	if err != nil {
+		logger.Fatal(err)
+	}
+	utils.WriteBytesFile(conf.Output(conf.Outputs.Callbacks), bytes.NewReader(marshaled))
+
+	marshaled, err = json.MarshalIndent(interfaces, "", "   ")
+	if err != nil {
+		logger.Fatal(err)
+	}
+	utils.WriteBytesFile(conf.Output(conf.Outputs.Interfaces), bytes.NewReader(marshaled))
+
+	marshaled, err = json.MarshalIndent(guids, "", "   ")
+	if err != nil {
+		logger.Fatal(err)
+	}
+	utils.WriteBytesFile(conf.Output(conf.Outputs.GUIDs), bytes.NewReader(marshaled))
+
+	marshaled, err = json.MarshalIndent(ioctls, "", "   ")
+	if err != nil {
+		logger.Fatal(err)
+	}
+	utils.WriteBytesFile(conf.Output(conf.Outputs.IOCTLs), bytes.NewReader(marshaled))
+
+	if genJSONForUI {
+
+		// Read the list of APIs we are interested to hook.
+		wantedAPIs := hookAPIs
 
 		uiMap := make(map[string][][2]string)
 		for _, w32api := range w32apis1 {
@@ -130,6 +441,66 @@ func run() {
 		if err != nil {
 			logger.Fatal(err)
 		}
-		utils.WriteBytesFile("./assets/w32apis-ui.json", bytes.NewReader(marshaled))
+		utils.WriteBytesFile(conf.Output(conf.Outputs.UI), bytes.NewReader(marshaled))
+	}
+}
+
+// printRetVals logs the calling convention and return type of each API, and
+// the wanted APIs that were not found.
+func printRetVals(apis map[string]map[string]entity.W32API, wantedAPIs []string) {
+	logger := log.NewCustom("info").With(context.TODO())
+
+	var dlls []string
+	for dll := range apis {
+		dlls = append(dlls, dll)
+	}
+	sort.Strings(dlls)
+
+	found := make(map[string]bool)
+	for _, dll := range dlls {
+		logger.Infof("DLL: %s", dll)
+		logger.Info("====================")
+		var names []string
+		for name := range apis[dll] {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			w32api := apis[dll][name]
+			logger.Infof("API: %s:%s() => %s", w32api.CallingConvention, name, w32api.RetType)
+			found[name] = true
+		}
+	}
+	for _, name := range wantedAPIs {
+		if !found[name] {
+			logger.Infof("Not found: %s", name)
+		}
+	}
+}
+
+// printAnnotations logs the distinct parameter annotations and types.
+func printAnnotations(apis map[string]map[string]entity.W32API) {
+	logger := log.NewCustom("info").With(context.TODO())
+
+	var annotations, types []string
+	for _, byName := range apis {
+		for _, w32api := range byName {
+			for _, param := range w32api.Params {
+				if !utils.StringInSlice(param.Annotation, annotations) {
+					annotations = append(annotations, param.Annotation)
+				}
+				if !utils.StringInSlice(param.Type, types) {
+					types = append(types, param.Type)
+				}
+			}
+		}
+	}
+	sort.Strings(annotations)
+	sort.Strings(types)
+	for _, anno := range annotations {
+		logger.Infof("Annotation: %s", anno)
+	}
+	for _, t := range types {
+		logger.Infof("Type: %s", t)
 	}
 }
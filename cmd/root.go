@@ -40,5 +40,9 @@ func Execute() error {
 func init() {
 	rootCmd.AddCommand(versionCmd)
 	rootCmd.AddCommand(parseCmd)
-	rootCmd.AddCommand(parseCmdOld)
+	rootCmd.AddCommand(graphCmd)
+	rootCmd.AddCommand(layoutCmd)
+	rootCmd.AddCommand(minverCmd)
+	rootCmd.AddCommand(sdkdiffCmd)
+	rootCmd.AddCommand(diffCmd)
 }
@@ -0,0 +1,131 @@
+// Copyright 2018 Saferwall. All rights reserved.
+// Use of this source code is governed by Apache v2 license
+// license that can be found in the LICENSE file.
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+
+	"github.com/saferwall/winsdk2json/internal/analysis"
+	"github.com/saferwall/winsdk2json/internal/config"
+	"github.com/saferwall/winsdk2json/internal/entity"
+	log "github.com/saferwall/winsdk2json/internal/logger"
+	"github.com/saferwall/winsdk2json/internal/sdk"
+	"github.com/saferwall/winsdk2json/internal/utils"
+	"github.com/saferwall/winsdk2json/internal/vfs"
+	"github.com/saferwall/winsdk2json/pkg/winsdk"
+	"github.com/spf13/cobra"
+)
+
+// Used for flags, the translation settings are read from the configuration.
+var (
+	sdkdiffRoots  []string
+	sdkdiffFormat string
+	sdkdiffOutput string
+)
+
+func init() {
+
+	sdkdiffCmd.Flags().StringSliceVarP(&sdkdiffRoots, "include", "i", nil,
+		"Paths to the Windows SDK versions to compare, oldest first, or a Windows Kits directory to compare all its versions")
+	addConfigFlags(sdkdiffCmd, "sdk-version")
+	sdkdiffCmd.Flags().StringVarP(&sdkdiffFormat, "format", "f", "markdown",
+		"Output format: json or markdown")
+	sdkdiffCmd.Flags().StringVarP(&sdkdiffOutput, "output", "o", "",
+		"Path to the output file, defaults to stdout")
+}
+
+var sdkdiffCmd = &cobra.Command{
+	Use:   "sdk-diff",
+	Short: "Compare the APIs and types of several Windows SDK versions",
+	Long: `Translate the headers of several Windows Kits include directories and report
+the APIs added, removed or changed between consecutive versions: parameter
+renames, type and annotation changes, along with the structure layout changes.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		logger := log.NewCustom("info").With(context.TODO())
+		conf, err := loadConfig(cmd)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		runSDKDiff(cmd.Context(), conf)
+	},
+}
+
+func runSDKDiff(ctx context.Context, conf *config.Config) {
+
+	logger := log.NewCustom("info").With(context.TODO())
+
+	// A single Windows Kits directory compares all the versions it holds.
+	roots := sdkdiffRoots
+	if len(roots) == 1 {
+		fsys := vfs.New(nil)
+		defer fsys.Close()
+		versions, dir, err := sdk.Versions(fsys, roots[0])
+		if err != nil {
+			logger.Fatal(err)
+		}
+		roots = nil
+		for _, version := range versions {
+			roots = append(roots, filepath.Join(dir, version))
+		}
+	}
+	if len(roots) < 2 {
+		logger.Fatalf("at least two Windows SDK versions are needed, got %d", len(roots))
+	}
+
+	// The versions are translated concurrently, each one translates its
+	// sources in turn.
+	translations := make([]*winsdk.Database, len(roots))
+	err := utils.Parallel(ctx, len(roots), conf.Jobs, func(i int) error {
+		logger.Infof("translating headers of %s", roots[i])
+		opts := parseOptions(conf)
+		opts.Include = roots[i]
+		opts.Jobs = 1
+		db, err := winsdk.Parse(ctx, opts)
+		translations[i] = db
+		return err
+	})
+	if err != nil {
+		logger.Fatal(err)
+	}
+
+	var diffs []entity.W32Diff
+	for i := 1; i < len(translations); i++ {
+		prev, next := translations[i-1], translations[i]
+		diffs = append(diffs, entity.W32Diff{
+			From:  prev.SDKVersion,
+			To:    next.SDKVersion,
+			APIs:  analysis.DiffAPIs(prev.APIs, next.APIs),
+			Types: analysis.DiffTypes(prev.Types, next.Types),
+		})
+	}
+
+	var buf bytes.Buffer
+	switch sdkdiffFormat {
+	case "json":
+		var marshaled []byte
+		marshaled, err = json.MarshalIndent(diffs, "", "   ")
+		buf.Write(marshaled)
+	case "markdown", "md":
+		err = analysis.WriteDiffMarkdown(&buf, diffs)
+	default:
+		logger.Fatalf("unknown sdk-diff format: %s", sdkdiffFormat)
+	}
+	if err != nil {
+		logger.Fatal(err)
+	}
+
+	if sdkdiffOutput == "" {
+		os.Stdout.Write(buf.Bytes())
+		return
+	}
+	_, err = utils.WriteBytesFile(sdkdiffOutput, &buf)
+	if err != nil {
+		logger.Fatalf("failed to write %s: %v", sdkdiffOutput, err)
+	}
+}
@@ -5,15 +5,16 @@ go 1.19
 require (
 	github.com/dlclark/regexp2 v1.8.1
 	github.com/spf13/cobra v1.6.1
+	github.com/spf13/pflag v1.0.5
 	github.com/xlab/c-for-go v0.0.0-20230906092656-a1822f0a09c1
 	go.uber.org/zap v1.25.0
+	gopkg.in/yaml.v3 v3.0.1
 	modernc.org/cc/v4 v4.14.2
 )
 
 require (
 	github.com/inconshreveable/mousetrap v1.0.1 // indirect
 	github.com/remyoudompheng/bigfft v0.0.0-20230129092748-24d4a6f8daec // indirect
-	github.com/spf13/pflag v1.0.5 // indirect
 	go.uber.org/multierr v1.11.0 // indirect
 	modernc.org/mathutil v1.6.0 // indirect
 	modernc.org/opt v0.1.3 // indirect
@@ -0,0 +1,110 @@
+// Copyright 2018 Saferwall. All rights reserved.
+// Use of this source code is governed by Apache v2 license
+// license that can be found in the LICENSE file.
+
+package analysis
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/saferwall/winsdk2json/internal/entity"
+	"github.com/saferwall/winsdk2json/internal/utils"
+)
+
+var (
+	// Array dimensions: CHAR[260] or WCHAR[].
+	reArrayDim = regexp.MustCompile(`\[[^\]]*\]`)
+
+	// C builtin types, they are always resolved.
+	builtinTypes = []string{
+		"void", "char", "signed char", "unsigned char", "short", "unsigned short",
+		"int", "unsigned", "unsigned int", "long", "unsigned long", "long long",
+		"unsigned long long", "float", "double", "long double", "_Bool",
+		"wchar_t", "__int128", "unsigned __int128", "...",
+	}
+)
+
+// TypeClosure holds the types reachable from a set of APIs.
+type TypeClosure struct {
+	Types      []entity.W32Type `json:"types"`
+	Unresolved []string         `json:"unresolved,omitempty"`
+}
+
+// BuildTypeClosure computes the transitive set of types needed to describe
+// the parameters and return values of a list of APIs. Types are followed
+// through typedef chains, pointers, arrays, structure or union members and
+// callback signatures. Type names missing from the types table end up in the
+// unresolved list.
+func BuildTypeClosure(apis []entity.W32API, types map[string]entity.W32Type,
+	callbacks map[string]entity.W32Callback) *TypeClosure {
+
+	closure := &TypeClosure{}
+	seen := make(map[string]bool)
+	unresolved := make(map[string]bool)
+
+	var visit func(t string)
+	var visitMembers func(members []entity.W32TypeMember)
+
+	visitMembers = func(members []entity.W32TypeMember) {
+		for _, m := range members {
+			if m.Def != nil {
+				visitMembers(m.Def.Members)
+				continue
+			}
+			visit(m.Type)
+		}
+	}
+
+	visit = func(t string) {
+		name := BaseTypeName(t)
+		if name == "" || seen[name] || utils.StringInSlice(name, builtinTypes) {
+			return
+		}
+		seen[name] = true
+
+		def, ok := types[name]
+		if !ok {
+			unresolved[name] = true
+			return
+		}
+		closure.Types = append(closure.Types, def)
+
+		if def.Target != "" {
+			visit(def.Target)
+		}
+		visitMembers(def.Members)
+
+		if cb, ok := callbacks[name]; ok {
+			visit(cb.RetType)
+			for _, param := range cb.Params {
+				visit(param.Type)
+			}
+		}
+	}
+
+	for _, api := range apis {
+		visit(api.RetType)
+		for _, param := range api.Params {
+			visit(param.Type)
+		}
+	}
+
+	sort.Slice(closure.Types, func(i, j int) bool {
+		return closure.Types[i].Name < closure.Types[j].Name
+	})
+	for name := range unresolved {
+		closure.Unresolved = append(closure.Unresolved, name)
+	}
+	sort.Strings(closure.Unresolved)
+	return closure
+}
+
+// BaseTypeName strips qualifiers, pointers and array dimensions from a type:
+// const struct _GUID *[2] gives struct _GUID.
+func BaseTypeName(t string) string {
+	t = reArrayDim.ReplaceAllString(t, "")
+	t = strings.NewReplacer("*", " ", "const ", " ", "volatile ", " ").Replace(" " + t + " ")
+	return strings.Join(strings.Fields(t), " ")
+}
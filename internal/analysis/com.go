@@ -0,0 +1,51 @@
+// Copyright 2018 Saferwall. All rights reserved.
+// Use of this source code is governed by Apache v2 license
+// license that can be found in the LICENSE file.
+
+package analysis
+
+import (
+	"sort"
+
+	"github.com/saferwall/winsdk2json/internal/entity"
+)
+
+// InferBaseInterfaces fills the base of the COM interfaces that do not have
+// one. C vtables repeat the methods of every ancestor, so the base is the
+// interface whose methods are the longest prefix of the vtable.
+func InferBaseInterfaces(ifaces map[string]entity.W32Interface) {
+
+	var names []string
+	for name := range ifaces {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		iface := ifaces[name]
+		if iface.Base != "" {
+			continue
+		}
+		best := 0
+		for _, other := range names {
+			candidate := ifaces[other]
+			n := len(candidate.Methods)
+			if other == name || n <= best || n >= len(iface.Methods) {
+				continue
+			}
+			if isMethodPrefix(candidate.Methods, iface.Methods) {
+				iface.Base, best = other, n
+			}
+		}
+		ifaces[name] = iface
+	}
+}
+
+func isMethodPrefix(prefix, methods []entity.W32Method) bool {
+	for i, m := range prefix {
+		if methods[i].Name != m.Name {
+			return false
+		}
+	}
+	return true
+}
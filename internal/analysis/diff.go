@@ -0,0 +1,268 @@
+// Copyright 2018 Saferwall. All rights reserved.
+// Use of this source code is governed by Apache v2 license
+// license that can be found in the LICENSE file.
+
+package analysis
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/saferwall/winsdk2json/internal/entity"
+)
+
+// DiffAPIs compares two versions of a list of APIs, matched by DLL and name,
+// and reports the added, removed and changed ones: return type, calling
+// convention, parameters names, types and annotations ... An API exported
+// by a single DLL in both versions, but not the same one, is reported as
+// moved. Removals, moves and changes altering the binary interface are
+// flagged as breaking.
+func DiffAPIs(oldAPIs, newAPIs []entity.W32API) []entity.W32Change {
+
+	before := apisByKey(oldAPIs)
+	after := apisByKey(newAPIs)
+
+	// The keys found in a single version, by API name.
+	removed := make(map[string][]string)
+	for key, api := range before {
+		if _, ok := after[key]; !ok {
+			removed[api.Name] = append(removed[api.Name], key)
+		}
+	}
+	added := make(map[string][]string)
+	for key, api := range after {
+		if _, ok := before[key]; !ok {
+			added[api.Name] = append(added[api.Name], key)
+		}
+	}
+	moved := func(name string) bool {
+		return len(removed[name]) == 1 && len(added[name]) == 1
+	}
+
+	var changes []entity.W32Change
+	for key, a := range before {
+		b, ok := after[key]
+		switch {
+		case ok:
+			if details, breaking := apiChanges(a, b); len(details) > 0 {
+				changes = append(changes, entity.W32Change{Name: key, Kind: entity.ChangeChanged,
+					Breaking: breaking, Details: details})
+			}
+		case moved(a.Name):
+			to := added[a.Name][0]
+			details, _ := apiChanges(a, after[to])
+			changes = append(changes, entity.W32Change{Name: to, Kind: entity.ChangeMoved,
+				Breaking: true, Details: details})
+		default:
+			changes = append(changes, entity.W32Change{Name: key, Kind: entity.ChangeRemoved, Breaking: true})
+		}
+	}
+	for key, b := range after {
+		if _, ok := before[key]; !ok && !moved(b.Name) {
+			changes = append(changes, entity.W32Change{Name: key, Kind: entity.ChangeAdded})
+		}
+	}
+
+	sortChanges(changes)
+	return changes
+}
+
+// apisByKey indexes a list of APIs by DLL and name, i.e:
+// kernel32.dll!CreateFileW, or by name when the DLL is unknown.
+func apisByKey(apis []entity.W32API) map[string]entity.W32API {
+	byKey := make(map[string]entity.W32API, len(apis))
+	for _, api := range apis {
+		key := api.Name
+		if api.DLL != "" {
+			key = strings.ToLower(api.DLL) + "!" + api.Name
+		}
+		byKey[key] = api
+	}
+	return byKey
+}
+
+// DiffTypes compares two versions of the structures, unions, enumerations
+// and typedefs, matched by name, and reports their layout changes. Changes
+// moving or resizing existing members or values are flagged as breaking.
+func DiffTypes(oldTypes, newTypes map[string]entity.W32Type) []entity.W32Change {
+
+	var changes []entity.W32Change
+	for name, a := range oldTypes {
+		b, ok := newTypes[name]
+		if !ok {
+			changes = append(changes, entity.W32Change{Name: name, Kind: entity.ChangeRemoved, Breaking: true})
+			continue
+		}
+		if details, breaking := typeChanges(a, b); len(details) > 0 {
+			changes = append(changes, entity.W32Change{Name: name, Kind: entity.ChangeChanged,
+				Breaking: breaking, Details: details})
+		}
+	}
+	for name := range newTypes {
+		if _, ok := oldTypes[name]; !ok {
+			changes = append(changes, entity.W32Change{Name: name, Kind: entity.ChangeAdded})
+		}
+	}
+
+	sortChanges(changes)
+	return changes
+}
+
+func apiChanges(a, b entity.W32API) ([]string, bool) {
+	var details []string
+	var breaking bool
+	changed := func(what, from, to string, breaks bool) {
+		if from != to {
+			details = append(details, fmt.Sprintf("%s changed from %q to %q", what, from, to))
+			breaking = breaking || breaks
+		}
+	}
+
+	changed("dll", a.DLL, b.DLL, true)
+	changed("header", a.Header, b.Header, false)
+	changed("calling convention", a.CallingConvention, b.CallingConvention, true)
+	changed("return type", a.RetType, b.RetType, true)
+	changed("success annotation", a.Success, b.Success, false)
+
+	for i := 0; i < len(a.Params) || i < len(b.Params); i++ {
+		switch {
+		case i >= len(b.Params):
+			details = append(details, fmt.Sprintf("parameter %d %s removed", i+1, a.Params[i].Name))
+			breaking = true
+		case i >= len(a.Params):
+			details = append(details, fmt.Sprintf("parameter %d %s added", i+1, b.Params[i].Name))
+			breaking = true
+		default:
+			p, q := a.Params[i], b.Params[i]
+			if p.Name != q.Name {
+				details = append(details, fmt.Sprintf("parameter %d renamed from %s to %s", i+1, p.Name, q.Name))
+			}
+			changed(fmt.Sprintf("parameter %s type", q.Name), p.Type, q.Type, true)
+			changed(fmt.Sprintf("parameter %s annotation", q.Name), p.Annotation, q.Annotation, false)
+		}
+	}
+	return details, breaking
+}
+
+func typeChanges(a, b entity.W32Type) ([]string, bool) {
+	var details []string
+	var breaking bool
+	add := func(breaks bool, format string, args ...interface{}) {
+		details = append(details, fmt.Sprintf(format, args...))
+		breaking = breaking || breaks
+	}
+
+	if a.Kind != b.Kind {
+		add(true, "kind changed from %s to %s", a.Kind, b.Kind)
+	}
+	if a.Target != b.Target {
+		add(true, "target changed from %q to %q", a.Target, b.Target)
+	}
+	if a.Size != b.Size {
+		add(true, "size changed from %d to %d", a.Size, b.Size)
+	}
+
+	before := FlattenMembers(a.Members)
+	after := make(map[string]entity.W32TypeMember)
+	for _, m := range FlattenMembers(b.Members) {
+		after[m.Name] = m
+	}
+	seen := make(map[string]bool)
+	for _, m := range before {
+		seen[m.Name] = true
+		n, ok := after[m.Name]
+		switch {
+		case !ok:
+			add(true, "member %s removed", m.Name)
+		case m.Offset != n.Offset:
+			add(true, "member %s moved from %#x to %#x", m.Name, m.Offset, n.Offset)
+		case m.Type != n.Type:
+			add(true, "member %s type changed from %q to %q", m.Name, m.Type, n.Type)
+		case m.Size != n.Size:
+			add(true, "member %s resized from %d to %d", m.Name, m.Size, n.Size)
+		}
+	}
+	// New members only break the layout when they move the existing ones.
+	for _, m := range FlattenMembers(b.Members) {
+		if !seen[m.Name] {
+			add(false, "member %s added at %#x", m.Name, m.Offset)
+		}
+	}
+
+	values := make(map[string]int64)
+	for _, v := range a.Values {
+		values[v.Name] = v.Value
+	}
+	for _, v := range b.Values {
+		old, ok := values[v.Name]
+		switch {
+		case !ok:
+			add(false, "value %s added", v.Name)
+		case old != v.Value:
+			add(true, "value %s changed from %d to %d", v.Name, old, v.Value)
+		}
+		delete(values, v.Name)
+	}
+	var removed []string
+	for name := range values {
+		removed = append(removed, name)
+	}
+	sort.Strings(removed)
+	for _, name := range removed {
+		add(true, "value %s removed", name)
+	}
+	return details, breaking
+}
+
+func sortChanges(changes []entity.W32Change) {
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Name < changes[j].Name })
+}
+
+// WriteDiffMarkdown writes a list of diffs as a Markdown report.
+func WriteDiffMarkdown(w io.Writer, diffs []entity.W32Diff) error {
+	var b strings.Builder
+	for i, diff := range diffs {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		fmt.Fprintf(&b, "# %s -> %s\n", diff.From, diff.To)
+		if len(diff.APIs) == 0 && len(diff.Types) == 0 {
+			b.WriteString("\nNo changes.\n")
+			continue
+		}
+		writeChangesMarkdown(&b, "APIs", diff.APIs)
+		writeChangesMarkdown(&b, "Types", diff.Types)
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func writeChangesMarkdown(b *strings.Builder, title string, changes []entity.W32Change) {
+	if len(changes) == 0 {
+		return
+	}
+	counts := make(map[string]int)
+	for _, c := range changes {
+		counts[c.Kind]++
+	}
+	fmt.Fprintf(b, "\n## %s\n\n", title)
+	fmt.Fprintf(b, "%d added, %d removed, %d changed", counts[entity.ChangeAdded],
+		counts[entity.ChangeRemoved], counts[entity.ChangeChanged])
+	if counts[entity.ChangeMoved] > 0 {
+		fmt.Fprintf(b, ", %d moved", counts[entity.ChangeMoved])
+	}
+	b.WriteString(".\n")
+	b.WriteString("\n")
+	for _, c := range changes {
+		breaking := ""
+		if c.Breaking {
+			breaking = " (breaking)"
+		}
+		fmt.Fprintf(b, "- **%s** `%s`%s\n", c.Kind, c.Name, breaking)
+		for _, detail := range c.Details {
+			fmt.Fprintf(b, "  - %s\n", detail)
+		}
+	}
+}
@@ -0,0 +1,228 @@
+// Copyright 2018 Saferwall. All rights reserved.
+// Use of this source code is governed by Apache v2 license
+// license that can be found in the LICENSE file.
+
+package analysis
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/saferwall/winsdk2json/internal/entity"
+	"github.com/saferwall/winsdk2json/internal/utils"
+)
+
+// Node kinds of the API dependency graph.
+const (
+	NodeAPI  = "api"
+	NodeType = "type"
+)
+
+// Edge directions of the API dependency graph.
+const (
+	EdgeIn    = "in"    // The API consumes the type.
+	EdgeOut   = "out"   // The API produces the type through an out parameter.
+	EdgeInOut = "inout" // The API consumes and updates the type.
+	EdgeRet   = "ret"   // The API returns the type.
+
+	EdgeMember = "member" // The type holds a member of the other type.
+	EdgeAlias  = "alias"  // The typedef names the other type.
+)
+
+var (
+	reInOutAnno = regexp.MustCompile(`^_Inout`)
+
+	// Scalar types carry no interesting data flow, they are left out of the
+	// graph unless asked otherwise.
+	scalarTypes = []string{
+		"void", "VOID", "BOOL", "BOOLEAN", "BYTE", "UCHAR", "CHAR", "char",
+		"WCHAR", "wchar_t", "SHORT", "USHORT", "WORD", "short", "INT", "UINT",
+		"int", "unsigned int", "LONG", "ULONG", "long", "unsigned long",
+		"DWORD", "DWORD64", "DWORDLONG", "LONGLONG", "ULONGLONG", "LONG64",
+		"ULONG64", "INT64", "UINT64", "INT32", "UINT32", "DWORD_PTR",
+		"ULONG_PTR", "LONG_PTR", "UINT_PTR", "INT_PTR", "SIZE_T", "SSIZE_T",
+		"size_t", "LPARAM", "WPARAM", "LRESULT", "HRESULT", "NTSTATUS",
+		"LSTATUS", "ACCESS_MASK", "float", "double", "long long",
+		"unsigned long long", "errno_t",
+	}
+)
+
+// GraphNode is either an API or a type.
+type GraphNode struct {
+	ID     string `json:"id"`
+	Kind   string `json:"kind"`
+	Name   string `json:"name"`
+	DLL    string `json:"dll,omitempty"`
+	Header string `json:"header,omitempty"`
+}
+
+// GraphEdge links an API to a type it consumes or produces, edges always go
+// in the direction of the data flow. It also links a type to the types of
+// its members and to the type it aliases.
+type GraphEdge struct {
+	From  string `json:"from"`
+	To    string `json:"to"`
+	Dir   string `json:"dir"`
+	Param string `json:"param,omitempty"`
+}
+
+// Graph is an API <-> type graph, along with the type -> type edges of the
+// types definitions.
+type Graph struct {
+	Nodes []GraphNode `json:"nodes"`
+	Edges []GraphEdge `json:"edges"`
+}
+
+// BuildGraph creates the API <-> type graph of a list of APIs, the direction
+// of each parameter is taken from its SAL annotation. The APIs are keyed by
+// DLL and name. The types are followed through the types table, to the
+// types of their members and to the types they alias, so the APIs taking a
+// structure holding a given type can be found.
+func BuildGraph(apis []entity.W32API, types map[string]entity.W32Type, withScalars bool) *Graph {
+
+	g := &Graph{}
+	seen := make(map[string]bool)
+	var queue []string
+	addType := func(t string) string {
+		id := NodeType + ":" + t
+		if !seen[id] {
+			seen[id] = true
+			g.Nodes = append(g.Nodes, GraphNode{ID: id, Kind: NodeType, Name: t})
+			queue = append(queue, t)
+		}
+		return id
+	}
+
+	for _, api := range apis {
+		apiID := NodeAPI + ":" + api.Name
+		if api.DLL != "" {
+			apiID = NodeAPI + ":" + api.DLL + "!" + api.Name
+		}
+		if seen[apiID] {
+			continue
+		}
+		seen[apiID] = true
+		g.Nodes = append(g.Nodes, GraphNode{
+			ID: apiID, Kind: NodeAPI, Name: api.Name, DLL: api.DLL, Header: api.Header})
+
+		if t := graphType(api.RetType); withScalars || !isScalarType(t) {
+			g.Edges = append(g.Edges, GraphEdge{From: apiID, To: addType(t), Dir: EdgeRet})
+		}
+
+		for _, param := range api.Params {
+			t := graphType(param.Type)
+			if !withScalars && isScalarType(t) {
+				continue
+			}
+			typeID := addType(t)
+			switch {
+			case reInOutAnno.MatchString(param.Annotation):
+				g.Edges = append(g.Edges, GraphEdge{From: typeID, To: apiID, Dir: EdgeInOut, Param: param.Name})
+				g.Edges = append(g.Edges, GraphEdge{From: apiID, To: typeID, Dir: EdgeInOut, Param: param.Name})
+			case reOutAnno.MatchString(param.Annotation):
+				g.Edges = append(g.Edges, GraphEdge{From: apiID, To: typeID, Dir: EdgeOut, Param: param.Name})
+			default:
+				g.Edges = append(g.Edges, GraphEdge{From: typeID, To: apiID, Dir: EdgeIn, Param: param.Name})
+			}
+		}
+	}
+
+	// The types reached so far lead to the types of their definition.
+	for len(queue) > 0 {
+		name := queue[0]
+		queue = queue[1:]
+		def, ok := types[name]
+		if !ok {
+			continue
+		}
+		typeID := NodeType + ":" + name
+		if t := graphType(BaseTypeName(def.Target)); def.Target != "" && !skipGraphType(t, withScalars) {
+			g.Edges = append(g.Edges, GraphEdge{From: typeID, To: addType(t), Dir: EdgeAlias})
+		}
+		var addMembers func(members []entity.W32TypeMember)
+		addMembers = func(members []entity.W32TypeMember) {
+			for _, m := range members {
+				if m.Def != nil {
+					addMembers(m.Def.Members)
+					continue
+				}
+				t := graphType(BaseTypeName(m.Type))
+				if skipGraphType(t, withScalars) {
+					continue
+				}
+				g.Edges = append(g.Edges, GraphEdge{From: typeID, To: addType(t), Dir: EdgeMember, Param: m.Name})
+			}
+		}
+		addMembers(def.Members)
+	}
+
+	sort.SliceStable(g.Nodes, func(i, j int) bool { return g.Nodes[i].ID < g.Nodes[j].ID })
+	return g
+}
+
+// WriteDOT writes the graph in the Graphviz DOT format.
+func (g *Graph) WriteDOT(w io.Writer) error {
+	var b strings.Builder
+	b.WriteString("digraph winsdk {\n")
+	b.WriteString("  rankdir=LR;\n")
+	for _, n := range g.Nodes {
+		shape := "box"
+		if n.Kind == NodeType {
+			shape = "ellipse"
+		}
+		fmt.Fprintf(&b, "  %s [label=%s, shape=%s];\n", dotString(n.ID), dotString(n.Name), shape)
+	}
+	for _, e := range g.Edges {
+		label := e.Dir
+		if e.Param != "" {
+			label = e.Param + " (" + e.Dir + ")"
+		}
+		fmt.Fprintf(&b, "  %s -> %s [label=%s];\n", dotString(e.From), dotString(e.To), dotString(label))
+	}
+	b.WriteString("}\n")
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// dotString quotes a DOT string. Unlike Go strings, DOT only knows the \"
+// escape and keeps the other characters as is: the backslashes are doubled
+// so they are not read as label escapes like \l, and the line breaks become
+// \n.
+func dotString(s string) string {
+	s = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", "").Replace(s)
+	return `"` + s + `"`
+}
+
+// graphType normalizes a type so pointers to a type and the type itself end
+// up in the same node: PHKEY, HKEY* and HKEY all give HKEY.
+func graphType(t string) string {
+	if h, _ := HandleType(t); h != "" {
+		return h
+	}
+	t = strings.TrimSpace(strings.TrimPrefix(t, "const "))
+	return strings.TrimSpace(strings.TrimRight(t, "* "))
+}
+
+// skipGraphType reports whether the types of members and typedefs are left
+// out of the graph: the builtin types, and the scalar ones unless asked
+// otherwise.
+func skipGraphType(t string, withScalars bool) bool {
+	if t == "" || t == "..." {
+		return true
+	}
+	return !withScalars && (isScalarType(t) || utils.StringInSlice(t, builtinTypes))
+}
+
+func isScalarType(t string) bool {
+	if utils.StringInSlice(t, scalarTypes) {
+		return true
+	}
+	if strings.HasPrefix(t, "LP") && utils.StringInSlice(t[2:], scalarTypes) {
+		return true
+	}
+	return strings.HasPrefix(t, "P") && utils.StringInSlice(t[1:], scalarTypes)
+}
@@ -0,0 +1,60 @@
+// Copyright 2018 Saferwall. All rights reserved.
+// Use of this source code is governed by Apache v2 license
+// license that can be found in the LICENSE file.
+
+package analysis
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+
+	"github.com/saferwall/winsdk2json/internal/entity"
+)
+
+// GUIDCatalog maps a GUID in its registry form to its symbolic names.
+type GUIDCatalog map[string][]entity.W32GUID
+
+// NewGUIDCatalog indexes a list of GUIDs.
+func NewGUIDCatalog(guids []entity.W32GUID) GUIDCatalog {
+	c := make(GUIDCatalog)
+	for _, g := range guids {
+		key := strings.ToUpper(g.GUID)
+		c[key] = append(c[key], g)
+	}
+	return c
+}
+
+// Lookup returns the symbolic name of a GUID. The GUID may be enclosed in
+// braces and use any case: {9556dc99-828c-11cf-a37e-00aa003240c7}.
+func (c GUIDCatalog) Lookup(guid string) (string, bool) {
+	guid = strings.ToUpper(strings.Trim(strings.TrimSpace(guid), "{}"))
+	names, ok := c[guid]
+	if !ok || len(names) == 0 {
+		return "", false
+	}
+	return names[0].Name, true
+}
+
+// LookupBytes returns the symbolic name of a GUID given as the 16 bytes of
+// its in-memory layout, as read from a REFIID or REFCLSID parameter.
+func (c GUIDCatalog) LookupBytes(b []byte) (string, bool) {
+	guid, err := GUIDFromBytes(b)
+	if err != nil {
+		return "", false
+	}
+	return c.Lookup(guid)
+}
+
+// GUIDFromBytes formats the in-memory layout of a GUID into its registry
+// form. The first three fields are little endian.
+func GUIDFromBytes(b []byte) (string, error) {
+	if len(b) != 16 {
+		return "", fmt.Errorf("a GUID is 16 bytes long, got %d", len(b))
+	}
+	return fmt.Sprintf("%08X-%04X-%04X-%X-%X",
+		binary.LittleEndian.Uint32(b[0:4]),
+		binary.LittleEndian.Uint16(b[4:6]),
+		binary.LittleEndian.Uint16(b[6:8]),
+		b[8:10], b[10:16]), nil
+}
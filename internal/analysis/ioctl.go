@@ -0,0 +1,65 @@
+// Copyright 2018 Saferwall. All rights reserved.
+// Use of this source code is governed by Apache v2 license
+// license that can be found in the LICENSE file.
+
+package analysis
+
+import (
+	"github.com/saferwall/winsdk2json/internal/entity"
+)
+
+var (
+	ioctlMethods = [4]string{"METHOD_BUFFERED", "METHOD_IN_DIRECT", "METHOD_OUT_DIRECT", "METHOD_NEITHER"}
+	ioctlAccess  = [4]string{"FILE_ANY_ACCESS", "FILE_READ_ACCESS", "FILE_WRITE_ACCESS",
+		"FILE_READ_ACCESS | FILE_WRITE_ACCESS"}
+)
+
+// IOCTLCatalog maps control codes to their definitions.
+type IOCTLCatalog struct {
+	codes       map[uint32][]entity.W32IOCTL
+	deviceTypes map[uint32]string
+}
+
+// NewIOCTLCatalog indexes the control codes defined by the headers.
+func NewIOCTLCatalog(catalog entity.W32IOCTLCatalog) *IOCTLCatalog {
+	c := &IOCTLCatalog{
+		codes:       make(map[uint32][]entity.W32IOCTL),
+		deviceTypes: catalog.DeviceTypes,
+	}
+	for _, ioctl := range catalog.Codes {
+		c.codes[ioctl.Code] = append(c.codes[ioctl.Code], ioctl)
+	}
+	return c
+}
+
+// Lookup returns the symbolic name of a control code.
+func (c *IOCTLCatalog) Lookup(code uint32) (string, bool) {
+	ioctls, ok := c.codes[code]
+	if !ok || len(ioctls) == 0 {
+		return "", false
+	}
+	return ioctls[0].Name, true
+}
+
+// Decode splits a control code into its fields. Codes missing from the
+// catalogue are decoded too, they only lack a name.
+func (c *IOCTLCatalog) Decode(code uint32) entity.W32IOCTL {
+	if ioctls, ok := c.codes[code]; ok && len(ioctls) > 0 {
+		return ioctls[0]
+	}
+	return DecodeIOCTL(code, c.deviceTypes)
+}
+
+// DecodeIOCTL splits a control code into the fields of the CTL_CODE macro.
+// Device types are named from deviceTypes, which can be nil.
+func DecodeIOCTL(code uint32, deviceTypes map[uint32]string) entity.W32IOCTL {
+	ioctl := entity.W32IOCTL{
+		Code:       code,
+		DeviceType: code >> 16,
+		Function:   (code >> 2) & 0xFFF,
+		Method:     ioctlMethods[code&3],
+		Access:     ioctlAccess[(code>>14)&3],
+	}
+	ioctl.DeviceTypeName = deviceTypes[ioctl.DeviceType]
+	return ioctl
+}
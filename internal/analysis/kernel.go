@@ -0,0 +1,47 @@
+// Copyright 2018 Saferwall. All rights reserved.
+// Use of this source code is governed by Apache v2 license
+// license that can be found in the LICENSE file.
+
+package analysis
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Images exporting the kernel mode routines.
+const (
+	KernelImageNtoskrnl = "ntoskrnl.exe"
+	KernelImageHal      = "hal.dll"
+	KernelImageFltMgr   = "fltmgr.sys"
+)
+
+var (
+	// Import macros found in front of the kernel routines declarations:
+	// NTKERNELAPI VOID KeBugCheck(...), NTHALAPI VOID KeStallExecutionProcessor(...)
+	reKernelImport = regexp.MustCompile(`\b(NTHALAPI|FLTAPI|NTKERNELAPI|NTSYSAPI|NTSYSCALLAPI)\b`)
+
+	kernelImports = map[string]string{
+		"NTHALAPI":     KernelImageHal,
+		"FLTAPI":       KernelImageFltMgr,
+		"NTKERNELAPI":  KernelImageNtoskrnl,
+		"NTSYSAPI":     KernelImageNtoskrnl,
+		"NTSYSCALLAPI": KernelImageNtoskrnl,
+	}
+)
+
+// KernelImage returns the image exporting a routine declared by the kernel
+// mode headers. The import macro preceding the routine name in decl wins,
+// otherwise the header and the routine prefix are used.
+func KernelImage(name, header, decl string) string {
+	if m := reKernelImport.FindStringSubmatch(decl); len(m) > 1 {
+		return kernelImports[m[1]]
+	}
+	switch {
+	case strings.EqualFold(header, "fltKernel.h"):
+		return KernelImageFltMgr
+	case strings.HasPrefix(name, "Hal"):
+		return KernelImageHal
+	}
+	return KernelImageNtoskrnl
+}
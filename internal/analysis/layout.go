@@ -0,0 +1,102 @@
+// Copyright 2018 Saferwall. All rights reserved.
+// Use of this source code is governed by Apache v2 license
+// license that can be found in the LICENSE file.
+
+package analysis
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/saferwall/winsdk2json/internal/entity"
+)
+
+// LayoutTarget is a structure definition translated for one target.
+type LayoutTarget struct {
+	Name string         // Target name: VERSION/arch.
+	Def  entity.W32Type // Structure definition.
+}
+
+// BuildStructLayout merges the definitions of a structure translated for
+// several targets into a member offset table. Targets are expected in version
+// order, each one is compared to the previous target of the same architecture
+// to report the members that appear, disappear or move.
+func BuildStructLayout(name string, targets []LayoutTarget) entity.W32StructLayout {
+
+	layout := entity.W32StructLayout{Name: name, Sizes: make(map[string]int64)}
+	index := make(map[string]int)
+
+	for _, target := range targets {
+		layout.Targets = append(layout.Targets, target.Name)
+		layout.Sizes[target.Name] = target.Def.Size
+
+		for _, m := range FlattenMembers(target.Def.Members) {
+			i, ok := index[m.Name]
+			if !ok {
+				i = len(layout.Members)
+				index[m.Name] = i
+				layout.Members = append(layout.Members, entity.W32MemberLayout{
+					Name: m.Name, Type: m.Type, Layouts: make(map[string]entity.W32FieldLayout)})
+			}
+			layout.Members[i].Layouts[target.Name] = entity.W32FieldLayout{Offset: m.Offset, Size: m.Size}
+		}
+	}
+
+	previous := make(map[string]string)
+	for _, target := range layout.Targets {
+		arch := targetArch(target)
+		prev, ok := previous[arch]
+		previous[arch] = target
+		if !ok {
+			continue
+		}
+		for i := range layout.Members {
+			m := &layout.Members[i]
+			before, had := m.Layouts[prev]
+			after, has := m.Layouts[target]
+			switch {
+			case !had && has:
+				m.Changes = append(m.Changes, fmt.Sprintf("added in %s at %#x", target, after.Offset))
+			case had && !has:
+				m.Changes = append(m.Changes, fmt.Sprintf("removed in %s", target))
+			case had && has && before.Offset != after.Offset:
+				m.Changes = append(m.Changes, fmt.Sprintf("moved in %s from %#x to %#x", target, before.Offset, after.Offset))
+			case had && has && before.Size != after.Size:
+				m.Changes = append(m.Changes, fmt.Sprintf("resized in %s from %d to %d", target, before.Size, after.Size))
+			}
+		}
+	}
+
+	return layout
+}
+
+// FlattenMembers lists the members of a structure with absolute offsets.
+// Members of anonymous structures and unions are hoisted, the ones of named
+// nested definitions are prefixed with their parent name.
+func FlattenMembers(members []entity.W32TypeMember) []entity.W32TypeMember {
+	var flat []entity.W32TypeMember
+	for _, m := range members {
+		if m.Def == nil {
+			// Unnamed bit fields only pad the structure.
+			if m.Name != "" {
+				flat = append(flat, m)
+			}
+			continue
+		}
+		for _, nested := range FlattenMembers(m.Def.Members) {
+			nested.Offset += m.Offset
+			if m.Name != "" {
+				nested.Name = m.Name + "." + nested.Name
+			}
+			flat = append(flat, nested)
+		}
+	}
+	return flat
+}
+
+func targetArch(target string) string {
+	if i := strings.LastIndex(target, "/"); i >= 0 {
+		return target[i+1:]
+	}
+	return ""
+}
@@ -0,0 +1,279 @@
+// Copyright 2018 Saferwall. All rights reserved.
+// Use of this source code is governed by Apache v2 license
+// license that can be found in the LICENSE file.
+
+package analysis
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/saferwall/winsdk2json/internal/entity"
+	"github.com/saferwall/winsdk2json/internal/utils"
+)
+
+var (
+	// Handle types declared with DECLARE_HANDLE: HKEY, HMODULE, HINTERNET ...
+	reHandleType = regexp.MustCompile(`^H[A-Z0-9]+$`)
+
+	// Out annotations: _Out_, _Out_opt_, _Outptr_, ...
+	reOutAnno = regexp.MustCompile(`^_Out`)
+
+	// Types that look like handles but are not.
+	notHandleTypes = []string{"HRESULT", "HFILE", "HALF_PTR"}
+
+	// Post-condition annotations meaning the parameter is no longer valid
+	// once the call returns.
+	releaseAnnos = []string{"_Post_ptr_invalid_", "_Post_invalid_", "_Frees_ptr_", "_Frees_ptr_opt_"}
+
+	// defaultReleasers maps a handle type to the API that usually releases it.
+	defaultReleasers = map[string]string{
+		"HANDLE":             "CloseHandle",
+		"HKEY":               "RegCloseKey",
+		"HINTERNET":          "InternetCloseHandle",
+		"SC_HANDLE":          "CloseServiceHandle",
+		"HMODULE":            "FreeLibrary",
+		"HINSTANCE":          "FreeLibrary",
+		"SOCKET":             "closesocket",
+		"HCERTSTORE":         "CertCloseStore",
+		"HCRYPTPROV":         "CryptReleaseContext",
+		"HCRYPTKEY":          "CryptDestroyKey",
+		"HCRYPTHASH":         "CryptDestroyHash",
+		"BCRYPT_ALG_HANDLE":  "BCryptCloseAlgorithmProvider",
+		"BCRYPT_KEY_HANDLE":  "BCryptDestroyKey",
+		"BCRYPT_HASH_HANDLE": "BCryptDestroyHash",
+		"HHOOK":              "UnhookWindowsHookEx",
+		"HWND":               "DestroyWindow",
+		"HDESK":              "CloseDesktop",
+		"HWINSTA":            "CloseWindowStation",
+		"HGLOBAL":            "GlobalFree",
+		"HLOCAL":             "LocalFree",
+		"HMENU":              "DestroyMenu",
+		"HICON":              "DestroyIcon",
+		"HDC":                "DeleteDC",
+		"HBITMAP":            "DeleteObject",
+		"RPC_BINDING_HANDLE": "RpcBindingFree",
+		"HDEVINFO":           "SetupDiDestroyDeviceInfoList",
+		"PSID":               "FreeSid",
+		"LSA_HANDLE":         "LsaClose",
+		"HCATADMIN":          "CryptCATAdminReleaseContext",
+		"NCRYPT_PROV_HANDLE": "NCryptFreeObject",
+		"NCRYPT_KEY_HANDLE":  "NCryptFreeObject",
+		"HPOWERNOTIFY":       "UnregisterPowerSettingNotification",
+		"HDEVNOTIFY":         "UnregisterDeviceNotification",
+		"HCRYPTMSG":          "CryptMsgClose",
+		"HSTRING":            "WindowsDeleteString",
+		"PTP_POOL":           "CloseThreadpool",
+		"PTP_WORK":           "CloseThreadpoolWork",
+		"PTP_TIMER":          "CloseThreadpoolTimer",
+		"PTP_WAIT":           "CloseThreadpoolWait",
+		"PTP_IO":             "CloseThreadpoolIo",
+		"PTP_CLEANUP_GROUP":  "CloseThreadpoolCleanupGroup",
+	}
+
+	// releasedBy is a curated table of APIs whose result is not released by
+	// the default releaser of its handle type. An empty list means the
+	// handle is borrowed (pseudo handles, module handles ...) and must not be
+	// released. A/W suffixes are ignored.
+	releasedBy = map[string][]string{
+		"FindFirstFile":                {"FindClose"},
+		"FindFirstFileEx":              {"FindClose"},
+		"FindFirstFileTransacted":      {"FindClose"},
+		"FindFirstStream":              {"FindClose"},
+		"FindFirstFileName":            {"FindClose"},
+		"FindFirstVolume":              {"FindVolumeClose"},
+		"FindFirstVolumeMountPoint":    {"FindVolumeMountPointClose"},
+		"FindFirstChangeNotification":  {"FindCloseChangeNotification"},
+		"HeapCreate":                   {"HeapDestroy"},
+		"OpenEventLog":                 {"CloseEventLog"},
+		"OpenBackupEventLog":           {"CloseEventLog"},
+		"RegisterEventSource":          {"DeregisterEventSource"},
+		"CreateTimerQueue":             {"DeleteTimerQueueEx"},
+		"CreateActCtx":                 {"ReleaseActCtx"},
+		"WinHttpOpen":                  {"WinHttpCloseHandle"},
+		"WinHttpConnect":               {"WinHttpCloseHandle"},
+		"WinHttpOpenRequest":           {"WinHttpCloseHandle"},
+		"WSASocket":                    {"closesocket"},
+		"LoadResource":                 {},
+		"GetCurrentProcess":            {},
+		"GetCurrentThread":             {},
+		"GetStdHandle":                 {},
+		"GetProcessHeap":               {},
+		"GetModuleHandle":              {},
+		"GetModuleHandleEx":            {"FreeLibrary"},
+		"GetDesktopWindow":             {},
+		"GetForegroundWindow":          {},
+		"GetShellWindow":               {},
+		"GetConsoleWindow":             {},
+		"FindWindow":                   {},
+		"FindWindowEx":                 {},
+		"GetDC":                        {"ReleaseDC"},
+		"GetWindowDC":                  {"ReleaseDC"},
+		"AllocateAndInitializeSid":     {"FreeSid"},
+		"ConvertStringSidToSid":        {"LocalFree"},
+		"CreateWellKnownSid":           {},
+		"SetupDiGetClassDevs":          {"SetupDiDestroyDeviceInfoList"},
+		"RegisterServiceCtrlHandler":   {},
+		"RegisterServiceCtrlHandlerEx": {},
+	}
+
+	// knownDestructors lists APIs that release their handle parameter but
+	// whose prototype lacks a post-condition annotation.
+	knownDestructors = []string{
+		"CloseHandle", "RegCloseKey", "InternetCloseHandle", "WinHttpCloseHandle",
+		"CloseServiceHandle", "FreeLibrary", "FreeLibraryAndExitThread",
+		"closesocket", "FindClose", "FindVolumeClose", "FindVolumeMountPointClose",
+		"FindCloseChangeNotification", "HeapDestroy", "CertCloseStore",
+		"CryptReleaseContext", "CryptDestroyKey", "CryptDestroyHash",
+		"BCryptCloseAlgorithmProvider", "BCryptDestroyKey", "BCryptDestroyHash",
+		"UnhookWindowsHookEx", "DestroyWindow", "CloseDesktop",
+		"CloseWindowStation", "CloseEventLog", "DeregisterEventSource",
+		"DeleteTimerQueueEx", "ReleaseActCtx", "GlobalFree", "LocalFree",
+		"DestroyMenu", "DestroyIcon", "DeleteDC", "ReleaseDC", "DeleteObject",
+		"RpcBindingFree", "SetupDiDestroyDeviceInfoList", "FreeSid", "LsaClose",
+		"CryptCATAdminReleaseContext", "NCryptFreeObject", "CryptMsgClose",
+		"UnregisterPowerSettingNotification", "UnregisterDeviceNotification",
+		"WindowsDeleteString", "CloseThreadpool", "CloseThreadpoolWork",
+		"CloseThreadpoolTimer", "CloseThreadpoolWait", "CloseThreadpoolIo",
+		"CloseThreadpoolCleanupGroup", "NtClose", "ZwClose",
+	}
+)
+
+// BuildLifetimes infers, for every handle type, which APIs produce it, which
+// ones consume it and which ones release it. Producers are APIs returning a
+// handle or writing one to an out parameter, destructors are found from
+// post-condition annotations and a curated table.
+func BuildLifetimes(apis []entity.W32API) map[string]*entity.Lifetime {
+
+	lifetimes := make(map[string]*entity.Lifetime)
+	get := func(t string) *entity.Lifetime {
+		lt, ok := lifetimes[t]
+		if !ok {
+			lt = &entity.Lifetime{Type: t}
+			lifetimes[t] = lt
+		}
+		return lt
+	}
+
+	// Start by collecting the destructors, consumers of a handle type exclude
+	// them.
+	destructors := make(map[string]string)
+	for _, api := range apis {
+		curated := utils.StringInSlice(api.Name, knownDestructors)
+		for _, param := range api.Params {
+			t, isPtr := HandleType(param.Type)
+			if t == "" || isPtr {
+				continue
+			}
+			if curated || utils.StringInSlice(param.Post, releaseAnnos) {
+				destructors[api.Name] = t
+				lt := get(t)
+				if !utils.StringInSlice(api.Name, lt.Destructors) {
+					lt.Destructors = append(lt.Destructors, api.Name)
+				}
+				break
+			}
+		}
+	}
+
+	for _, api := range apis {
+		if t, isPtr := HandleType(api.RetType); t != "" && !isPtr {
+			lt := get(t)
+			lt.Producers = append(lt.Producers, producer(api.Name, "", t))
+		}
+
+		for _, param := range api.Params {
+			t, isPtr := HandleType(param.Type)
+			if t == "" {
+				continue
+			}
+			if isPtr {
+				if reOutAnno.MatchString(param.Annotation) {
+					lt := get(t)
+					lt.Producers = append(lt.Producers, producer(api.Name, param.Name, t))
+				}
+				continue
+			}
+			if destructors[api.Name] == t {
+				continue
+			}
+			lt := get(t)
+			if !utils.StringInSlice(api.Name, lt.Consumers) {
+				lt.Consumers = append(lt.Consumers, api.Name)
+			}
+		}
+	}
+
+	for _, lt := range lifetimes {
+		sort.Slice(lt.Producers, func(i, j int) bool {
+			if lt.Producers[i].API != lt.Producers[j].API {
+				return lt.Producers[i].API < lt.Producers[j].API
+			}
+			return lt.Producers[i].Param < lt.Producers[j].Param
+		})
+		sort.Strings(lt.Consumers)
+		sort.Strings(lt.Destructors)
+	}
+
+	return lifetimes
+}
+
+// HandleType returns the handle type a type refers to, and whether the type
+// is a pointer to that handle: PHANDLE gives HANDLE and true. It returns an
+// empty string for types that are not handles.
+func HandleType(t string) (string, bool) {
+	t = strings.TrimSpace(strings.TrimPrefix(t, "const "))
+	if isHandleType(t) {
+		return t, false
+	}
+
+	switch {
+	case strings.HasSuffix(t, "*") && isHandleType(strings.TrimSpace(t[:len(t)-1])):
+		return strings.TrimSpace(t[:len(t)-1]), true
+	case strings.HasPrefix(t, "LP") && isHandleType(t[2:]):
+		return t[2:], true
+	case strings.HasPrefix(t, "P") && isHandleType(t[1:]):
+		return t[1:], true
+	}
+	return "", false
+}
+
+func isHandleType(t string) bool {
+	if utils.StringInSlice(t, notHandleTypes) {
+		return false
+	}
+	if _, ok := defaultReleasers[t]; ok {
+		return true
+	}
+	return t == "HANDLE" || strings.HasSuffix(t, "_HANDLE") || reHandleType.MatchString(t)
+}
+
+// producer describes the API producing a handle, returned or written to
+// param, along with the APIs releasing it. The handles it borrows are told
+// apart from the ones whose releaser is unknown.
+func producer(api, param, handleType string) entity.LifetimeProducer {
+	p := entity.LifetimeProducer{API: api, Param: param}
+	if r, ok := releasedBy[trimCharset(api)]; ok {
+		p.ReleasedBy = r
+		p.Borrowed = len(r) == 0
+		if p.Borrowed {
+			p.ReleasedBy = nil
+		}
+	} else if r := defaultReleasers[handleType]; r != "" {
+		p.ReleasedBy = []string{r}
+	}
+	return p
+}
+
+// trimCharset removes the ANSI/Unicode suffix of an API name:
+// CreateFileW gives CreateFile.
+func trimCharset(api string) string {
+	n := len(api)
+	if n > 2 && (api[n-1] == 'A' || api[n-1] == 'W') {
+		if c := api[n-2]; (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') {
+			return api[:n-1]
+		}
+	}
+	return api
+}
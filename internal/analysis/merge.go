@@ -0,0 +1,361 @@
+// Copyright 2018 Saferwall. All rights reserved.
+// Use of this source code is governed by Apache v2 license
+// license that can be found in the LICENSE file.
+
+package analysis
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/saferwall/winsdk2json/internal/entity"
+)
+
+// Merge precedences.
+const (
+	PrecedenceFirst = "first" // The definition of the first translation unit is kept.
+	PrecedenceLast  = "last"  // The definition of the last translation unit is kept.
+)
+
+// MergeRule keeps the definition of a given translation unit for the
+// entities matching it.
+type MergeRule struct {
+	// Shell patterns matching the name, the header and the DLL of the
+	// entity, the empty ones match anything. The header and DLL ones are
+	// case insensitive.
+	Name   string
+	Header string
+	DLL    string
+	// The translation unit whose definition is kept, as listed in the
+	// sources.
+	Source string
+}
+
+// Merger merges the entities of several translation units by key: the DLL
+// and name of the APIs, the name of the other entities. When several units
+// define the same entity, the first matching rule or else the precedence
+// tells which definition is kept, and the other ones are reported as
+// conflicts when they differ.
+type Merger struct {
+	// The translation units, in the order they are given to the merge.
+	Sources    []string
+	Precedence string
+	Rules      []MergeRule
+}
+
+// definition is an entity of a translation unit.
+type definition struct {
+	unit              int
+	key               string
+	name, header, dll string
+	value             interface{}
+}
+
+// Validate checks the precedence, the rules patterns, and that the rules
+// sources are translated.
+func (m *Merger) Validate() error {
+	switch m.Precedence {
+	case "", PrecedenceFirst, PrecedenceLast:
+	default:
+		return fmt.Errorf("unknown merge precedence: %q", m.Precedence)
+	}
+	for _, r := range m.Rules {
+		for _, pattern := range []string{r.Name, r.Header, r.DLL} {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("invalid merge rule pattern: %q", pattern)
+			}
+		}
+		if m.source(r.Source) < 0 {
+			return fmt.Errorf("merge rule source %s is not one of the sources", r.Source)
+		}
+	}
+	return nil
+}
+
+// MergeAPIs merges the APIs of the translation units, keyed by DLL and
+// name, in order of appearance.
+func (m *Merger) MergeAPIs(units [][]entity.W32API) ([]entity.W32API, []entity.W32Conflict) {
+	var defs []definition
+	for i, apis := range units {
+		for _, api := range apis {
+			defs = append(defs, definition{unit: i, key: strings.ToLower(api.DLL) + "!" + api.Name,
+				name: api.Name, header: api.Header, dll: api.DLL, value: api})
+		}
+	}
+	kept, conflicts := m.merge(entity.ConflictAPI, defs, func(a, b interface{}) []string {
+		details, _ := apiChanges(a.(entity.W32API), b.(entity.W32API))
+		return details
+	})
+
+	apis := make([]entity.W32API, 0, len(kept))
+	for _, d := range kept {
+		apis = append(apis, d.value.(entity.W32API))
+	}
+	return apis, conflicts
+}
+
+// MergeTypes merges the types of the translation units, keyed by name.
+func (m *Merger) MergeTypes(units []map[string]entity.W32Type) (map[string]entity.W32Type, []entity.W32Conflict) {
+	var defs []definition
+	for i, types := range units {
+		for _, name := range sortedKeys(types) {
+			t := types[name]
+			defs = append(defs, definition{unit: i, key: name, name: name, header: t.Header, value: t})
+		}
+	}
+	kept, conflicts := m.merge(entity.ConflictType, defs, func(a, b interface{}) []string {
+		details, _ := typeChanges(a.(entity.W32Type), b.(entity.W32Type))
+		return details
+	})
+
+	types := make(map[string]entity.W32Type, len(kept))
+	for _, d := range kept {
+		types[d.key] = d.value.(entity.W32Type)
+	}
+	return types, conflicts
+}
+
+// MergeCallbacks merges the callbacks of the translation units, keyed by
+// name.
+func (m *Merger) MergeCallbacks(units []map[string]entity.W32Callback) (map[string]entity.W32Callback, []entity.W32Conflict) {
+	var defs []definition
+	for i, callbacks := range units {
+		for _, name := range sortedKeys(callbacks) {
+			c := callbacks[name]
+			defs = append(defs, definition{unit: i, key: name, name: name, header: c.Header, value: c})
+		}
+	}
+	kept, conflicts := m.merge(entity.ConflictCallback, defs, fieldChanges)
+
+	callbacks := make(map[string]entity.W32Callback, len(kept))
+	for _, d := range kept {
+		callbacks[d.key] = d.value.(entity.W32Callback)
+	}
+	return callbacks, conflicts
+}
+
+// MergeInterfaces merges the COM interfaces of the translation units, keyed
+// by name.
+func (m *Merger) MergeInterfaces(units []map[string]entity.W32Interface) (map[string]entity.W32Interface, []entity.W32Conflict) {
+	var defs []definition
+	for i, interfaces := range units {
+		for _, name := range sortedKeys(interfaces) {
+			iface := interfaces[name]
+			defs = append(defs, definition{unit: i, key: name, name: name, header: iface.Header, value: iface})
+		}
+	}
+	kept, conflicts := m.merge(entity.ConflictInterface, defs, fieldChanges)
+
+	interfaces := make(map[string]entity.W32Interface, len(kept))
+	for _, d := range kept {
+		interfaces[d.key] = d.value.(entity.W32Interface)
+	}
+	return interfaces, conflicts
+}
+
+// MergeGUIDs merges the GUIDs of the translation units, keyed by name, in
+// order of appearance.
+func (m *Merger) MergeGUIDs(units [][]entity.W32GUID) ([]entity.W32GUID, []entity.W32Conflict) {
+	var defs []definition
+	for i, guids := range units {
+		for _, g := range guids {
+			defs = append(defs, definition{unit: i, key: g.Name, name: g.Name, header: g.Header, value: g})
+		}
+	}
+	kept, conflicts := m.merge(entity.ConflictGUID, defs, fieldChanges)
+
+	guids := make([]entity.W32GUID, 0, len(kept))
+	for _, d := range kept {
+		guids = append(guids, d.value.(entity.W32GUID))
+	}
+	return guids, conflicts
+}
+
+// MergeIOCTLs merges the control codes of the translation units, keyed by
+// name, in order of appearance. The device types are merged by value.
+func (m *Merger) MergeIOCTLs(units []entity.W32IOCTLCatalog) (entity.W32IOCTLCatalog, []entity.W32Conflict) {
+	catalog := entity.W32IOCTLCatalog{DeviceTypes: make(map[uint32]string)}
+	var defs []definition
+	for i, unit := range units {
+		for value, name := range unit.DeviceTypes {
+			if _, ok := catalog.DeviceTypes[value]; !ok {
+				catalog.DeviceTypes[value] = name
+			}
+		}
+		for _, ioctl := range unit.Codes {
+			key := ioctl.Name
+			if key == "" {
+				key = fmt.Sprintf("%#x", ioctl.Code)
+			}
+			defs = append(defs, definition{unit: i, key: key, name: ioctl.Name, header: ioctl.Header, value: ioctl})
+		}
+	}
+	kept, conflicts := m.merge(entity.ConflictIOCTL, defs, fieldChanges)
+
+	for _, d := range kept {
+		catalog.Codes = append(catalog.Codes, d.value.(entity.W32IOCTL))
+	}
+	return catalog, conflicts
+}
+
+// MergeFunctions merges the functions declared by the translation units,
+// mapped to their header. The declarations only differ by their
+// annotations, the APIs report those conflicts.
+func (m *Merger) MergeFunctions(units []map[string]string) map[string]string {
+	var defs []definition
+	for i, functions := range units {
+		for _, name := range sortedKeys(functions) {
+			header := functions[name]
+			defs = append(defs, definition{unit: i, key: name, name: name, header: header, value: header})
+		}
+	}
+	kept, _ := m.merge("", defs, fieldChanges)
+
+	functions := make(map[string]string, len(kept))
+	for _, d := range kept {
+		functions[d.key] = d.value.(string)
+	}
+	return functions
+}
+
+// merge groups the definitions by key, in order of first appearance, and
+// returns the one kept for each key. The other definitions differing from
+// it are reported as conflicts, along with their differences.
+func (m *Merger) merge(kind string, defs []definition, diff func(a, b interface{}) []string) ([]definition, []entity.W32Conflict) {
+
+	groups := make(map[string][]definition)
+	var keys []string
+	for _, d := range defs {
+		if _, ok := groups[d.key]; !ok {
+			keys = append(keys, d.key)
+		}
+		groups[d.key] = append(groups[d.key], d)
+	}
+
+	kept := make([]definition, 0, len(keys))
+	var conflicts []entity.W32Conflict
+	for _, key := range keys {
+		group := groups[key]
+		pick := group[m.pick(group)]
+		kept = append(kept, pick)
+		for _, d := range group {
+			if d.unit == pick.unit || reflect.DeepEqual(d.value, pick.value) {
+				continue
+			}
+			conflicts = append(conflicts, entity.W32Conflict{
+				Kind:    kind,
+				Key:     key,
+				Kept:    m.sourceName(pick.unit),
+				Dropped: m.sourceName(d.unit),
+				Details: diff(pick.value, d.value),
+			})
+		}
+	}
+	return kept, conflicts
+}
+
+// pick returns the index of the definition kept among the ones of a key.
+func (m *Merger) pick(group []definition) int {
+	if len(group) == 1 {
+		return 0
+	}
+	for _, r := range m.Rules {
+		if !r.matches(group) {
+			continue
+		}
+		unit := m.source(r.Source)
+		for i, d := range group {
+			if d.unit == unit {
+				return i
+			}
+		}
+	}
+	if m.Precedence == PrecedenceLast {
+		return len(group) - 1
+	}
+	return 0
+}
+
+// matches reports whether a rule matches one of the definitions of a key.
+func (r MergeRule) matches(group []definition) bool {
+	for _, d := range group {
+		if match(r.Name, d.name) &&
+			match(strings.ToLower(r.Header), strings.ToLower(d.header)) &&
+			match(strings.ToLower(r.DLL), strings.ToLower(d.dll)) {
+			return true
+		}
+	}
+	return false
+}
+
+func match(pattern, name string) bool {
+	if pattern == "" {
+		return true
+	}
+	ok, _ := path.Match(pattern, name)
+	return ok
+}
+
+// source returns the index of a translation unit, or -1.
+func (m *Merger) source(name string) int {
+	for i, source := range m.Sources {
+		if filepath.Clean(source) == filepath.Clean(name) {
+			return i
+		}
+	}
+	return -1
+}
+
+func (m *Merger) sourceName(unit int) string {
+	if unit < len(m.Sources) {
+		return m.Sources[unit]
+	}
+	return fmt.Sprintf("#%d", unit+1)
+}
+
+// fieldChanges lists the JSON fields of two entities that differ.
+func fieldChanges(a, b interface{}) []string {
+	var fa, fb map[string]json.RawMessage
+	ja, _ := json.Marshal(a)
+	jb, _ := json.Marshal(b)
+	json.Unmarshal(ja, &fa)
+	json.Unmarshal(jb, &fb)
+
+	names := make(map[string]bool)
+	for name := range fa {
+		names[name] = true
+	}
+	for name := range fb {
+		names[name] = true
+	}
+	var details []string
+	for name := range names {
+		if string(fa[name]) != string(fb[name]) {
+			details = append(details, fmt.Sprintf("%s changed from %s to %s", name, orNone(fa[name]), orNone(fb[name])))
+		}
+	}
+	sort.Strings(details)
+	return details
+}
+
+func orNone(v json.RawMessage) string {
+	if len(v) == 0 {
+		return "none"
+	}
+	return string(v)
+}
+
+func sortedKeys(m interface{}) []string {
+	keys := reflect.ValueOf(m).MapKeys()
+	names := make([]string, 0, len(keys))
+	for _, k := range keys {
+		names = append(names, k.String())
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,292 @@
+// Copyright 2018 Saferwall. All rights reserved.
+// Use of this source code is governed by Apache v2 license
+// license that can be found in the LICENSE file.
+
+package analysis
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/saferwall/winsdk2json/internal/entity"
+	"github.com/saferwall/winsdk2json/internal/utils"
+)
+
+// dataVoid is the kind of the void type, it never ends up in the output.
+const dataVoid uint8 = 0xff
+
+var (
+	reAnnotationIn = regexp.MustCompile(`(?i)_In_|IN|_In_opt[\w]+|In_reads[\w()]+|_Frees_ptr_opt_`)
+	// __out_data_source
+	reAnnotationOut      = regexp.MustCompile(`(?i)_Out_|OUT|_Out_opt[\w]+|_Out_writes[\w()]+|_Outptr_`)
+	reAnnotationIntOut   = regexp.MustCompile(`(?i)_Inout[\w]+`)
+	reAnnotationReserved = regexp.MustCompile(`(?i)Reserved`)
+
+	// _Out_writes_bytes_to_(nSize,*lpNumberOfBytesRead) gives the count.
+	reAnnoSizeCount = regexp.MustCompile(`\w+\((?P<s>[*\w]+),\s*(?P<c>[*\w]+)\)`)
+	// _In_reads_bytes_opt_(dwOptionalLength) gives the size.
+	reAnnoSize = regexp.MustCompile(`_(?:In_reads|Out_writes|Inout_updates)\w*\((?P<s>[*\w]+)\)`)
+	// _Out_writes_bytes_(sizeof(WIN32_FIND_DATAA))
+	reAnnoSizeOf = regexp.MustCompile(`\(sizeof\((?P<s>\w+)\)\)`)
+
+	// Sizes of the C scalar types on Windows.
+	scalarSizes = map[string]uint8{
+		"_Bool": 1, "char": 1, "signed char": 1, "unsigned char": 1,
+		"short": 2, "unsigned short": 2, "wchar_t": 2,
+		"int": 4, "unsigned": 4, "unsigned int": 4, "long": 4, "unsigned long": 4, "float": 4,
+		"long long": 8, "unsigned long long": 8, "double": 8, "long double": 8,
+	}
+
+	// Pointer sized types logged as pointers whatever the architecture.
+	ptrSizedTypes = []string{"HANDLE", "ULONG_PTR", "LONG_PTR"}
+
+	// Untyped buffers, their size may be given by another parameter.
+	voidPtrTypes = []string{"LPVOID", "PVOID", "LPCVOID", "PCVOID", "void*", "VOID*"}
+)
+
+// dataType is the kind of a type along with the size of the scalar it holds
+// or points to.
+type dataType struct {
+	kind uint8
+	size uint8
+	base string // Scalar type the type resolves to, or handle for DECLARE_HANDLE structures.
+}
+
+// DataKind tells how a hook handler logs a value of a type: a scalar, a
+// string, a structure ... along with the size of the scalar it holds or points
+// to. Typedefs are resolved through the types table, unknown types are taken
+// as structures.
+func DataKind(t string, types map[string]entity.W32Type) (uint8, uint8) {
+	dt := classifyType(t, types, 0)
+	if dt.kind == dataVoid {
+		return entity.DataScalar, 0
+	}
+	return dt.kind, dt.size
+}
+
+func classifyType(t string, types map[string]entity.W32Type, depth int) dataType {
+
+	t = normalizeType(t)
+	if depth > 16 {
+		return dataType{kind: entity.DataStruct}
+	}
+
+	// Arrays are logged like pointers.
+	if i := strings.Index(t, "["); i >= 0 {
+		t = strings.TrimSpace(t[:i]) + "*"
+	}
+
+	if strings.HasSuffix(t, "*") {
+		elem := strings.TrimSpace(strings.TrimSuffix(t, "*"))
+		if elem == "BYTE" {
+			return dataType{kind: entity.DataBytePtr}
+		}
+		e := classifyType(elem, types, depth+1)
+		switch e.kind {
+		case dataVoid:
+			return dataType{kind: entity.DataVoidPtr}
+		case entity.DataScalar:
+			// The null terminated annotation of LPSTR and LPWSTR does not
+			// survive the translation, character pointers are strings.
+			switch e.base {
+			case "char", "signed char":
+				return dataType{kind: entity.DataASCIIStr}
+			case "wchar_t":
+				return dataType{kind: entity.DataWideStr}
+			}
+			return dataType{kind: entity.DataPtrScalar, size: e.size}
+		case entity.DataASCIIStr:
+			return dataType{kind: entity.DataArrASCIIStr}
+		case entity.DataWideStr:
+			return dataType{kind: entity.DataArrWideStr}
+		case entity.DataStruct:
+			if e.base == "handle" {
+				return dataType{kind: entity.DataVoidPtr}
+			}
+			return e
+		}
+		return dataType{kind: entity.DataPtrScalar}
+	}
+
+	switch {
+	case t == "void" || t == "VOID":
+		return dataType{kind: dataVoid}
+	case utils.StringInSlice(t, ptrSizedTypes):
+		return dataType{kind: entity.DataVoidPtr}
+	}
+	if size, ok := scalarSizes[t]; ok {
+		return dataType{kind: entity.DataScalar, size: size, base: t}
+	}
+
+	def, ok := types[t]
+	if !ok {
+		return dataType{kind: entity.DataStruct}
+	}
+	switch def.Kind {
+	case entity.TypeKindTypedef:
+		if def.Target == "" {
+			return dataType{kind: entity.DataStruct}
+		}
+		return classifyType(def.Target, types, depth+1)
+	case entity.TypeKindEnum:
+		return dataType{kind: entity.DataScalar, size: 4}
+	case entity.TypeKindFunc:
+		return dataType{kind: entity.DataVoidPtr}
+	}
+	// DECLARE_HANDLE(HKEY) declares struct HKEY__ and a pointer to it.
+	if strings.HasSuffix(t, "__") {
+		return dataType{kind: entity.DataStruct, base: "handle"}
+	}
+	return dataType{kind: entity.DataStruct}
+}
+
+// normalizeType removes the qualifiers that do not change how a value is
+// logged: CONST LPSTR gives LPSTR, const char * gives char*.
+func normalizeType(t string) string {
+	t = strings.NewReplacer("CONST ", " ", "const ", " ", "volatile ", " ", " FAR", " ", " NEAR", " ").Replace(" " + t + " ")
+	t = strings.Join(strings.Fields(t), " ")
+	return strings.ReplaceAll(t, " *", "*")
+}
+
+// MinifyAPIs converts API definitions grouped by DLL into their minified
+// form consumed by the hook handlers: parameter directions, data kinds and
+// buffer sizes.
+func MinifyAPIs(apis map[string]map[string]entity.W32API, customHookAPIs []string,
+	types map[string]entity.W32Type) map[string]map[string]entity.W32APIMini {
+
+	mapis := make(map[string]map[string]entity.W32APIMini)
+	for dllname, v := range apis {
+		if _, ok := mapis[dllname]; !ok {
+			mapis[dllname] = make(map[string]entity.W32APIMini)
+		}
+		for apiname, api := range v {
+			propertiesCount := 0
+			paramsMini := make([]entity.W32APIParamMini, 0)
+			for _, param := range api.Params {
+				parammini := entity.W32APIParamMini{Name: param.Name}
+				if reAnnotationIntOut.MatchString(param.Annotation) {
+					parammini.Annotation = entity.ParamInOut
+					propertiesCount += 2
+				} else if reAnnotationIn.MatchString(param.Annotation) {
+					parammini.Annotation = entity.ParamIn
+					propertiesCount++
+				} else if reAnnotationOut.MatchString(param.Annotation) {
+					parammini.Annotation = entity.ParamOut
+					propertiesCount++
+				} else if reAnnotationReserved.MatchString(param.Annotation) {
+					parammini.Annotation = entity.ParamReserved
+					propertiesCount++
+				} else {
+					// If we don't know, take it as in:
+					parammini.Annotation = entity.ParamIn
+				}
+
+				kind, size := DataKind(param.Type, types)
+				parammini.Type = kind
+				parammini.BufferSizeOrIndex = bufferSizeOrIndex(api, param, size, &parammini, types)
+				paramsMini = append(paramsMini, parammini)
+			}
+
+			mapis[dllname][apiname] = entity.W32APIMini{
+				ReturnValueType: strings.EqualFold(api.RetType, "void"),
+				PropertyCount:   propertiesCount,
+				CustomHook:      utils.StringInSlice(apiname, customHookAPIs),
+				Params:          paramsMini,
+			}
+		}
+	}
+	return mapis
+}
+
+// bufferSizeOrIndex returns the index of the parameter holding the size of a
+// byte buffer, or the size of the data otherwise. Untyped buffers whose size
+// is given by another parameter are logged as byte buffers.
+func bufferSizeOrIndex(api entity.W32API, param entity.W32APIParam, size uint8,
+	parammini *entity.W32APIParamMini, types map[string]entity.W32Type) uint8 {
+
+	switch {
+	case parammini.Type == entity.DataBytePtr:
+		return paramIndex(api, sizeParamName(param.Annotation))
+	case utils.StringInSlice(normalizeType(param.Type), voidPtrTypes):
+		if name := sizeParamName(param.Annotation); name != "" {
+			parammini.Type = entity.DataBytePtr
+			return paramIndex(api, name)
+		}
+		// The size is not to be found in another parameter:
+		// _Out_writes_bytes_(sizeof(WIN32_FIND_DATAA)).
+		if m := reAnnoSizeOf.FindStringSubmatch(param.Annotation); m != nil {
+			return uint8(types[m[1]].Size)
+		}
+		return 0
+	}
+	return size
+}
+
+// sizeParamName returns the name of the parameter holding the size of a
+// buffer from its annotation: _Out_writes_bytes_opt_(nNumberOfBytesToRead).
+func sizeParamName(anno string) string {
+	if m := reAnnoSizeCount.FindStringSubmatch(anno); m != nil {
+		return strings.TrimPrefix(m[2], "*")
+	}
+	if m := reAnnoSize.FindStringSubmatch(anno); m != nil && !strings.HasPrefix(m[1], "sizeof") {
+		return strings.TrimPrefix(m[1], "*")
+	}
+	return ""
+}
+
+func paramIndex(api entity.W32API, name string) uint8 {
+	for i, param := range api.Params {
+		if param.Name == name {
+			return uint8(i)
+		}
+	}
+	return 0
+}
+
+// MinifyStructs describes the layout of structures and unions on both x86 and
+// x64. Members of nested definitions are flattened, structures missing from
+// one of the architectures are left out.
+func MinifyStructs(names []string, x86, x64 map[string]entity.W32Type) []entity.W32StructMini {
+
+	sorted := append([]string(nil), names...)
+	sort.Strings(sorted)
+
+	var structs []entity.W32StructMini
+	for _, name := range sorted {
+		def64, ok := x64[name]
+		if !ok || (def64.Kind != entity.TypeKindStruct && def64.Kind != entity.TypeKindUnion) {
+			continue
+		}
+		def86, ok := x86[name]
+		if !ok {
+			continue
+		}
+
+		members86 := make(map[string]entity.W32TypeMember)
+		for _, m := range FlattenMembers(def86.Members) {
+			members86[m.Name] = m
+		}
+
+		mini := entity.W32StructMini{
+			Name:    name,
+			X86Size: uint32(def86.Size),
+			X64Size: uint32(def64.Size),
+			Members: make([]entity.W32StructMemberMini, 0),
+		}
+		for _, m := range FlattenMembers(def64.Members) {
+			kind, _ := DataKind(m.Type, x64)
+			m86 := members86[m.Name]
+			mini.Members = append(mini.Members, entity.W32StructMemberMini{
+				Name:      m.Name,
+				X86Offset: uint32(m86.Offset),
+				X86Size:   uint32(m86.Size),
+				X64Offset: uint32(m.Offset),
+				X64Size:   uint32(m.Size),
+				Type:      kind,
+			})
+		}
+		structs = append(structs, mini)
+	}
+	return structs
+}
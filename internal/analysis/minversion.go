@@ -0,0 +1,191 @@
+// Copyright 2018 Saferwall. All rights reserved.
+// Use of this source code is governed by Apache v2 license
+// license that can be found in the LICENSE file.
+
+package analysis
+
+import (
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/saferwall/winsdk2json/internal/entity"
+)
+
+var (
+	// NTDDIVersions maps the sdkddkver.h version names to their NTDDI_VERSION
+	// value.
+	NTDDIVersions = map[string]uint32{
+		"WIN2K":      0x05000000,
+		"WINXP":      0x05010000,
+		"WS03":       0x05020000,
+		"VISTA":      0x06000000,
+		"WIN7":       0x06010000,
+		"WIN8":       0x06020000,
+		"WINBLUE":    0x06030000,
+		"WIN10":      0x0A000000,
+		"WIN10_TH2":  0x0A000001,
+		"WIN10_RS1":  0x0A000002,
+		"WIN10_RS2":  0x0A000003,
+		"WIN10_RS3":  0x0A000004,
+		"WIN10_RS4":  0x0A000005,
+		"WIN10_RS5":  0x0A000006,
+		"WIN10_19H1": 0x0A000007,
+		"WIN10_VB":   0x0A000008,
+		"WIN10_MN":   0x0A000009,
+		"WIN10_FE":   0x0A00000A,
+		"WIN10_CO":   0x0A00000B,
+		"WIN10_NI":   0x0A00000C,
+	}
+
+	// Windows 10 feature updates as spelled by the sdk-api docs. 1909 and
+	// the releases following 2004 are enablement packages, they share the
+	// NTDDI_VERSION of 1903 and 2004 (NTDDI_WIN10_VB).
+	win10Releases = map[string]uint32{
+		"1507": 0x0A000000, "1511": 0x0A000001, "1607": 0x0A000002,
+		"1703": 0x0A000003, "1709": 0x0A000004, "1803": 0x0A000005,
+		"1809": 0x0A000006, "1903": 0x0A000007, "1909": 0x0A000007,
+		"2004": 0x0A000008, "20H2": 0x0A000008, "21H1": 0x0A000008,
+		"21H2": 0x0A000008, "22H2": 0x0A000008,
+	}
+
+	// Minimum client in the sdk-api docs: Windows 10, version 1809 [desktop apps only]
+	reMinClient = regexp.MustCompile(`Windows (2000|XP|Vista|7|8\.1|8|10|11)\b(?:,? version (\w+))?`)
+
+	minClients = map[string]uint32{
+		"2000": 0x05000000, "XP": 0x05010000, "Vista": 0x06000000, "7": 0x06010000,
+		"8": 0x06020000, "8.1": 0x06030000, "10": 0x0A000000, "11": 0x0A00000B,
+	}
+)
+
+// VersionPass holds the definitions visible when the headers target one
+// Windows version.
+type VersionPass struct {
+	Name      string                    // Version name, i.e WIN7.
+	NTDDI     uint32                    // NTDDI_VERSION of the pass.
+	Functions map[string]string         // Declared functions, mapped to their header.
+	Types     map[string]entity.W32Type // Declared types.
+}
+
+// ParseNTDDI returns the NTDDI_VERSION of a version name like WIN10_RS5 or
+// NTDDI_WIN7, or of a number like 0x0A000006.
+func ParseNTDDI(version string) (uint32, bool) {
+	if v, ok := NTDDIVersions[strings.TrimPrefix(strings.ToUpper(version), "NTDDI_")]; ok {
+		return v, true
+	}
+	v, err := strconv.ParseUint(version, 0, 32)
+	return uint32(v), err == nil
+}
+
+// DocumentedNTDDI returns the NTDDI_VERSION of the minimum client found in
+// the sdk-api docs, i.e: Windows 10, version 1809 [desktop apps only].
+func DocumentedNTDDI(minClient string) (uint32, bool) {
+	m := reMinClient.FindStringSubmatch(minClient)
+	if m == nil {
+		return 0, false
+	}
+	if m[1] == "10" && m[2] != "" {
+		if v, ok := win10Releases[strings.ToUpper(m[2])]; ok {
+			return v, true
+		}
+	}
+	return minClients[m[1]], true
+}
+
+// BuildMinVersions diffs the passes to find the oldest version declaring
+// each API, type, structure member and enumeration value. Passes are
+// expected oldest first.
+func BuildMinVersions(passes []VersionPass) entity.W32MinVersions {
+
+	var mv entity.W32MinVersions
+	apis := make(map[string]entity.W32MinVersion)
+	types := make(map[string]entity.W32MinVersion)
+	members := make(map[string]entity.W32MinVersion)
+	values := make(map[string]entity.W32MinVersion)
+	parents := make(map[string]string) // Parent type of the members and values.
+
+	for _, pass := range passes {
+		mv.Versions = append(mv.Versions, pass.Name)
+
+		for name, header := range pass.Functions {
+			if _, ok := apis[name]; !ok {
+				apis[name] = entity.W32MinVersion{Name: name, Header: header, Version: pass.Name}
+			}
+		}
+
+		for name, t := range pass.Types {
+			if _, ok := types[name]; !ok {
+				types[name] = entity.W32MinVersion{Name: name, Header: t.Header, Version: pass.Name}
+			}
+			for _, m := range FlattenMembers(t.Members) {
+				key := name + "." + m.Name
+				if _, ok := members[key]; !ok {
+					members[key] = entity.W32MinVersion{Name: key, Header: t.Header, Version: pass.Name}
+					parents[key] = name
+				}
+			}
+			for _, v := range t.Values {
+				if _, ok := values[v.Name]; !ok {
+					values[v.Name] = entity.W32MinVersion{Name: v.Name, Header: t.Header, Version: pass.Name}
+					parents[v.Name] = name
+				}
+			}
+		}
+	}
+
+	mv.APIs = sortedMinVersions(apis, nil)
+	mv.Types = sortedMinVersions(types, nil)
+
+	// Only keep the members and values newer than their parent type.
+	newer := func(m entity.W32MinVersion) bool {
+		return m.Version != types[parents[m.Name]].Version
+	}
+	mv.Members = sortedMinVersions(members, newer)
+	mv.Values = sortedMinVersions(values, newer)
+	return mv
+}
+
+// CrossCheckMinVersions records the minimum client documented for each API
+// and flags the ones whose documented version falls on another pass than
+// the computed one. Documented versions older than the first pass fall on
+// the first pass.
+func CrossCheckMinVersions(mv *entity.W32MinVersions, passes []VersionPass, documented map[string]string) {
+
+	rank := make(map[string]int)
+	for i, pass := range passes {
+		rank[pass.Name] = i
+	}
+	docRank := func(v uint32) int {
+		r := 0
+		for i, pass := range passes {
+			if pass.NTDDI <= v {
+				r = i
+			}
+		}
+		return r
+	}
+
+	for i := range mv.APIs {
+		api := &mv.APIs[i]
+		doc, ok := documented[api.Name]
+		if !ok || doc == "" {
+			continue
+		}
+		api.Documented = doc
+		if v, ok := DocumentedNTDDI(doc); ok {
+			api.Mismatch = docRank(v) != rank[api.Version]
+		}
+	}
+}
+
+func sortedMinVersions(m map[string]entity.W32MinVersion, keep func(entity.W32MinVersion) bool) []entity.W32MinVersion {
+	var list []entity.W32MinVersion
+	for _, v := range m {
+		if keep == nil || keep(v) {
+			list = append(list, v)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
@@ -0,0 +1,70 @@
+// Copyright 2018 Saferwall. All rights reserved.
+// Use of this source code is governed by Apache v2 license
+// license that can be found in the LICENSE file.
+
+package analysis
+
+import (
+	"strings"
+
+	"github.com/saferwall/winsdk2json/internal/entity"
+)
+
+var (
+	// nativePrefixes maps the prefix of the functions declared by the phnt
+	// headers to the image exporting them. Longer prefixes come first.
+	nativePrefixes = []struct {
+		prefix string
+		dll    string
+	}{
+		{"NtUser", "win32u.dll"},
+		{"NtGdi", "win32u.dll"},
+		{"NtDxgk", "win32u.dll"},
+		{"Nt", "ntdll.dll"},
+		{"Zw", "ntdll.dll"},
+		{"Rtl", "ntdll.dll"},
+		{"Ldr", "ntdll.dll"},
+		{"Dbg", "ntdll.dll"},
+		{"Csr", "ntdll.dll"},
+		{"Etw", "ntdll.dll"},
+		{"Tp", "ntdll.dll"},
+		{"Pss", "ntdll.dll"},
+		{"Samp", "samlib.dll"},
+		{"Sam", "samlib.dll"},
+		{"WinStation", "winsta.dll"},
+	}
+)
+
+// NativeDLL returns the image exporting a function declared by the phnt
+// headers, or an empty string when its prefix is not known.
+func NativeDLL(name string) string {
+	for _, p := range nativePrefixes {
+		if len(name) > len(p.prefix) && strings.HasPrefix(name, p.prefix) {
+			// Guard against words starting with the prefix: Ntohs, Tpm...
+			if c := name[len(p.prefix)]; c < 'A' || c > 'Z' {
+				continue
+			}
+			return p.dll
+		}
+	}
+	return ""
+}
+
+// LinkNativeAliases links every Zw function to its Nt counterpart, both are
+// exported by ntdll and share the same system service stub in user mode.
+func LinkNativeAliases(apis []entity.W32API) {
+	nt := make(map[string]bool)
+	for _, api := range apis {
+		if strings.HasPrefix(api.Name, "Nt") {
+			nt[api.Name] = true
+		}
+	}
+	for i, api := range apis {
+		if !strings.HasPrefix(api.Name, "Zw") {
+			continue
+		}
+		if alias := "Nt" + api.Name[2:]; nt[alias] {
+			apis[i].Alias = alias
+		}
+	}
+}
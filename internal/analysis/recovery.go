@@ -0,0 +1,286 @@
+// Copyright 2018 Saferwall. All rights reserved.
+// Use of this source code is governed by Apache v2 license
+// license that can be found in the LICENSE file.
+
+package analysis
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	// The braces of a definition: struct _M128A { ... }.
+	reTagKeyword = regexp.MustCompile(`\b(struct|union|enum|class)\b`)
+	// The braces of a C++ linkage block, they do not enclose a declaration.
+	reExternC = regexp.MustCompile(`^extern\s*"C(\+\+)?"$`)
+)
+
+// CCError is an error reported by cc.
+type CCError struct {
+	// The position of the error, the file is empty when it has none.
+	File   string
+	Line   int
+	Column int
+	Msg    string
+	// The lines following the error without a position.
+	Notes []string
+}
+
+// ParseCCErrors splits the errors cc reports, one per line in the
+// file:line:col: message form. The lines without a position are attached to
+// the error before them.
+func ParseCCErrors(err error) []CCError {
+
+	var errs []CCError
+	for _, line := range strings.Split(err.Error(), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		var prefix string
+		s := line
+		if len(s) > 1 && s[1] == ':' {
+			// C:\Program Files (x86)\Windows Kits\10\Include\...
+			prefix, s = s[:2], s[2:]
+		}
+		parts := strings.SplitN(s, ":", 4)
+		if len(parts) == 4 {
+			lineNum, lerr := strconv.Atoi(parts[1])
+			col, cerr := strconv.Atoi(parts[2])
+			if lerr == nil && cerr == nil {
+				errs = append(errs, CCError{
+					File:   prefix + parts[0],
+					Line:   lineNum,
+					Column: col,
+					Msg:    strings.TrimSpace(parts[3]),
+				})
+				continue
+			}
+		}
+
+		if len(errs) == 0 {
+			errs = append(errs, CCError{Msg: line})
+		} else {
+			errs[len(errs)-1].Notes = append(errs[len(errs)-1].Notes, line)
+		}
+	}
+	return errs
+}
+
+// DeclarationExtent returns the first and last lines of the top level
+// declaration of a header holding a line. It reports false when the line
+// is outside any declaration: in a comment or a preprocessor directive.
+//
+// The header is not preprocessed, a declaration ends with a semicolon, or a
+// closing brace for a function definition, outside any parentheses or
+// braces. The braces of the extern "C" blocks are ignored.
+func DeclarationExtent(src []byte, line int) (int, int, bool) {
+
+	var decls [][2]int
+	var braces []byte
+	var sig []byte
+	var start, depth, opaque, last int
+	var lastSig byte
+
+	end := func(ln int) {
+		decls = append(decls, [2]int{start, ln})
+		start, sig, lastSig = 0, sig[:0], 0
+	}
+	scanHeader(src, func(offset, ln int, literal bool) {
+		last = ln
+		c := src[offset]
+		if isBlank(c) {
+			if len(sig) > 0 && sig[len(sig)-1] != ' ' {
+				sig = append(sig, ' ')
+			}
+			return
+		}
+		if start == 0 && c != '}' {
+			start = ln
+		}
+
+		switch {
+		case literal:
+		case c == '(' || c == '[':
+			depth++
+		case c == ')' || c == ']':
+			if depth > 0 {
+				depth--
+			}
+		case c == '{':
+			top := depth == 0 && opaque == 0
+			switch {
+			case top && reExternC.MatchString(strings.TrimSpace(string(sig))):
+				braces = append(braces, 'x')
+				start, sig, lastSig = 0, sig[:0], 0
+				return
+			case top && lastSig == ')' && !reTagKeyword.Match(sig):
+				braces = append(braces, 'f')
+			default:
+				braces = append(braces, 's')
+			}
+			opaque++
+		case c == '}':
+			if len(braces) == 0 {
+				return
+			}
+			kind := braces[len(braces)-1]
+			braces = braces[:len(braces)-1]
+			if kind == 'x' {
+				return
+			}
+			opaque--
+			if kind == 'f' && opaque == 0 && depth == 0 && start != 0 {
+				end(ln)
+				return
+			}
+		case c == ';':
+			if depth == 0 && opaque == 0 {
+				end(ln)
+				return
+			}
+		}
+		sig = append(sig, c)
+		lastSig = c
+	})
+	if start != 0 {
+		end(last)
+	}
+
+	for _, d := range decls {
+		if d[0] <= line && line <= d[1] {
+			return d[0], d[1], true
+		}
+	}
+	return 0, 0, false
+}
+
+// BlankLines returns a copy of a header with the code of a range of lines
+// replaced by spaces. The comments, the preprocessor directives and the
+// line breaks are kept, the positions of the rest of the header are
+// unchanged.
+func BlankLines(src []byte, first, last int) []byte {
+	out := make([]byte, len(src))
+	copy(out, src)
+	scanHeader(src, func(offset, ln int, literal bool) {
+		if ln >= first && ln <= last && !isBlank(src[offset]) {
+			out[offset] = ' '
+		}
+	})
+	return out
+}
+
+// DeclarationText returns the code of a range of lines of a header, without
+// the comments and directives, on a single line.
+func DeclarationText(src []byte, first, last int) string {
+	var b strings.Builder
+	scanHeader(src, func(offset, ln int, literal bool) {
+		if ln < first || ln > last {
+			return
+		}
+		c := src[offset]
+		if isBlank(c) && !literal {
+			c = ' '
+		}
+		if c == ' ' && (b.Len() == 0 || strings.HasSuffix(b.String(), " ")) {
+			return
+		}
+		b.WriteByte(c)
+	})
+	return strings.TrimSpace(b.String())
+}
+
+// scanHeader calls visit for each byte of code of a header, along with its
+// line number, skipping the comments and the preprocessor directives. The
+// bytes of the string and character literals are flagged.
+func scanHeader(src []byte, visit func(offset, line int, literal bool)) {
+
+	const (
+		code = iota
+		lineComment
+		blockComment
+		literal
+		directive
+	)
+	state, resume := code, code
+	var quote byte
+	lineStart := true
+	line := 1
+
+	for i := 0; i < len(src); i++ {
+		c := src[i]
+		next := byte(0)
+		if i+1 < len(src) {
+			next = src[i+1]
+		}
+
+		switch state {
+		case code:
+			switch {
+			case c == '#' && lineStart:
+				state = directive
+			case c == '/' && next == '/':
+				state, resume = lineComment, code
+				i++
+			case c == '/' && next == '*':
+				state, resume = blockComment, code
+				i++
+			case c == '"' || c == '\'':
+				state, quote = literal, c
+				visit(i, line, true)
+			default:
+				visit(i, line, false)
+			}
+		case literal:
+			visit(i, line, true)
+			switch {
+			case c == '\\' && next != '\n' && next != 0:
+				i++
+				visit(i, line, true)
+			case c == quote || c == '\n':
+				state = code
+			}
+		case lineComment:
+			if c == '\n' {
+				state = resume
+				if resume == directive {
+					state = code
+				}
+			}
+		case blockComment:
+			if c == '*' && next == '/' {
+				state = resume
+				i++
+			}
+		case directive:
+			switch {
+			case c == '\\' && (next == '\n' || next == '\r'):
+				// The directive goes on, on the next line.
+			case c == '\n':
+				if i == 0 || src[i-1] != '\\' && !(src[i-1] == '\r' && i > 1 && src[i-2] == '\\') {
+					state = code
+				}
+			case c == '/' && next == '/':
+				state, resume = lineComment, directive
+				i++
+			case c == '/' && next == '*':
+				state, resume = blockComment, directive
+				i++
+			}
+		}
+
+		if c == '\n' {
+			line++
+			lineStart = true
+		} else if !isBlank(c) && state != blockComment {
+			lineStart = false
+		}
+	}
+}
+
+func isBlank(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r' || c == '\n' || c == '\f' || c == '\v'
+}
@@ -0,0 +1,190 @@
+// Copyright 2018 Saferwall. All rights reserved.
+// Use of this source code is governed by Apache v2 license
+// license that can be found in the LICENSE file.
+
+// Package analysis derives higher level knowledge from the parsed Win32 API
+// definitions.
+package analysis
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/saferwall/winsdk2json/internal/entity"
+	"github.com/saferwall/winsdk2json/internal/utils"
+)
+
+var (
+	// _Success_(return != FALSE), _Success_(return >= 0), ...
+	reSuccessAnno = regexp.MustCompile(`^return\s*(==|!=|<=|>=|<|>)\s*([\w()\-]+)$`)
+
+	// If the function fails, the return value is INVALID_HANDLE_VALUE.
+	reDocFailure = regexp.MustCompile(`(?i)if the function fails,? the return value is\s+(?:either\s+)?([\w()\-]+)`)
+
+	// If the function succeeds, the return value is ERROR_SUCCESS.
+	reDocSuccessErrCode = regexp.MustCompile(`(?i)if the function succeeds,? the return value is\s+(?:NO_ERROR|ERROR_SUCCESS)`)
+
+	// Strip html tags and markdown emphasis from docs.
+	reDocMarkup = regexp.MustCompile(`<[^>]+>|\*\*|__`)
+
+	// Symbolic values commonly found in annotations and docs.
+	knownRetValues = map[string]int64{
+		"0":                        0,
+		"zero":                     0,
+		"NULL":                     0,
+		"FALSE":                    0,
+		"S_OK":                     0,
+		"ERROR_SUCCESS":            0,
+		"NO_ERROR":                 0,
+		"STATUS_SUCCESS":           0,
+		"-1":                       -1,
+		"INVALID_HANDLE_VALUE":     -1,
+		"INVALID_SOCKET":           -1,
+		"SOCKET_ERROR":             -1,
+		"HFILE_ERROR":              -1,
+		"INVALID_FILE_SIZE":        0xFFFFFFFF,
+		"INVALID_FILE_ATTRIBUTES":  0xFFFFFFFF,
+		"INVALID_SET_FILE_POINTER": 0xFFFFFFFF,
+		"TLS_OUT_OF_INDEXES":       0xFFFFFFFF,
+		"WAIT_FAILED":              0xFFFFFFFF,
+		"0xFFFFFFFF":               0xFFFFFFFF,
+		"(DWORD)-1":                0xFFFFFFFF,
+	}
+
+	// Negation of the comparison operators.
+	negatedOps = map[string]string{
+		"==": "!=", "!=": "==", "<": ">=", ">=": "<", ">": "<=", "<=": ">",
+	}
+
+	boolTypes    = []string{"BOOL", "BOOLEAN", "WINBOOL", "bool", "_Bool"}
+	errCodeTypes = []string{"LSTATUS", "WIN32_ERROR", "errno_t"}
+	handleTypes  = []string{"HANDLE", "SOCKET"}
+)
+
+// ClassifyReturn derives the success/failure rule of an API from its return
+// type, its _Success_ annotation and the return value section of its sdk-api
+// docs. The docs may be empty.
+func ClassifyReturn(api entity.W32API, retDoc string) *entity.W32APIRetSemantics {
+
+	retType := strings.TrimSpace(strings.TrimPrefix(api.RetType, "const "))
+	retDoc = reDocMarkup.ReplaceAllString(retDoc, "")
+	rs := &entity.W32APIRetSemantics{Kind: entity.RetKindValue, Source: entity.RetSourceType}
+
+	switch {
+	case retType == "void" || retType == "VOID":
+		rs.Kind = entity.RetKindVoid
+		return rs
+	case retType == "HRESULT":
+		rs.Kind = entity.RetKindHRESULT
+		rs.Failure = &entity.W32APIRetCheck{Op: "<", Value: 0}
+		return rs
+	case retType == "NTSTATUS":
+		rs.Kind = entity.RetKindNTSTATUS
+		rs.Failure = &entity.W32APIRetCheck{Op: "<", Value: 0}
+		return rs
+	case utils.StringInSlice(retType, errCodeTypes) ||
+		(retDoc != "" && reDocSuccessErrCode.MatchString(retDoc)):
+		rs.Kind = entity.RetKindErrCode
+		rs.Failure = &entity.W32APIRetCheck{Op: "!=", Value: 0, Symbol: "ERROR_SUCCESS"}
+		if retDoc != "" && reDocSuccessErrCode.MatchString(retDoc) {
+			rs.Source = entity.RetSourceDoc
+		}
+	case utils.StringInSlice(retType, boolTypes):
+		rs.Kind = entity.RetKindBool
+		rs.Failure = &entity.W32APIRetCheck{Op: "==", Value: 0, Symbol: "FALSE"}
+	case utils.StringInSlice(retType, handleTypes):
+		rs.Kind = entity.RetKindHandle
+		rs.Failure = &entity.W32APIRetCheck{Op: "==", Value: 0, Symbol: "NULL"}
+		if retType == "SOCKET" {
+			rs.Failure = &entity.W32APIRetCheck{Op: "==", Value: -1, Symbol: "INVALID_SOCKET"}
+		}
+	case isPointerType(retType):
+		rs.Kind = entity.RetKindPointer
+		rs.Failure = &entity.W32APIRetCheck{Op: "==", Value: 0, Symbol: "NULL"}
+	}
+
+	// The _Success_ annotation describes the success condition, the failure
+	// condition is its negation.
+	if check := parseSuccessAnno(api.Success); check != nil {
+		rs.Failure = check
+		rs.Source = entity.RetSourceAnno
+	}
+
+	// The docs are the most precise source, i.e. whether a HANDLE is NULL or
+	// INVALID_HANDLE_VALUE on failure.
+	if retDoc != "" {
+		if check := parseFailureDoc(retDoc); check != nil {
+			rs.Failure = check
+			rs.Source = entity.RetSourceDoc
+		}
+		rs.SetsLastError = strings.Contains(retDoc, "GetLastError")
+	} else {
+		// Without docs, assume the common Win32 convention.
+		rs.SetsLastError = rs.Kind == entity.RetKindBool ||
+			rs.Kind == entity.RetKindHandle || rs.Kind == entity.RetKindPointer
+	}
+
+	return rs
+}
+
+// parseSuccessAnno converts a simple `return OP VALUE` _Success_ expression
+// into a failure check. Compound expressions are ignored.
+func parseSuccessAnno(anno string) *entity.W32APIRetCheck {
+	m := reSuccessAnno.FindStringSubmatch(strings.TrimSpace(anno))
+	if m == nil {
+		return nil
+	}
+	val, ok := retValue(m[2])
+	if !ok {
+		return nil
+	}
+	check := &entity.W32APIRetCheck{Op: negatedOps[m[1]], Value: val}
+	if _, err := strconv.ParseInt(m[2], 0, 64); err != nil {
+		check.Symbol = m[2]
+	}
+	return check
+}
+
+// parseFailureDoc looks for a `If the function fails, the return value is X`
+// sentence in the docs.
+func parseFailureDoc(doc string) *entity.W32APIRetCheck {
+	m := reDocFailure.FindStringSubmatch(doc)
+	if m == nil {
+		return nil
+	}
+	word := strings.TrimRight(m[1], ".,")
+	val, ok := retValue(word)
+	if !ok {
+		return nil
+	}
+	check := &entity.W32APIRetCheck{Op: "==", Value: val}
+	if _, err := strconv.ParseInt(word, 0, 64); err != nil && word != "zero" {
+		check.Symbol = word
+	}
+	return check
+}
+
+// retValue resolves a literal or a well-known symbolic return value.
+func retValue(s string) (int64, bool) {
+	if v, ok := knownRetValues[s]; ok {
+		return v, true
+	}
+	v, err := strconv.ParseInt(s, 0, 64)
+	return v, err == nil
+}
+
+// isPointerType reports whether a type name looks like a pointer or an opaque
+// handle: void*, LPVOID, PCSTR, HMODULE, HINTERNET ...
+func isPointerType(t string) bool {
+	if strings.HasSuffix(t, "*") {
+		return true
+	}
+	if len(t) > 1 && t[0] == 'H' && strings.ToUpper(t) == t {
+		return true
+	}
+	if strings.HasPrefix(t, "LP") || (strings.HasPrefix(t, "P") && strings.ToUpper(t) == t) {
+		return true
+	}
+	return false
+}
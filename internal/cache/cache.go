@@ -0,0 +1,197 @@
+// Copyright 2018 Saferwall. All rights reserved.
+// Use of this source code is governed by Apache v2 license
+// license that can be found in the LICENSE file.
+
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// Cache stores translated models on disk. An entry is keyed by the settings
+// of the translation, and remembers the files it was translated from along
+// with the hash of their content: it is only reused while none of them
+// changed, appeared or disappeared.
+type Cache struct {
+	dir string
+}
+
+// File is a file a cached model depends on.
+type File struct {
+	// The host path, as opened by the translation.
+	Name string `json:"name"`
+	// The SHA-256 of the content, empty when the file did not exist, like
+	// the include paths searched before the one holding a header.
+	Hash string `json:"hash"`
+}
+
+// entry is the content of a cache file.
+type entry struct {
+	Key   string          `json:"key"`
+	Files []File          `json:"files"`
+	Model json.RawMessage `json:"model"`
+}
+
+// Open opens the cache stored in a directory, it is created when missing.
+func Open(dir string) (*Cache, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &Cache{dir: dir}, nil
+}
+
+// Key returns the key of the settings of a translation.
+func Key(parts ...string) string {
+	h := sha256.New()
+	for _, part := range parts {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Load reads the model of a key into model, the files it depends on are
+// read from fsys. It reports false when there is no entry for the key or
+// when one of its files changed.
+func (c *Cache) Load(key string, fsys fs.FS, model interface{}) (bool, error) {
+
+	data, err := os.ReadFile(c.path(key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	// A corrupt or foreign entry is a miss, it is overwritten by the next
+	// store.
+	var e entry
+	if err := json.Unmarshal(data, &e); err != nil || e.Key != key {
+		return false, nil
+	}
+	for _, f := range e.Files {
+		if Hash(fsys, f.Name) != f.Hash {
+			return false, nil
+		}
+	}
+	if err := json.Unmarshal(e.Model, model); err != nil {
+		return false, nil
+	}
+	return true, nil
+}
+
+// Store writes the model of a key, along with the hashes of the files it
+// was translated from, read from fsys.
+func (c *Cache) Store(key string, fsys fs.FS, names []string, model interface{}) error {
+
+	marshaled, err := json.Marshal(model)
+	if err != nil {
+		return err
+	}
+	e := entry{Key: key, Model: marshaled, Files: make([]File, 0, len(names))}
+	for _, name := range names {
+		e.Files = append(e.Files, File{Name: name, Hash: Hash(fsys, name)})
+	}
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	// Write then rename, so concurrent runs never read a partial entry.
+	tmp, err := os.CreateTemp(c.dir, key+".*.tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), c.path(key))
+}
+
+func (c *Cache) path(key string) string {
+	return filepath.Join(c.dir, key+".json")
+}
+
+// Hash returns the SHA-256 of the content of a file, or an empty string
+// when it can not be read.
+func Hash(fsys fs.FS, name string) string {
+	data, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// HashFile returns the SHA-256 of the content of a host file.
+func HashFile(name string) (string, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Recorder records the names of the files a translation opens, found or
+// not.
+type Recorder struct {
+	mu    sync.Mutex
+	names map[string]bool
+}
+
+// recordingFS is a view of a filesystem recording the names opened.
+type recordingFS struct {
+	fs.FS
+	r *Recorder
+}
+
+// NewRecorder creates a recorder.
+func NewRecorder() *Recorder {
+	return &Recorder{names: make(map[string]bool)}
+}
+
+// Wrap returns a view of a filesystem recording the names opened through
+// it.
+func (r *Recorder) Wrap(fsys fs.FS) fs.FS {
+	return &recordingFS{FS: fsys, r: r}
+}
+
+// Add records a name read outside of the filesystem.
+func (r *Recorder) Add(name string) {
+	r.mu.Lock()
+	r.names[name] = true
+	r.mu.Unlock()
+}
+
+// Names returns the names recorded, sorted.
+func (r *Recorder) Names() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	names := make([]string, 0, len(r.names))
+	for name := range r.names {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (f *recordingFS) Open(name string) (fs.File, error) {
+	f.r.Add(name)
+	return f.FS.Open(name)
+}
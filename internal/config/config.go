@@ -0,0 +1,350 @@
+// Copyright 2018 Saferwall. All rights reserved.
+// Use of this source code is governed by Apache v2 license
+// license that can be found in the LICENSE file.
+
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/saferwall/winsdk2json/internal/analysis"
+	"github.com/saferwall/winsdk2json/internal/utils"
+	"gopkg.in/yaml.v3"
+)
+
+// Config describes the headers to translate and the files to produce.
+type Config struct {
+	// The Windows SDK headers.
+	SDK SDK `json:"sdk" yaml:"sdk"`
+	// The Native API headers of the System Informer project.
+	Phnt Phnt `json:"phnt" yaml:"phnt"`
+	// The platform and Windows version the headers are translated for.
+	Target Target `json:"target" yaml:"target"`
+	// Extra macros to predefine, either NAME or NAME=VALUE.
+	Macros []string `json:"macros" yaml:"macros"`
+	// The translation units, defaults to assets/header.h for the user
+	// profile and assets/header-km.h for the kernel one.
+	Sources []string `json:"sources" yaml:"sources"`
+	// The directories searched first by #include "...", the headers under
+	// assets include the shared SAL remapping this way.
+	IncludePaths []string `json:"include_paths" yaml:"include_paths"`
+	// How the definitions of several sources are merged.
+	Merge Merge `json:"merge" yaml:"merge"`
+	// A directory of YAML files patching the headers in memory.
+	Patches string `json:"patches" yaml:"patches"`
+	// Skip the declarations cc fails on instead of aborting, they are
+	// listed in the diagnostics output.
+	Resilient bool `json:"resilient" yaml:"resilient"`
+	// The number of translations running at once, the sources and the
+	// architecture passes are translated concurrently. Each one holds its
+	// AST in memory. Defaults to the number of CPUs.
+	Jobs int `json:"jobs" yaml:"jobs"`
+	// The on-disk cache of the translated model.
+	Cache Cache `json:"cache" yaml:"cache"`
+	// The APIs to hook.
+	Hooks Hooks `json:"hooks" yaml:"hooks"`
+	// The generated files.
+	Outputs Outputs `json:"outputs" yaml:"outputs"`
+}
+
+// SDK locates the Windows SDK headers.
+type SDK struct {
+	// The Windows Kits directory, its Include directory or the include
+	// directory of a single version, i.e: Include/10.0.22000.0.
+	Include string `json:"include" yaml:"include"`
+	// The SDK version, defaults to the newest one.
+	Version string `json:"version" yaml:"version"`
+	// The directory holding the MSVC toolsets, defaults to the SDK one.
+	MSVC string `json:"msvc" yaml:"msvc"`
+	// The MSVC toolset version, defaults to the newest one.
+	Toolset string `json:"toolset" yaml:"toolset"`
+	// The sdk-api docs directory.
+	Docs string `json:"docs" yaml:"docs"`
+}
+
+// Phnt locates and configures the phnt headers.
+type Phnt struct {
+	Path    string `json:"path" yaml:"path"`
+	Version string `json:"version" yaml:"version"`
+	Mode    string `json:"mode" yaml:"mode"`
+}
+
+// Target is the platform the headers are translated for.
+type Target struct {
+	// The architecture: amd64, 386 or arm64.
+	Arch string `json:"arch" yaml:"arch"`
+	// The headers profile: user or kernel.
+	Profile string `json:"profile" yaml:"profile"`
+	// The NTDDI_VERSION, i.e: WIN10_RS5 or 0x0A000006.
+	NTDDIVersion string `json:"ntddi_version" yaml:"ntddi_version"`
+}
+
+// Merge tells which definition is kept when several sources define the same
+// API, type, callback, interface, GUID or control code.
+type Merge struct {
+	// first or last: the definition of the first or last source is kept.
+	Precedence string `json:"precedence" yaml:"precedence"`
+	// Rules overriding the precedence, the first matching one applies.
+	Rules []MergeRule `json:"rules" yaml:"rules"`
+}
+
+// MergeRule keeps the definition of a source for the entities matching the
+// name, header and DLL shell patterns, the empty ones match anything.
+type MergeRule struct {
+	Name   string `json:"name" yaml:"name"`
+	Header string `json:"header" yaml:"header"`
+	DLL    string `json:"dll" yaml:"dll"`
+	Source string `json:"source" yaml:"source"`
+}
+
+// Cache stores the translated model of each source, it is reused until the
+// headers, the settings or the tool change.
+type Cache struct {
+	// Defaults to winsdk2json under the user cache directory.
+	Dir      string `json:"dir" yaml:"dir"`
+	Disabled bool   `json:"disabled" yaml:"disabled"`
+}
+
+// Hooks lists the APIs to hook, one name per line.
+type Hooks struct {
+	APIs   string `json:"apis" yaml:"apis"`
+	Custom string `json:"custom" yaml:"custom"`
+}
+
+// Outputs names the generated files, relative names are placed under Dir.
+type Outputs struct {
+	Dir         string `json:"dir" yaml:"dir"`
+	APIs        string `json:"apis" yaml:"apis"`
+	Hooked      string `json:"hooked" yaml:"hooked"`
+	Lifetimes   string `json:"lifetimes" yaml:"lifetimes"`
+	Types       string `json:"types" yaml:"types"`
+	Callbacks   string `json:"callbacks" yaml:"callbacks"`
+	Interfaces  string `json:"interfaces" yaml:"interfaces"`
+	GUIDs       string `json:"guids" yaml:"guids"`
+	IOCTLs      string `json:"ioctls" yaml:"ioctls"`
+	UI          string `json:"ui" yaml:"ui"`
+	MiniAPIs    string `json:"mini_apis" yaml:"mini_apis"`
+	MiniStructs string `json:"mini_structs" yaml:"mini_structs"`
+	Kernel      string `json:"kernel" yaml:"kernel"`
+	Diagnostics string `json:"diagnostics" yaml:"diagnostics"`
+	Conflicts   string `json:"conflicts" yaml:"conflicts"`
+}
+
+// Default returns the configuration matching the command line defaults.
+func Default() *Config {
+	return &Config{
+		SDK: SDK{
+			Include: "./winsdk/10.0.22000.0",
+			Docs:    "./sdk-api",
+		},
+		Phnt: Phnt{
+			Path: "./phnt",
+			Mode: "user",
+		},
+		Target: Target{
+			Arch:    "amd64",
+			Profile: "user",
+		},
+		IncludePaths: []string{"assets"},
+		Merge: Merge{
+			Precedence: analysis.PrecedenceFirst,
+		},
+		Hooks: Hooks{
+			APIs:   "./assets/hookapis.md",
+			Custom: "./assets/custom_hook_apis.md",
+		},
+		Outputs: Outputs{
+			Dir:         "./assets",
+			APIs:        "w32apis-full.json",
+			Hooked:      "apis.json",
+			Lifetimes:   "lifetimes.json",
+			Types:       "types.json",
+			Callbacks:   "callbacks.json",
+			Interfaces:  "interfaces.json",
+			GUIDs:       "guids.json",
+			IOCTLs:      "ioctls.json",
+			UI:          "w32apis-ui.json",
+			MiniAPIs:    "mini-apis.json",
+			MiniStructs: "mini-structs.json",
+			Kernel:      "w32apis-km.json",
+			Diagnostics: "diagnostics.json",
+			Conflicts:   "conflicts.json",
+		},
+	}
+}
+
+// Load reads a YAML or JSON configuration file on top of the defaults.
+// Unknown keys are rejected, and the relative paths set by the file are
+// relative to its directory so the same file gives the same outputs
+// wherever the tool is run from. The defaults stay relative to the working
+// directory, like the command line ones.
+func Load(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// The file is decoded alone first to tell the paths it sets.
+	set := &Config{}
+	c := Default()
+	for _, v := range []*Config{set, c} {
+		if err := decode(path, data, v); err != nil {
+			return nil, fmt.Errorf("parsing %s failed: %v", path, err)
+		}
+	}
+
+	dir := filepath.Dir(path)
+	paths := func(c *Config) []*string {
+		return []*string{&c.SDK.Include, &c.SDK.MSVC, &c.SDK.Docs, &c.Phnt.Path, &c.Patches,
+			&c.Cache.Dir, &c.Hooks.APIs, &c.Hooks.Custom, &c.Outputs.Dir}
+	}
+	from, to := paths(set), paths(c)
+	for i := range from {
+		if *from[i] != "" {
+			*to[i] = rebase(dir, *from[i])
+		}
+	}
+	for i := range set.Sources {
+		c.Sources[i] = rebase(dir, set.Sources[i])
+	}
+	for i := range set.IncludePaths {
+		c.IncludePaths[i] = rebase(dir, set.IncludePaths[i])
+	}
+	for i := range set.Merge.Rules {
+		c.Merge.Rules[i].Source = rebase(dir, set.Merge.Rules[i].Source)
+	}
+	return c, nil
+}
+
+// decode reads a YAML or JSON configuration, rejecting the unknown keys.
+func decode(path string, data []byte, c *Config) error {
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		return dec.Decode(c)
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	return dec.Decode(c)
+}
+
+// Resolve fills in the settings defaulting to other ones, then validates
+// the configuration.
+func (c *Config) Resolve() error {
+	if len(c.Sources) == 0 {
+		if c.Target.Profile == "kernel" {
+			c.Sources = []string{filepath.Join("assets", "header-km.h")}
+		} else {
+			c.Sources = []string{filepath.Join("assets", "header.h")}
+		}
+	}
+	if c.Cache.Dir == "" && !c.Cache.Disabled {
+		dir, err := os.UserCacheDir()
+		if err != nil {
+			return fmt.Errorf("cache.dir is required: %v", err)
+		}
+		c.Cache.Dir = filepath.Join(dir, "winsdk2json")
+	}
+	return c.Validate()
+}
+
+// Validate checks the configuration is complete and consistent.
+func (c *Config) Validate() error {
+	if c.SDK.Include == "" {
+		return fmt.Errorf("sdk.include is required")
+	}
+	switch c.Target.Arch {
+	case "amd64", "386", "arm64":
+	default:
+		return fmt.Errorf("unsupported target.arch: %q", c.Target.Arch)
+	}
+	switch c.Target.Profile {
+	case "user", "kernel":
+	default:
+		return fmt.Errorf("unknown target.profile: %q", c.Target.Profile)
+	}
+	if c.Target.NTDDIVersion != "" {
+		if _, ok := analysis.ParseNTDDI(c.Target.NTDDIVersion); !ok {
+			return fmt.Errorf("unknown target.ntddi_version: %q", c.Target.NTDDIVersion)
+		}
+	}
+	switch strings.ToLower(c.Phnt.Mode) {
+	case "", "user", "kernel":
+	default:
+		return fmt.Errorf("unknown phnt.mode: %q", c.Phnt.Mode)
+	}
+	if len(c.Sources) == 0 {
+		return fmt.Errorf("no sources to translate")
+	}
+	for _, source := range c.Sources {
+		if source == "" {
+			return fmt.Errorf("sources contains an empty path")
+		}
+	}
+	if c.Jobs < 0 {
+		return fmt.Errorf("jobs must not be negative: %d", c.Jobs)
+	}
+	if err := c.Merger().Validate(); err != nil {
+		return err
+	}
+	if c.Target.Profile == "user" && c.Hooks.APIs == "" {
+		return fmt.Errorf("hooks.apis is required")
+	}
+	for _, macro := range c.Macros {
+		name := strings.SplitN(macro, "=", 2)[0]
+		if !isIdentifier(name) {
+			return fmt.Errorf("invalid macro name: %q", macro)
+		}
+	}
+	return nil
+}
+
+// Output returns the path of a generated file.
+func (c *Config) Output(name string) string {
+	if filepath.IsAbs(name) {
+		return name
+	}
+	return filepath.Join(c.Outputs.Dir, name)
+}
+
+// Merger returns the merger of the sources.
+func (c *Config) Merger() *analysis.Merger {
+	m := &analysis.Merger{Sources: c.Sources, Precedence: c.Merge.Precedence}
+	for _, r := range c.Merge.Rules {
+		m.Rules = append(m.Rules, analysis.MergeRule(r))
+	}
+	return m
+}
+
+// Predefined returns the #define directives of the extra macros.
+func (c *Config) Predefined() string {
+	return utils.Predefines(c.Macros)
+}
+
+func rebase(dir, path string) string {
+	if path == "" || filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(dir, path)
+}
+
+func isIdentifier(name string) bool {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return false
+	}
+	for i, r := range name {
+		switch {
+		case r == '_', r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z':
+		case r >= '0' && r <= '9' && i > 0:
+		default:
+			return false
+		}
+	}
+	return true
+}
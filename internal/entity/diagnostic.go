@@ -0,0 +1,27 @@
+// Copyright 2018 Saferwall. All rights reserved.
+// Use of this source code is governed by Apache v2 license
+// license that can be found in the LICENSE file.
+
+package entity
+
+// W32Diagnostic is an error cc reported while translating the headers, and
+// the declaration skipped to recover from it.
+type W32Diagnostic struct {
+	// The translation unit, or the unit and architecture of a types pass.
+	Unit    string      `json:"unit"`
+	Header  string      `json:"header"`
+	File    string      `json:"file"`
+	Line    int         `json:"line"`
+	Column  int         `json:"column"`
+	Error   string      `json:"error"`
+	Notes   []string    `json:"notes,omitempty"` // The errors following it without a position.
+	Skipped *W32Skipped `json:"skipped,omitempty"`
+}
+
+// W32Skipped is a declaration left out of the translation, the lines are
+// those of the header file.
+type W32Skipped struct {
+	FromLine int    `json:"from_line"`
+	ToLine   int    `json:"to_line"`
+	Text     string `json:"text"`
+}
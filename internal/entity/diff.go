@@ -0,0 +1,49 @@
+// Copyright 2018 Saferwall. All rights reserved.
+// Use of this source code is governed by Apache v2 license
+// license that can be found in the LICENSE file.
+
+package entity
+
+// Kinds of changes between two sets of definitions.
+const (
+	ChangeAdded   = "added"
+	ChangeRemoved = "removed"
+	ChangeChanged = "changed"
+	ChangeMoved   = "moved" // An API exported by another DLL.
+)
+
+// W32Change describes how an API or a type changed between two versions.
+type W32Change struct {
+	Name     string   `json:"name"`
+	Kind     string   `json:"kind"`               // added, removed, changed or moved.
+	Breaking bool     `json:"breaking,omitempty"` // Removal or change of the binary interface.
+	Details  []string `json:"details,omitempty"`  // What changed, i.e: parameter 2 renamed from lpName to lpFileName.
+}
+
+// W32Diff holds the changes between two versions of the definitions.
+type W32Diff struct {
+	From  string      `json:"from"`
+	To    string      `json:"to"`
+	APIs  []W32Change `json:"apis,omitempty"`
+	Types []W32Change `json:"types,omitempty"`
+}
+
+// Kinds of entities merged from several translation units.
+const (
+	ConflictAPI       = "api"
+	ConflictType      = "type"
+	ConflictCallback  = "callback"
+	ConflictInterface = "interface"
+	ConflictGUID      = "guid"
+	ConflictIOCTL     = "ioctl"
+)
+
+// W32Conflict describes an entity defined differently by two translation
+// units, and which definition was kept.
+type W32Conflict struct {
+	Kind    string   `json:"kind"`              // api, type, callback, interface, guid or ioctl.
+	Key     string   `json:"key"`               // The DLL and name of an API, i.e: kernel32.dll!CreateFileW, the name otherwise.
+	Kept    string   `json:"kept"`              // The translation unit whose definition was kept.
+	Dropped string   `json:"dropped"`           // The translation unit whose definition was dropped.
+	Details []string `json:"details,omitempty"` // How the dropped definition differs from the kept one.
+}
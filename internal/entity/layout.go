@@ -0,0 +1,28 @@
+// Copyright 2018 Saferwall. All rights reserved.
+// Use of this source code is governed by Apache v2 license
+// license that can be found in the LICENSE file.
+
+package entity
+
+// W32FieldLayout is the position of a structure member for one target.
+type W32FieldLayout struct {
+	Offset int64 `json:"offset"`
+	Size   int64 `json:"size"`
+}
+
+// W32MemberLayout tracks a structure member across targets.
+type W32MemberLayout struct {
+	Name    string                    `json:"name"`              // Member path, nested members are joined with dots.
+	Type    string                    `json:"type"`              // Member type.
+	Layouts map[string]W32FieldLayout `json:"layouts"`           // Keyed by target, i.e WIN10_22H2/amd64. Targets lacking the member are left out.
+	Changes []string                  `json:"changes,omitempty"` // Appearances, removals and moves between versions.
+}
+
+// W32StructLayout holds the layout of a structure for several Windows
+// versions and architectures.
+type W32StructLayout struct {
+	Name    string            `json:"name"`    // Name of the structure, i.e PEB.
+	Targets []string          `json:"targets"` // Targets in version order, grouped by architecture.
+	Sizes   map[string]int64  `json:"sizes"`   // Structure size per target.
+	Members []W32MemberLayout `json:"members"` // Members in declaration order.
+}
@@ -0,0 +1,21 @@
+// Copyright 2018 Saferwall. All rights reserved.
+// Use of this source code is governed by Apache v2 license
+// license that can be found in the LICENSE file.
+
+package entity
+
+// LifetimeProducer represents an API that creates a resource.
+type LifetimeProducer struct {
+	API        string   `json:"api"`                   // Name of the API.
+	Param      string   `json:"param,omitempty"`       // Out parameter receiving the handle, empty when it is returned.
+	ReleasedBy []string `json:"released_by,omitempty"` // APIs that release what this API produced.
+	Borrowed   bool     `json:"borrowed,omitempty"`    // The handle must not be released: pseudo handles, module handles ...
+}
+
+// Lifetime describes which APIs create, use and release a handle type.
+type Lifetime struct {
+	Type        string             `json:"type"`                  // Handle type: HANDLE, HKEY, HINTERNET, ...
+	Producers   []LifetimeProducer `json:"producers,omitempty"`   // APIs creating the handle.
+	Consumers   []string           `json:"consumers,omitempty"`   // APIs taking the handle as input.
+	Destructors []string           `json:"destructors,omitempty"` // APIs invalidating the handle.
+}
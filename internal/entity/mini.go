@@ -0,0 +1,63 @@
+// Copyright 2018 Saferwall. All rights reserved.
+// Use of this source code is governed by Apache v2 license
+// license that can be found in the LICENSE file.
+
+package entity
+
+// Directions of the parameters in the minified API definitions.
+const (
+	ParamIn uint8 = iota
+	ParamOut
+	ParamInOut
+	ParamReserved
+)
+
+// Kinds of data in the minified definitions, they tell the hook handlers how
+// to log a value.
+const (
+	DataScalar      uint8 = iota // Scalar types: int, long, DWORD, ...
+	DataPtrScalar                // Pointers to scalar types: int*, ...
+	DataASCIIStr                 // NULL terminated ascii string.
+	DataWideStr                  // NULL terminated wide string.
+	DataArrASCIIStr              // Array of null terminated ascii strings.
+	DataArrWideStr               // Array of null terminated wide strings.
+	DataStruct                   // Struct.
+	DataBytePtr                  // Byte pointer, size is known.
+	DataVoidPtr                  // Void*, not known to what it points to.
+)
+
+// W32APIParamMini represents a parameter of a minified API definition.
+type W32APIParamMini struct {
+	Annotation        uint8  `json:"anno"` // Direction: ParamIn, ParamOut ...
+	Type              uint8  `json:"type"` // Kind of data: DataScalar, DataWideStr ...
+	Name              string `json:"name"`
+	BufferSizeOrIndex uint8  `json:"buffsize_or_idx"` // Size of the data, or index of the parameter holding it for byte pointers.
+}
+
+// W32APIMini represents a minified API definition consumed by the hook
+// handlers of the sandbox.
+type W32APIMini struct {
+	ReturnValueType bool              `json:"retType"` // The API returns void.
+	PropertyCount   int               `json:"p_count"`
+	CustomHook      bool              `json:"custom"` // Uses a custom hook handler.
+	Params          []W32APIParamMini `json:"params"` // API Arguments.
+}
+
+// W32StructMemberMini represents a member of a minified structure or union.
+type W32StructMemberMini struct {
+	Name      string `json:"name"`
+	X86Offset uint32 `json:"x86off"`
+	X86Size   uint32 `json:"x86size"`
+	X64Offset uint32 `json:"x64off"`
+	X64Size   uint32 `json:"x64size"`
+	Type      uint8  `json:"type"` // Kind of data: DataScalar, DataWideStr ...
+}
+
+// W32StructMini represents the layout of a structure or a union on both x86
+// and x64.
+type W32StructMini struct {
+	Name    string                `json:"name"`
+	Members []W32StructMemberMini `json:"members"`
+	X86Size uint32                `json:"x86size"`
+	X64Size uint32                `json:"x64size"`
+}
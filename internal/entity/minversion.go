@@ -0,0 +1,26 @@
+// Copyright 2018 Saferwall. All rights reserved.
+// Use of this source code is governed by Apache v2 license
+// license that can be found in the LICENSE file.
+
+package entity
+
+// W32MinVersion is the oldest targeted Windows version declaring a
+// definition.
+type W32MinVersion struct {
+	Name       string `json:"name"`                 // API, type, Type.member or enumeration constant.
+	Header     string `json:"header,omitempty"`     // Header file declaring it.
+	Version    string `json:"version"`              // Oldest target declaring it, i.e WIN8.
+	Documented string `json:"documented,omitempty"` // Minimum client from the sdk-api docs.
+	Mismatch   bool   `json:"mismatch,omitempty"`   // The documented version falls on another target.
+}
+
+// W32MinVersions holds the minimum Windows version of the APIs, types,
+// structure members and enumeration values. Members and values are only
+// listed when they appear after their parent type.
+type W32MinVersions struct {
+	Versions []string        `json:"versions"` // Targets, oldest first.
+	APIs     []W32MinVersion `json:"apis"`
+	Types    []W32MinVersion `json:"types"`
+	Members  []W32MinVersion `json:"members,omitempty"`
+	Values   []W32MinVersion `json:"values,omitempty"`
+}
@@ -9,18 +9,85 @@ import "fmt"
 // W32APIParam represents a parameter of a Win32 API.
 type W32APIParam struct {
 	Annotation string `json:"anno,omitempty"`
+	Post       string `json:"post,omitempty"` // Post-condition annotation, i.e _Post_ptr_invalid_.
 	Type       string `json:"type"`
 	Name       string `json:"name"`
+	Callback   string `json:"callback,omitempty"` // Function pointer typedef the parameter is declared with.
+}
+
+// Return value kinds, they tell how the return value of an API should be
+// interpreted to decide whether the call succeeded or failed.
+const (
+	RetKindVoid     = "void"     // No return value.
+	RetKindBool     = "bool"     // BOOL, BOOLEAN: FALSE means failure.
+	RetKindHandle   = "handle"   // HANDLE, SOCKET: NULL or an invalid sentinel means failure.
+	RetKindPointer  = "pointer"  // Pointers and other handle types: NULL means failure.
+	RetKindHRESULT  = "hresult"  // HRESULT: negative values are failures.
+	RetKindNTSTATUS = "ntstatus" // NTSTATUS: negative values are failures.
+	RetKindErrCode  = "errcode"  // LSTATUS and other Win32 error codes: anything but ERROR_SUCCESS is a failure.
+	RetKindValue    = "value"    // Any other scalar, failure is only known from annotations or docs.
+)
+
+// Sources a return value semantics rule can be derived from.
+const (
+	RetSourceType = "type" // The return type alone.
+	RetSourceAnno = "anno" // The _Success_ SAL annotation.
+	RetSourceDoc  = "doc"  // The return value section of the sdk-api docs.
+)
+
+// W32APIRetCheck describes a comparison applied to the return value of an API.
+type W32APIRetCheck struct {
+	Op     string `json:"op"`               // Comparison operator: ==, !=, <, <=, >, >=.
+	Value  int64  `json:"value"`            // Value compared against.
+	Symbol string `json:"symbol,omitempty"` // Symbolic name of the value, i.e INVALID_HANDLE_VALUE.
+}
+
+// W32APIRetSemantics describes how to tell a successful call from a failed one.
+type W32APIRetSemantics struct {
+	Kind          string          `json:"kind"`              // One of the RetKind values.
+	Failure       *W32APIRetCheck `json:"failure,omitempty"` // Condition that holds when the call fails.
+	SetsLastError bool            `json:"last_error"`        // Whether a failure sets the thread last-error code.
+	Source        string          `json:"source"`            // What the rule was derived from.
 }
 
 // W32API represents information about a Win32 API.
 type W32API struct {
-	DLL               string        `json:"dll,omitempty"`  // DLL that exports the API.
-	Attribute         string        `json:"attr,omitempty"` // Microsoft-specific attribute.
-	CallingConvention string        `json:"cc,omitempty"`   // Calling Convention.
-	Name              string        `json:"name"`           // Name of the API.
-	RetType           string        `json:"ret_type"`       // Return value type.
-	Params            []W32APIParam `json:"params"`         // API Arguments.
+	DLL               string              `json:"dll,omitempty"`           // DLL that exports the API.
+	Header            string              `json:"header,omitempty"`        // Header file declaring the API.
+	Attribute         string              `json:"attr,omitempty"`          // Microsoft-specific attribute.
+	CallingConvention string              `json:"cc,omitempty"`            // Calling Convention.
+	Name              string              `json:"name"`                    // Name of the API.
+	Alias             string              `json:"alias,omitempty"`         // API this one is an alias of, i.e ZwClose gives NtClose.
+	RetType           string              `json:"ret_type"`                // Return value type.
+	Success           string              `json:"success,omitempty"`       // _Success_ annotation expression.
+	RetSemantics      *W32APIRetSemantics `json:"ret_semantics,omitempty"` // How to tell success from failure.
+	IRQL              *W32IRQL            `json:"irql,omitempty"`          // IRQL constraints of a kernel routine.
+	Params            []W32APIParam       `json:"params"`                  // API Arguments.
+}
+
+// Failed reports whether a return value means the call failed. It returns
+// false when the failure condition of the API is not known.
+func (rs *W32APIRetSemantics) Failed(ret int64) bool {
+	if rs == nil || rs.Failure == nil {
+		return false
+	}
+
+	v := rs.Failure.Value
+	switch rs.Failure.Op {
+	case "==":
+		return ret == v
+	case "!=":
+		return ret != v
+	case "<":
+		return ret < v
+	case "<=":
+		return ret <= v
+	case ">":
+		return ret > v
+	case ">=":
+		return ret >= v
+	}
+	return false
 }
 
 func (api *W32API) String() string {
@@ -0,0 +1,17 @@
+// Copyright 2018 Saferwall. All rights reserved.
+// Use of this source code is governed by Apache v2 license
+// license that can be found in the LICENSE file.
+
+package entity
+
+// W32Callback represents a function pointer or function typedef, i.e:
+// LPTHREAD_START_ROUTINE, WNDPROC or PIO_APC_ROUTINE.
+type W32Callback struct {
+	Name              string        `json:"name"`             // Name of the typedef.
+	Header            string        `json:"header,omitempty"` // Header file declaring the typedef.
+	CallingConvention string        `json:"cc,omitempty"`     // Calling Convention.
+	Pointer           bool          `json:"pointer"`          // Whether the typedef is a pointer to a function.
+	RetType           string        `json:"ret_type"`         // Return value type.
+	Variadic          bool          `json:"variadic,omitempty"`
+	Params            []W32APIParam `json:"params"` // Callback arguments.
+}
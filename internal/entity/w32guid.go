@@ -0,0 +1,12 @@
+// Copyright 2018 Saferwall. All rights reserved.
+// Use of this source code is governed by Apache v2 license
+// license that can be found in the LICENSE file.
+
+package entity
+
+// W32GUID represents a well-known GUID: an IID, a CLSID, a known folder ...
+type W32GUID struct {
+	GUID   string `json:"guid"`             // Registry form: 00000000-0000-0000-C000-000000000046.
+	Name   string `json:"name"`             // Symbolic name, i.e IID_IUnknown.
+	Header string `json:"header,omitempty"` // Header file defining the GUID.
+}
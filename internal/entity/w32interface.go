@@ -0,0 +1,23 @@
+// Copyright 2018 Saferwall. All rights reserved.
+// Use of this source code is governed by Apache v2 license
+// license that can be found in the LICENSE file.
+
+package entity
+
+// W32Method represents a method of a COM interface.
+type W32Method struct {
+	Index             int           `json:"index"`        // Slot in the vtable.
+	Name              string        `json:"name"`         // Name of the method.
+	CallingConvention string        `json:"cc,omitempty"` // Calling Convention.
+	RetType           string        `json:"ret_type"`     // Return value type.
+	Params            []W32APIParam `json:"params"`       // Method arguments, starting with This.
+}
+
+// W32Interface represents a COM interface and its vtable layout.
+type W32Interface struct {
+	Name    string      `json:"name"`             // Name of the interface, i.e IWbemServices.
+	Base    string      `json:"base,omitempty"`   // Interface it derives from.
+	IID     string      `json:"iid,omitempty"`    // Interface identifier.
+	Header  string      `json:"header,omitempty"` // Header file declaring the interface.
+	Methods []W32Method `json:"methods"`          // Methods in vtable order, inherited ones included.
+}
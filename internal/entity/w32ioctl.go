@@ -0,0 +1,24 @@
+// Copyright 2018 Saferwall. All rights reserved.
+// Use of this source code is governed by Apache v2 license
+// license that can be found in the LICENSE file.
+
+package entity
+
+// W32IOCTL represents a device I/O control code built with the CTL_CODE
+// macro: (DeviceType << 16) | (Access << 14) | (Function << 2) | Method.
+type W32IOCTL struct {
+	Code           uint32 `json:"code"`                       // Control code.
+	Name           string `json:"name,omitempty"`             // Symbolic name, i.e FSCTL_GET_REPARSE_POINT.
+	Header         string `json:"header,omitempty"`           // Header file defining the code.
+	DeviceType     uint32 `json:"device_type"`                // Device type field.
+	DeviceTypeName string `json:"device_type_name,omitempty"` // Device type name, i.e FILE_DEVICE_FILE_SYSTEM.
+	Function       uint32 `json:"function"`                   // Function code field.
+	Method         string `json:"method"`                     // Transfer type, i.e METHOD_BUFFERED.
+	Access         string `json:"access"`                     // Required access, i.e FILE_ANY_ACCESS.
+}
+
+// W32IOCTLCatalog holds the control codes defined by the headers.
+type W32IOCTLCatalog struct {
+	DeviceTypes map[uint32]string `json:"device_types"` // FILE_DEVICE_* values.
+	Codes       []W32IOCTL        `json:"codes"`
+}
@@ -0,0 +1,14 @@
+// Copyright 2018 Saferwall. All rights reserved.
+// Use of this source code is governed by Apache v2 license
+// license that can be found in the LICENSE file.
+
+package entity
+
+// W32IRQL holds the IRQL annotations of a kernel routine, i.e:
+// _IRQL_requires_max_(DISPATCH_LEVEL).
+type W32IRQL struct {
+	Max      string `json:"max,omitempty"`      // _IRQL_requires_max_ level.
+	Min      string `json:"min,omitempty"`      // _IRQL_requires_min_ level.
+	Requires string `json:"requires,omitempty"` // _IRQL_requires_ level.
+	Raises   string `json:"raises,omitempty"`   // _IRQL_raises_ level.
+}
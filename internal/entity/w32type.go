@@ -0,0 +1,43 @@
+// Copyright 2018 Saferwall. All rights reserved.
+// Use of this source code is governed by Apache v2 license
+// license that can be found in the LICENSE file.
+
+package entity
+
+// Kinds of type definitions.
+const (
+	TypeKindTypedef = "typedef"
+	TypeKindStruct  = "struct"
+	TypeKindUnion   = "union"
+	TypeKindEnum    = "enum"
+	TypeKindFunc    = "func" // Function or function pointer typedef, described by a W32Callback.
+)
+
+// W32TypeMember represents a member of a structure or a union.
+type W32TypeMember struct {
+	Name      string   `json:"name,omitempty"`
+	Type      string   `json:"type"`
+	Offset    int64    `json:"offset"`
+	Size      int64    `json:"size"`
+	Bits      int64    `json:"bits,omitempty"`       // Width of a bit field.
+	BitOffset int      `json:"bit_offset,omitempty"` // Bit offset of a bit field.
+	Def       *W32Type `json:"def,omitempty"`        // Definition of an anonymous nested structure or union.
+}
+
+// W32EnumValue represents an enumeration constant.
+type W32EnumValue struct {
+	Name  string `json:"name"`
+	Value int64  `json:"value"`
+}
+
+// W32Type represents a type definition: a typedef, a structure, a union or
+// an enumeration.
+type W32Type struct {
+	Name    string          `json:"name"`
+	Kind    string          `json:"kind"`
+	Target  string          `json:"target,omitempty"` // Aliased type of a typedef.
+	Size    int64           `json:"size"`
+	Members []W32TypeMember `json:"members,omitempty"`
+	Values  []W32EnumValue  `json:"values,omitempty"`
+	Header  string          `json:"header,omitempty"`
+}
@@ -0,0 +1,174 @@
+// Copyright 2018 Saferwall. All rights reserved.
+// Use of this source code is governed by Apache v2 license
+// license that can be found in the LICENSE file.
+
+package overlay
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/saferwall/winsdk2json/internal/utils"
+	"gopkg.in/yaml.v3"
+)
+
+// Patch statuses.
+const (
+	// The snippet was found and replaced.
+	StatusApplied = "applied"
+	// The header was read but the snippet is no longer in it, the SDK
+	// changed and the patch needs a review.
+	StatusStale = "stale"
+	// The header was never read.
+	StatusUnused = "unused"
+)
+
+// Patch replaces a snippet of an SDK header.
+type Patch struct {
+	// The patch name, defaults to the file name and index.
+	Name string `json:"name" yaml:"name"`
+	// The header file name, i.e: winnt.h, regardless of its directory.
+	Header string `json:"header" yaml:"header"`
+	// Why the header is patched.
+	Reason string `json:"reason,omitempty" yaml:"reason"`
+	// The text to replace, every occurrence is replaced.
+	Find string `json:"find" yaml:"find"`
+	// The replacement text.
+	Replace string `json:"replace" yaml:"replace"`
+}
+
+// PatchStatus reports whether a patch still applies.
+type PatchStatus struct {
+	Name   string `json:"name"`
+	Header string `json:"header"`
+	Status string `json:"status"`
+	// The number of occurrences replaced.
+	Count int `json:"count"`
+}
+
+// Overlay applies patches to the headers in memory, before they are
+// preprocessed.
+type Overlay struct {
+	mu      sync.Mutex
+	patches map[string][]*Patch
+	status  map[*Patch]*PatchStatus
+	order   []*Patch
+}
+
+// patchFile is the content of a patch file.
+type patchFile struct {
+	Patches []*Patch `yaml:"patches"`
+}
+
+// Load reads the patches of the YAML files of a directory, in file name
+// order.
+func Load(dir string) (*Overlay, error) {
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, entry := range entries {
+		ext := strings.ToLower(filepath.Ext(entry.Name()))
+		if !entry.IsDir() && (ext == ".yaml" || ext == ".yml") {
+			names = append(names, entry.Name())
+		}
+	}
+	sort.Strings(names)
+
+	var patches []*Patch
+	for _, name := range names {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+		var file patchFile
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		if err := dec.Decode(&file); err != nil {
+			return nil, fmt.Errorf("parsing %s failed: %v", name, err)
+		}
+		for i, p := range file.Patches {
+			if p.Name == "" {
+				p.Name = fmt.Sprintf("%s#%d", name, i+1)
+			}
+			if p.Header == "" || p.Find == "" {
+				return nil, fmt.Errorf("patch %s: header and find are required", p.Name)
+			}
+		}
+		patches = append(patches, file.Patches...)
+	}
+	return New(patches), nil
+}
+
+// New creates an overlay applying the patches in order.
+func New(patches []*Patch) *Overlay {
+	o := &Overlay{
+		patches: make(map[string][]*Patch),
+		status:  make(map[*Patch]*PatchStatus),
+	}
+	for _, p := range patches {
+		header := strings.ToLower(p.Header)
+		o.patches[header] = append(o.patches[header], p)
+		o.status[p] = &PatchStatus{Name: p.Name, Header: p.Header, Status: StatusUnused}
+		o.order = append(o.order, p)
+	}
+	return o
+}
+
+// Apply returns the content of a header with its patches applied. The
+// snippets follow the line endings of the header.
+func (o *Overlay) Apply(name string, data []byte) []byte {
+
+	patches := o.patches[strings.ToLower(utils.HeaderName(name))]
+	if len(patches) == 0 {
+		return data
+	}
+
+	crlf := bytes.Contains(data, []byte("\r\n"))
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	for _, p := range patches {
+		find, replace := p.Find, p.Replace
+		if crlf {
+			find = toCRLF(find)
+			replace = toCRLF(replace)
+		}
+
+		status := o.status[p]
+		count := bytes.Count(data, []byte(find))
+		if count == 0 {
+			// Another header of the same name may have the snippet.
+			if status.Status != StatusApplied {
+				status.Status = StatusStale
+			}
+			continue
+		}
+		data = bytes.ReplaceAll(data, []byte(find), []byte(replace))
+		status.Status = StatusApplied
+		status.Count = count
+	}
+	return data
+}
+
+// Report returns the status of the patches, in load order.
+func (o *Overlay) Report() []PatchStatus {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	report := make([]PatchStatus, 0, len(o.order))
+	for _, p := range o.order {
+		report = append(report, *o.status[p])
+	}
+	return report
+}
+
+func toCRLF(s string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(s, "\r\n", "\n"), "\n", "\r\n")
+}
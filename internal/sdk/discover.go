@@ -0,0 +1,217 @@
+// Copyright 2018 Saferwall. All rights reserved.
+// Use of this source code is governed by Apache v2 license
+// license that can be found in the LICENSE file.
+
+package sdk
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/saferwall/winsdk2json/internal/utils"
+)
+
+var (
+	// SDK versions have four components, i.e: 10.0.22000.0.
+	sdkVersionRe = regexp.MustCompile(`^\d+\.\d+\.\d+\.\d+$`)
+	// MSVC toolsets have three, i.e: 14.29.30133.
+	toolsetVersionRe = regexp.MustCompile(`^\d+\.\d+\.\d+$`)
+)
+
+// Layout locates the headers of a Windows SDK version and of the MSVC
+// toolset used along with it.
+type Layout struct {
+	// The SDK version, i.e: 10.0.22000.0.
+	Version string
+	// The include directory of the SDK version, it holds the um, shared,
+	// ucrt, winrt and km headers.
+	Include string
+	// The MSVC toolset version, i.e: 14.29.30133.
+	Toolset string
+	// The include directory of the MSVC toolset: the CRT headers.
+	ToolsetInclude string
+}
+
+// Toolset is an MSVC toolset.
+type Toolset struct {
+	Version string
+	Include string
+}
+
+// Discover locates the headers under root, which is either a Windows Kits
+// directory, its Include directory, a copy of it, a NuGet package of the
+// SDK, or the include directory of a single SDK version. The paths are host
+// paths looked up in fsys. The newest SDK version is picked unless version
+// is set.
+//
+// The MSVC toolsets are looked up in msvc when it is set, it is either a
+// toolset, the VC/Tools/MSVC directory holding them or a Visual Studio
+// installation. Otherwise they are looked up next to the SDK versions, as
+// in a copied SDK tree, and in the toolset of the developer prompt. The
+// newest toolset is picked unless toolset is set.
+func Discover(fsys fs.FS, root, version, msvc, toolset string) (*Layout, error) {
+
+	versions, dir, err := Versions(fsys, root)
+	if err != nil {
+		return nil, err
+	}
+	if version == "" {
+		version = versions[len(versions)-1]
+	} else if !utils.StringInSlice(version, versions) {
+		return nil, fmt.Errorf("Windows SDK %s not found under %s, available versions: %s",
+			version, dir, strings.Join(versions, ", "))
+	}
+
+	var dirs []string
+	if msvc != "" {
+		dirs = append(dirs, msvc)
+	} else {
+		dirs = append(dirs, dir, filepath.Dir(dir))
+		if env := os.Getenv("VCToolsInstallDir"); env != "" {
+			dirs = append(dirs, env)
+		}
+	}
+	toolsets := Toolsets(fsys, dirs...)
+	if len(toolsets) == 0 {
+		return nil, fmt.Errorf("no MSVC toolset found in %s, set the MSVC directory with --msvc, i.e: VC/Tools/MSVC",
+			strings.Join(dirs, ", "))
+	}
+	picked := toolsets[len(toolsets)-1]
+	if toolset != "" {
+		var found bool
+		var available []string
+		for _, t := range toolsets {
+			available = append(available, t.Version)
+			if t.Version == toolset {
+				picked, found = t, true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("MSVC toolset %s not found, available toolsets: %s",
+				toolset, strings.Join(available, ", "))
+		}
+	}
+
+	return &Layout{
+		Version:        version,
+		Include:        filepath.Join(dir, version),
+		Toolset:        picked.Version,
+		ToolsetInclude: picked.Include,
+	}, nil
+}
+
+// Versions lists the SDK versions found under root, oldest first, and the
+// directory holding them.
+func Versions(fsys fs.FS, root string) ([]string, string, error) {
+
+	if !isDir(fsys, root) {
+		return nil, "", fmt.Errorf("the Windows SDK directory %s does not exist", root)
+	}
+
+	// The include directory of a single version.
+	if isDir(fsys, filepath.Join(root, "shared")) {
+		root = filepath.Clean(root)
+		return []string{filepath.Base(root)}, filepath.Dir(root), nil
+	}
+
+	// The NuGet packages, Microsoft.Windows.SDK.CPP, have a c/Include one.
+	for _, dir := range []string{root, filepath.Join(root, "Include"), filepath.Join(root, "include"),
+		filepath.Join(root, "c", "Include")} {
+		var versions []string
+		for _, name := range subdirs(fsys, dir) {
+			if sdkVersionRe.MatchString(name) && isDir(fsys, filepath.Join(dir, name, "shared")) {
+				versions = append(versions, name)
+			}
+		}
+		if len(versions) > 0 {
+			sort.Slice(versions, func(i, j int) bool {
+				return versionLess(versions[i], versions[j])
+			})
+			return versions, filepath.Clean(dir), nil
+		}
+	}
+	return nil, "", fmt.Errorf("no Windows SDK found under %s, expected Include/<version>/shared", root)
+}
+
+// Toolsets lists the MSVC toolsets found in the directories, oldest first.
+func Toolsets(fsys fs.FS, dirs ...string) []Toolset {
+
+	seen := make(map[string]bool)
+	var toolsets []Toolset
+	add := func(dir string) {
+		include := filepath.Join(dir, "include")
+		name := filepath.Base(filepath.Clean(dir))
+		if !toolsetVersionRe.MatchString(name) || !isDir(fsys, include) || seen[include] {
+			return
+		}
+		seen[include] = true
+		toolsets = append(toolsets, Toolset{Version: name, Include: include})
+	}
+
+	for _, dir := range dirs {
+		add(dir)
+		for _, parent := range []string{dir, filepath.Join(dir, "VC", "Tools", "MSVC")} {
+			for _, name := range subdirs(fsys, parent) {
+				add(filepath.Join(parent, name))
+			}
+		}
+	}
+	sort.SliceStable(toolsets, func(i, j int) bool {
+		return versionLess(toolsets[i].Version, toolsets[j].Version)
+	})
+	return toolsets
+}
+
+// Require checks the include directory of the SDK version has the given
+// header directories, i.e: um or km/crt.
+func (l *Layout) Require(fsys fs.FS, dirs ...string) error {
+	var missing []string
+	for _, dir := range dirs {
+		if !isDir(fsys, filepath.Join(l.Include, dir)) {
+			missing = append(missing, dir)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("the Windows SDK %s in %s has no %s headers",
+			l.Version, l.Include, strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// versionLess compares dotted version numbers component by component.
+func versionLess(a, b string) bool {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		x, _ := strconv.Atoi(as[i])
+		y, _ := strconv.Atoi(bs[i])
+		if x != y {
+			return x < y
+		}
+	}
+	return len(as) < len(bs)
+}
+
+func subdirs(fsys fs.FS, dir string) []string {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil
+	}
+	var names []string
+	for _, entry := range entries {
+		if entry.IsDir() {
+			names = append(names, entry.Name())
+		}
+	}
+	return names
+}
+
+func isDir(fsys fs.FS, path string) bool {
+	info, err := fs.Stat(fsys, path)
+	return err == nil && info.IsDir()
+}
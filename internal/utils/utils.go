@@ -7,13 +7,18 @@ package utils
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"io"
+	"io/fs"
 	"io/ioutil"
 	"os"
 	"path"
 	"path/filepath"
 	"regexp"
+	"runtime"
 	"strings"
+	"sync"
+	"sync/atomic"
 
 	"github.com/dlclark/regexp2"
 )
@@ -21,6 +26,9 @@ import (
 var (
 	// RegDllName extracts DLL name from markdown spec.
 	RegDllName = `req\.dll: (?P<DLL>[\w]+\.dll)`
+
+	// RegMinClient extracts the minimum supported client from markdown spec.
+	RegMinClient = `req\.target-min-winverclnt: (?P<Client>[^\r\n]+)`
 )
 
 // WriteStrSliceToFile writes a slice of string line by line to a file.
@@ -51,19 +59,33 @@ func WriteStrSliceToFile(filename string, data []string) (int, error) {
 // Read a whole file into the memory and store it as array of lines
 func ReadLines(path string) (lines []string, err error) {
 
-	var (
-		part   []byte
-		prefix bool
-	)
-
 	// Start by getting a file descriptor over the file
 	file, err := os.Open(path)
 	if err != nil {
 		return nil, err
 	}
 	defer file.Close()
+	return readLines(file)
+}
+
+// ReadLinesFS reads a file of a filesystem as array of lines.
+func ReadLinesFS(fsys fs.FS, path string) ([]string, error) {
+	file, err := fsys.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return readLines(file)
+}
 
-	reader := bufio.NewReader(file)
+func readLines(r io.Reader) (lines []string, err error) {
+
+	var (
+		part   []byte
+		prefix bool
+	)
+
+	reader := bufio.NewReader(r)
 	buffer := bytes.NewBuffer(make([]byte, 0))
 	for {
 		if part, prefix, err = reader.ReadLine(); err != nil {
@@ -370,15 +392,115 @@ func Standardize(s string) string {
 	return s
 }
 
+// HeaderName returns the file name of a header path, which may use
+// backslashes as in #include "..\shared\basetsd.h".
+func HeaderName(path string) string {
+	return filepath.Base(filepath.FromSlash(strings.ReplaceAll(path, `\`, "/")))
+}
+
+// APIDocPath returns the path of the sdk-api markdown spec of an API
+// declared in a header.
+func APIDocPath(file, apiname, sdkpath string) string {
+	// The sdk-api folders are named after the lower case header name.
+	cat := strings.TrimSuffix(strings.ToLower(HeaderName(file)), ".h")
+	functionName := "nf-" + cat + "-" + strings.ToLower(apiname) + ".md"
+	return path.Join(sdkpath, "sdk-api-src", "content", cat, functionName)
+}
+
+// ReadAPIDoc reads the sdk-api markdown spec of an API declared in a header.
+func ReadAPIDoc(file, apiname, sdkpath string) (string, error) {
+	mdFileContent, err := ReadAll(APIDocPath(file, apiname, sdkpath))
+	if err != nil {
+		return "", err
+	}
+	return string(mdFileContent), nil
+}
+
 // GetDLLName retrieves the DLL module name that matches an API name.
 func GetDLLName(file, apiname, sdkpath string) (string, error) {
-	cat := strings.TrimSuffix(filepath.Base(file), ".h")
-	functionName := "nf-" + cat + "-" + strings.ToLower(apiname) + ".md"
-	mdFile := path.Join(sdkpath, "sdk-api-src", "content", cat, functionName)
-	mdFileContent, err := ReadAll(mdFile)
+	doc, err := ReadAPIDoc(file, apiname, sdkpath)
 	if err != nil {
 		return "", err
 	}
-	m := RegSubMatchToMapString(RegDllName, string(mdFileContent))
-	return strings.ToLower(m["DLL"]), nil
+	return DocDLLName(doc), nil
+}
+
+// DocDLLName returns the DLL module name found in an sdk-api markdown spec.
+func DocDLLName(doc string) string {
+	m := RegSubMatchToMapString(RegDllName, doc)
+	return strings.ToLower(m["DLL"])
+}
+
+// GetMinClient retrieves the minimum supported client of an API, i.e:
+// Windows XP [desktop apps only].
+func GetMinClient(file, apiname, sdkpath string) (string, error) {
+	doc, err := ReadAPIDoc(file, apiname, sdkpath)
+	if err != nil {
+		return "", err
+	}
+	m := RegSubMatchToMapString(RegMinClient, doc)
+	return strings.Trim(m["Client"], "' \""), nil
+}
+
+// DocSection returns the body of a `## -name` section of an sdk-api markdown
+// spec, or an empty string if the section is missing.
+func DocSection(doc, name string) string {
+	header := "## -" + name
+	start := strings.Index(doc, header)
+	if start < 0 {
+		return ""
+	}
+	body := doc[start+len(header):]
+	if end := strings.Index(body, "\n## -"); end >= 0 {
+		body = body[:end]
+	}
+	return strings.TrimSpace(body)
+}
+
+// Predefines returns the #define directives of macros given as NAME or
+// NAME=VALUE.
+func Predefines(macros []string) string {
+	var predefined string
+	for _, macro := range macros {
+		name, value, _ := strings.Cut(macro, "=")
+		predefined += "#define " + strings.TrimSpace(name) + " " + value + "\n"
+	}
+	return predefined
+}
+
+// Parallel calls fn for each index from 0 to n, in order, running at most
+// jobs calls at once, or one per CPU when jobs is 0. The calls store their
+// results by index, so the output does not depend on the order they
+// complete in. Once a call fails or the context is done, the calls not
+// started yet are skipped. It returns the error of the lowest failing
+// index, or the error of the context.
+func Parallel(ctx context.Context, n, jobs int, fn func(i int) error) error {
+	if jobs <= 0 {
+		jobs = runtime.GOMAXPROCS(0)
+	}
+	slots := make(chan struct{}, jobs)
+	errs := make([]error, n)
+	var failed atomic.Bool
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		slots <- struct{}{}
+		if failed.Load() || ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			if errs[i] = fn(i); errs[i] != nil {
+				failed.Store(true)
+			}
+		}(i)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return ctx.Err()
 }
@@ -0,0 +1,321 @@
+// Copyright 2018 Saferwall. All rights reserved.
+// Use of this source code is governed by Apache v2 license
+// license that can be found in the LICENSE file.
+
+package vfs
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// archive is a zip, NuGet or tar archive mounted at its host path.
+type archive struct {
+	path   string
+	fsys   fs.FS
+	closer io.Closer
+}
+
+func (a *archive) Close() error {
+	if a.closer == nil {
+		return nil
+	}
+	return a.closer.Close()
+}
+
+func (a *archive) Open(name string) (fs.File, error)          { return a.fsys.Open(name) }
+func (a *archive) Stat(name string) (fs.FileInfo, error)      { return fs.Stat(a.fsys, name) }
+func (a *archive) ReadDir(name string) ([]fs.DirEntry, error) { return fs.ReadDir(a.fsys, name) }
+func (a *archive) Join(elem ...string) string                 { return path.Join(elem...) }
+
+func (a *archive) Path(name string) string {
+	if name == "." {
+		return a.path
+	}
+	return filepath.Join(a.path, filepath.FromSlash(name))
+}
+
+// isArchive reports whether a file name has the extension of a supported
+// archive: .zip, .nupkg, .tar, .tar.gz or .tgz.
+func isArchive(name string) bool {
+	name = strings.ToLower(name)
+	for _, ext := range []string{".zip", ".nupkg", ".tar", ".tar.gz", ".tgz"} {
+		if strings.HasSuffix(name, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// mount returns the archive a host path goes through, opening it on first
+// use, and the path inside the archive. It returns a nil archive when the
+// path is not in an archive.
+func (f *FS) mount(name string) (*archive, string, error) {
+
+	parts := strings.Split(name, string(filepath.Separator))
+	for i, part := range parts {
+		if !isArchive(part) {
+			continue
+		}
+		prefix := strings.Join(parts[:i+1], string(filepath.Separator))
+		inner := path.Clean(strings.Join(parts[i+1:], "/"))
+
+		f.mu.Lock()
+		a, ok := f.archives[prefix]
+		if !ok {
+			if info, err := os.Stat(prefix); err != nil || !info.Mode().IsRegular() {
+				f.mu.Unlock()
+				continue
+			}
+			var err error
+			if a, err = openArchive(prefix); err != nil {
+				f.mu.Unlock()
+				return nil, "", err
+			}
+			f.archives[prefix] = a
+		}
+		f.mu.Unlock()
+		return a, inner, nil
+	}
+	return nil, "", nil
+}
+
+// maxTarSize bounds the size of the files of a compressed tar archive, they
+// are held in memory.
+const maxTarSize = 1 << 30
+
+// openArchive opens a zip, NuGet package or tar archive in place. A
+// compressed tar archive can not be seeked, its files are read in memory.
+func openArchive(name string) (*archive, error) {
+
+	lower := strings.ToLower(name)
+	if strings.HasSuffix(lower, ".zip") || strings.HasSuffix(lower, ".nupkg") {
+		r, err := zip.OpenReader(name)
+		if err != nil {
+			return nil, fmt.Errorf("opening %s failed: %v", name, err)
+		}
+		return &archive{path: name, fsys: r, closer: r}, nil
+	}
+
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	if strings.HasSuffix(lower, ".tar") {
+		// The files are read from the archive when opened.
+		r := &offsetReader{file: file}
+		fsys, err := indexTar(tar.NewReader(r), func(tr *tar.Reader, size int64) (int64, error) {
+			return r.offset, nil
+		})
+		if err != nil {
+			file.Close()
+			return nil, fmt.Errorf("reading %s failed: %v", name, err)
+		}
+		fsys.data = file
+		return &archive{path: name, fsys: fsys, closer: file}, nil
+	}
+
+	defer file.Close()
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		return nil, fmt.Errorf("opening %s failed: %v", name, err)
+	}
+	defer gz.Close()
+	var data []byte
+	fsys, err := indexTar(tar.NewReader(gz), func(tr *tar.Reader, size int64) (int64, error) {
+		offset := int64(len(data))
+		if offset+size > maxTarSize {
+			return 0, fmt.Errorf("the files exceed %d MiB, extract the archive or decompress it to a .tar", maxTarSize>>20)
+		}
+		buf := bytes.NewBuffer(data)
+		if _, err := io.Copy(buf, tr); err != nil {
+			return 0, err
+		}
+		data = buf.Bytes()
+		return offset, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("reading %s failed: %v", name, err)
+	}
+	fsys.data = bytes.NewReader(data)
+	return &archive{path: name, fsys: fsys}, nil
+}
+
+// offsetReader reads a file and tracks the offset it is at, tar seeks over
+// the files content.
+type offsetReader struct {
+	file   *os.File
+	offset int64
+}
+
+func (r *offsetReader) Read(b []byte) (int, error) {
+	n, err := r.file.Read(b)
+	r.offset += int64(n)
+	return n, err
+}
+
+func (r *offsetReader) Seek(offset int64, whence int) (int64, error) {
+	offset, err := r.file.Seek(offset, whence)
+	if err == nil {
+		r.offset = offset
+	}
+	return offset, err
+}
+
+// tarFS is a read-only filesystem of the files of a tar archive, their
+// content is read from data.
+type tarFS struct {
+	data  io.ReaderAt
+	files map[string]tarEntry
+	dirs  map[string]map[string]memInfo
+}
+
+// tarEntry locates the content of a file in the data of a tarFS.
+type tarEntry struct {
+	offset, size int64
+}
+
+// indexTar lists the regular files and directories of a tar archive.
+// content is called with the reader positioned at the content of each file,
+// and returns its offset in the data of the filesystem.
+func indexTar(tr *tar.Reader, content func(tr *tar.Reader, size int64) (int64, error)) (*tarFS, error) {
+
+	m := &tarFS{
+		files: make(map[string]tarEntry),
+		dirs:  map[string]map[string]memInfo{".": {}},
+	}
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return m, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		name := path.Clean(strings.ReplaceAll(hdr.Name, `\`, "/"))
+		name = strings.TrimPrefix(name, "/")
+		if name == "." || !fs.ValidPath(name) {
+			continue
+		}
+		switch {
+		case hdr.FileInfo().IsDir():
+			m.addDir(name)
+		case isSparse(hdr):
+			return nil, fmt.Errorf("%s is a sparse file", hdr.Name)
+		case hdr.FileInfo().Mode().IsRegular():
+			offset, err := content(tr, hdr.Size)
+			if err != nil {
+				return nil, err
+			}
+			m.files[name] = tarEntry{offset: offset, size: hdr.Size}
+			m.addDir(path.Dir(name))
+			m.dirs[path.Dir(name)][path.Base(name)] = memInfo{name: path.Base(name), size: hdr.Size}
+		}
+	}
+}
+
+// isSparse reports whether a tar entry is a GNU sparse file, its content is
+// not stored in one piece.
+func isSparse(hdr *tar.Header) bool {
+	return hdr.Typeflag == tar.TypeGNUSparse ||
+		hdr.PAXRecords["GNU.sparse.major"] != "" || hdr.PAXRecords["GNU.sparse.map"] != ""
+}
+
+// addDir adds a directory and its parents.
+func (m *tarFS) addDir(name string) {
+	for name != "." {
+		if _, ok := m.dirs[name]; ok {
+			return
+		}
+		m.dirs[name] = make(map[string]memInfo)
+		parent := path.Dir(name)
+		if _, ok := m.dirs[parent]; !ok {
+			m.addDir(parent)
+		}
+		m.dirs[parent][path.Base(name)] = memInfo{name: path.Base(name), dir: true}
+		name = parent
+	}
+}
+
+func (m *tarFS) Open(name string) (fs.File, error) {
+	info, err := m.Stat(name)
+	if err != nil {
+		return nil, err
+	}
+	entry := m.files[name]
+	return &memFile{memInfo: info.(memInfo), ReadSeeker: io.NewSectionReader(m.data, entry.offset, entry.size)}, nil
+}
+
+func (m *tarFS) Stat(name string) (fs.FileInfo, error) {
+	if entry, ok := m.files[name]; ok {
+		return memInfo{name: path.Base(name), size: entry.size}, nil
+	}
+	if _, ok := m.dirs[name]; ok {
+		return memInfo{name: path.Base(name), dir: true}, nil
+	}
+	return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+}
+
+func (m *tarFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	entries, ok := m.dirs[name]
+	if !ok {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+	}
+	list := make([]fs.DirEntry, 0, len(entries))
+	for _, entry := range entries {
+		list = append(list, entry)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name() < list[j].Name() })
+	return list, nil
+}
+
+// memInfo describes a file or directory of a tarFS, or a patched file.
+type memInfo struct {
+	name string
+	size int64
+	dir  bool
+}
+
+func (i memInfo) Name() string               { return i.name }
+func (i memInfo) Size() int64                { return i.size }
+func (i memInfo) ModTime() time.Time         { return time.Time{} }
+func (i memInfo) IsDir() bool                { return i.dir }
+func (i memInfo) Sys() interface{}           { return nil }
+func (i memInfo) Type() fs.FileMode          { return i.Mode().Type() }
+func (i memInfo) Info() (fs.FileInfo, error) { return i, nil }
+
+func (i memInfo) Mode() fs.FileMode {
+	if i.dir {
+		return fs.ModeDir | 0555
+	}
+	return 0444
+}
+
+// memFile is an opened file of a tarFS, or a patched file.
+type memFile struct {
+	memInfo
+	io.ReadSeeker
+}
+
+func (f *memFile) Stat() (fs.FileInfo, error) { return f.memInfo, nil }
+func (f *memFile) Close() error               { return nil }
+
+func (f *memFile) Read(b []byte) (int, error) {
+	if f.dir {
+		return 0, &fs.PathError{Op: "read", Path: f.name, Err: errors.New("is a directory")}
+	}
+	return f.ReadSeeker.Read(b)
+}
@@ -0,0 +1,315 @@
+// Copyright 2018 Saferwall. All rights reserved.
+// Use of this source code is governed by Apache v2 license
+// license that can be found in the LICENSE file.
+
+package vfs
+
+import (
+	"bytes"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// FS opens the files of the host filesystem the way Windows does: names are
+// case insensitive and both slashes and backslashes separate the path
+// components. The Windows SDK mixes <Windows.h> and <windows.h>, or
+// "..\shared\foo.h", which only work on case insensitive filesystems.
+//
+// A path going through a zip, NuGet or tar archive continues inside the
+// archive, i.e: /sdk/microsoft.windows.sdk.cpp.nupkg/c/Include. The zip and
+// tar archives are read in place, their files are never extracted. A
+// compressed tar archive can not be seeked: its files are read in memory
+// when it is mounted, up to 1 GiB.
+//
+// Unlike the io/fs convention, the names are host paths, as given by the
+// cc include lookup, i.e: /sdk/Include/10.0.22000.0/um/Windows.h.
+type FS struct {
+	mu sync.Mutex
+	// The entries of the directories read so far, keyed by lower case name.
+	dirs map[string]map[string][]string
+	// The names matching several entries, and the entries they match.
+	ambiguous map[string][]string
+	// The archives opened so far, keyed by host path.
+	archives map[string]*archive
+	report   func(name string, matches []string)
+	patch    func(name string, data []byte) []byte
+}
+
+// Ambiguity is a name matching several files that only differ in case, the
+// name is in lower case.
+type Ambiguity struct {
+	Name    string
+	Matches []string
+}
+
+// tree is a directory tree the names are resolved in: the host filesystem
+// or an archive.
+type tree interface {
+	Open(name string) (fs.File, error)
+	Stat(name string) (fs.FileInfo, error)
+	ReadDir(name string) ([]fs.DirEntry, error)
+	Join(elem ...string) string
+	// Path returns the host path of a name of the tree.
+	Path(name string) string
+}
+
+// host is the host filesystem.
+type host struct{}
+
+func (host) Open(name string) (fs.File, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (host) Stat(name string) (fs.FileInfo, error)      { return os.Stat(name) }
+func (host) ReadDir(name string) ([]fs.DirEntry, error) { return os.ReadDir(name) }
+func (host) Join(elem ...string) string                 { return filepath.Join(elem...) }
+func (host) Path(name string) string                    { return name }
+
+// New creates a filesystem, report is called once for each name matching
+// several files, it can be nil.
+func New(report func(name string, matches []string)) *FS {
+	return &FS{
+		dirs:      make(map[string]map[string][]string),
+		ambiguous: make(map[string][]string),
+		archives:  make(map[string]*archive),
+		report:    report,
+	}
+}
+
+// SetPatch sets a function rewriting the content of the files when they
+// are opened, it is given their host path.
+func (f *FS) SetPatch(patch func(name string, data []byte) []byte) {
+	f.patch = patch
+}
+
+// Patched returns a view of the filesystem rewriting the content of the
+// files with another patch, after the one of the filesystem. The view
+// shares the directories and archives read so far.
+func (f *FS) Patched(patch func(name string, data []byte) []byte) fs.FS {
+	return &patchedFS{FS: f, patch: patch}
+}
+
+// patchedFS is a view of a filesystem with an additional patch.
+type patchedFS struct {
+	*FS
+	patch func(name string, data []byte) []byte
+}
+
+func (p *patchedFS) Open(name string) (fs.File, error) {
+	return p.open(name, p.patch)
+}
+
+// Open opens the file a name resolves to.
+func (f *FS) Open(name string) (fs.File, error) {
+	return f.open(name, nil)
+}
+
+// open opens the file a name resolves to, with the patch of the filesystem
+// and the extra one applied.
+func (f *FS) open(name string, extra func(name string, data []byte) []byte) (fs.File, error) {
+	t, path, err := f.resolve(name)
+	if err != nil {
+		return nil, err
+	}
+	file, err := t.Open(path)
+	if err != nil || f.patch == nil && extra == nil {
+		return file, err
+	}
+
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return t.Open(path)
+	}
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return nil, err
+	}
+	if f.patch != nil {
+		data = f.patch(t.Path(path), data)
+	}
+	if extra != nil {
+		data = extra(t.Path(path), data)
+	}
+	return &memFile{
+		memInfo:    memInfo{name: info.Name(), size: int64(len(data))},
+		ReadSeeker: bytes.NewReader(data),
+	}, nil
+}
+
+// Stat returns the file info of the file or directory a name resolves to.
+func (f *FS) Stat(name string) (fs.FileInfo, error) {
+	t, path, err := f.resolve(name)
+	if err != nil {
+		return nil, err
+	}
+	return t.Stat(path)
+}
+
+// ReadDir reads the directory a name resolves to.
+func (f *FS) ReadDir(name string) ([]fs.DirEntry, error) {
+	t, path, err := f.resolve(name)
+	if err != nil {
+		return nil, err
+	}
+	return t.ReadDir(path)
+}
+
+// Resolve returns the host path of a name, the path inside an archive is
+// appended to the archive one.
+func (f *FS) Resolve(name string) (string, error) {
+	t, path, err := f.resolve(name)
+	if err != nil {
+		return "", err
+	}
+	return t.Path(path), nil
+}
+
+// Close closes the archives opened so far.
+func (f *FS) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var err error
+	for path, a := range f.archives {
+		if cerr := a.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+		delete(f.archives, path)
+	}
+	return err
+}
+
+// resolve returns the tree holding a name and its path in the tree. When it
+// does not exist as spelled, each path component is looked up case
+// insensitively. When several entries match, the one spelled as requested
+// is tried first, then the others in lexical order, and the ambiguity is
+// reported.
+func (f *FS) resolve(name string) (tree, string, error) {
+
+	path := filepath.Clean(filepath.FromSlash(strings.ReplaceAll(name, `\`, "/")))
+
+	var t tree = host{}
+	var parts []string
+	current := "."
+	a, inner, err := f.mount(path)
+	switch {
+	case err != nil:
+		return nil, "", &fs.PathError{Op: "open", Path: name, Err: err}
+	case a != nil:
+		t, path = a, inner
+		if _, err := t.Stat(path); err == nil {
+			return t, path, nil
+		}
+		parts = strings.Split(path, "/")
+	default:
+		if _, err := os.Stat(path); err == nil {
+			return t, path, nil
+		}
+		if filepath.IsAbs(path) {
+			current = filepath.VolumeName(path) + string(filepath.Separator)
+			path = path[len(current):]
+		}
+		parts = strings.Split(path, string(filepath.Separator))
+	}
+
+	if resolved, ok := f.walk(t, current, parts); ok {
+		return t, resolved, nil
+	}
+	return nil, "", &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+}
+
+// walk resolves the path components under a directory of a tree.
+func (f *FS) walk(t tree, current string, parts []string) (string, bool) {
+	if len(parts) == 0 {
+		_, err := t.Stat(current)
+		return current, err == nil
+	}
+
+	part := parts[0]
+	if part == "." || part == ".." {
+		return f.walk(t, t.Join(current, part), parts[1:])
+	}
+
+	matches := f.lookup(t, current, part)
+	if len(matches) > 1 {
+		f.ambiguity(t.Path(t.Join(current, strings.ToLower(part))), matches)
+	}
+	candidates := make([]string, 0, len(matches))
+	for _, match := range matches {
+		if match == part {
+			candidates = append([]string{match}, candidates...)
+		} else {
+			candidates = append(candidates, match)
+		}
+	}
+	for _, candidate := range candidates {
+		if resolved, ok := f.walk(t, t.Join(current, candidate), parts[1:]); ok {
+			return resolved, true
+		}
+	}
+	return "", false
+}
+
+// Ambiguities returns the names that matched several files, sorted by name.
+func (f *FS) Ambiguities() []Ambiguity {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var ambiguities []Ambiguity
+	for name, matches := range f.ambiguous {
+		ambiguities = append(ambiguities, Ambiguity{Name: name, Matches: matches})
+	}
+	sort.Slice(ambiguities, func(i, j int) bool {
+		return ambiguities[i].Name < ambiguities[j].Name
+	})
+	return ambiguities
+}
+
+// lookup returns the entries of a directory matching a name regardless of
+// the case, sorted.
+func (f *FS) lookup(t tree, dir, name string) []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	key := t.Path(dir)
+	entries, ok := f.dirs[key]
+	if !ok {
+		entries = make(map[string][]string)
+		list, _ := t.ReadDir(dir)
+		for _, entry := range list {
+			lower := strings.ToLower(entry.Name())
+			entries[lower] = append(entries[lower], entry.Name())
+		}
+		for _, names := range entries {
+			sort.Strings(names)
+		}
+		f.dirs[key] = entries
+	}
+	return entries[strings.ToLower(name)]
+}
+
+func (f *FS) ambiguity(name string, matches []string) {
+	f.mu.Lock()
+	_, seen := f.ambiguous[name]
+	if !seen {
+		f.ambiguous[name] = matches
+	}
+	f.mu.Unlock()
+
+	if !seen && f.report != nil {
+		f.report(name, matches)
+	}
+}
@@ -0,0 +1,57 @@
+// Copyright 2018 Saferwall. All rights reserved.
+// Use of this source code is governed by Apache v2 license
+// license that can be found in the LICENSE file.
+
+package winsdk
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/saferwall/winsdk2json/internal/cache"
+	"modernc.org/cc/v4"
+)
+
+// cacheKey returns the cache key of a translation: everything it depends on
+// besides the headers, whose content is checked when the entry is loaded.
+// The include paths are part of it in search order, a directory added or
+// moved ahead may shadow headers the entry was not translated from. The
+// hooks, the merge and the outputs are applied after the translation,
+// changing them reuses the cached models.
+func (s *session) cacheKey(kind, arch string, config *cc.Config, source []byte) string {
+	return cache.Key(s.tool, kind, arch, s.profile, s.include, s.toolset, s.phnt, s.phntMode, s.docs,
+		strings.Join(config.IncludePaths, "\x00"), strings.Join(config.SysIncludePaths, "\x00"),
+		strconv.FormatBool(s.resilient), config.Predefined, string(source))
+}
+
+// loadCached returns the cached model of a key. It reports false when the
+// cache is disabled, or the model is missing or stale.
+func (s *session) loadCached(unit, key string) (*Database, bool) {
+
+	if s.cache == nil {
+		return nil, false
+	}
+	var db Database
+	ok, err := s.cache.Load(key, s.fs, &db)
+	if err != nil {
+		s.log.printf("reading the cached translation of %s failed: %v", unit, err)
+	}
+	if !ok {
+		return nil, false
+	}
+
+	s.log.printf("using the cached translation of %s", unit)
+	return &db, true
+}
+
+// storeCached caches the model of a key, along with the files it was
+// translated from.
+func (s *session) storeCached(unit, key string, deps *cache.Recorder, db *Database) {
+
+	if s.cache == nil {
+		return
+	}
+	if err := s.cache.Store(key, s.fs, deps.Names(), db); err != nil {
+		s.log.printf("caching the translation of %s failed: %v", unit, err)
+	}
+}
@@ -0,0 +1,214 @@
+// Copyright 2018 Saferwall. All rights reserved.
+// Use of this source code is governed by Apache v2 license
+// license that can be found in the LICENSE file.
+
+package winsdk
+
+import (
+	"io/fs"
+	"regexp"
+	"strings"
+
+	"github.com/saferwall/winsdk2json/internal/entity"
+	"github.com/saferwall/winsdk2json/internal/utils"
+	"modernc.org/cc/v4"
+)
+
+var (
+	// Calling convention macros, cc drops the attributes they expand to in
+	// a parenthesized declarator, so they are read back from the header
+	// source.
+	callConvs = map[string]string{
+		"WINAPI":            "__stdcall",
+		"CALLBACK":          "__stdcall",
+		"NTAPI":             "__stdcall",
+		"APIENTRY":          "__stdcall",
+		"APIPRIVATE":        "__stdcall",
+		"PASCAL":            "__stdcall",
+		"WSAAPI":            "__stdcall",
+		"STDMETHODCALLTYPE": "__stdcall",
+		"RPC_ENTRY":         "__stdcall",
+		"__stdcall":         "__stdcall",
+		"_stdcall":          "__stdcall",
+		"WINAPIV":           "__cdecl",
+		"CDECL":             "__cdecl",
+		"STDAPIVCALLTYPE":   "__cdecl",
+		"__cdecl":           "__cdecl",
+		"_cdecl":            "__cdecl",
+		"FASTCALL":          "__fastcall",
+		"__fastcall":        "__fastcall",
+	}
+
+	reWord = regexp.MustCompile(`\w+`)
+)
+
+// extractCallbacks collects every function and function pointer typedef with
+// its full signature.
+func extractCallbacks(fsys fs.FS, ast *cc.AST) map[string]entity.W32Callback {
+
+	callbacks := make(map[string]entity.W32Callback)
+	headers := newHeaderSource(fsys)
+
+	for tu := ast.TranslationUnit; tu != nil; tu = tu.TranslationUnit {
+		ed := tu.ExternalDeclaration
+		if ed == nil || ed.Case != cc.ExternalDeclarationDecl {
+			continue
+		}
+		for l := ed.Declaration.InitDeclaratorList; l != nil; l = l.InitDeclaratorList {
+			d := l.InitDeclarator.Declarator
+			if d == nil || !d.IsTypename() {
+				continue
+			}
+			ft, isPtr := funcType(d.Type())
+			if ft == nil {
+				continue
+			}
+
+			callback := entity.W32Callback{
+				Name:     d.Name(),
+				Header:   utils.HeaderName(d.Position().Filename),
+				Pointer:  isPtr,
+				RetType:  typeName(ft.Result(), false),
+				Variadic: ft.IsVariadic(),
+			}
+			callback.CallingConvention = specCallConv(ed.Declaration.DeclarationSpecifiers)
+			if callback.CallingConvention == "" {
+				callback.CallingConvention = callConv(d, headers)
+			}
+
+			// Aliases and pointers to a function typedef inherit its calling
+			// convention.
+			if alias, ok := callbacks[specTypeName(ed.Declaration.DeclarationSpecifiers)]; ok &&
+				callback.CallingConvention == "" {
+				callback.CallingConvention = alias.CallingConvention
+			}
+			if callback.CallingConvention == "" && isPtr {
+				if elem := d.Type().(*cc.PointerType).Elem(); elem.Typedef() != nil {
+					callback.CallingConvention = callConv(elem.Typedef(), headers)
+				}
+			}
+
+			callback.Params = make([]entity.W32APIParam, 0, len(ft.Parameters()))
+			for _, p := range ft.Parameters() {
+				param := entity.W32APIParam{Name: p.Name(), Type: typeName(p.Type(), false)}
+				if param.Type == "void" && param.Name == "" {
+					continue
+				}
+				if p.Declarator != nil {
+					param.Annotation, param.Post = paramAnnotation(p.Declarator.Type().Attributes())
+				}
+				callback.Params = append(callback.Params, param)
+			}
+			callbacks[callback.Name] = callback
+		}
+	}
+
+	return callbacks
+}
+
+// funcType returns the function type of a function or function pointer
+// typedef, and whether it is a pointer.
+func funcType(t cc.Type) (*cc.FunctionType, bool) {
+	switch x := t.(type) {
+	case *cc.FunctionType:
+		return x, false
+	case *cc.PointerType:
+		if ft, ok := x.Elem().(*cc.FunctionType); ok {
+			return ft, true
+		}
+	}
+	return nil, false
+}
+
+// callConv returns the calling convention of a typedef or a function. The
+// calling convention keywords are predefined as cc attributes of the
+// function type. These are lost in a parenthesized declarator such as
+// (CALLBACK *WNDPROC), the convention is then the last macro naming one in
+// the source preceding the name, which may span several lines.
+func callConv(d *cc.Declarator, headers *headerSource) string {
+	if ft, _ := funcType(d.Type()); ft != nil {
+		if conv := funcAttr(ft, "cc"); conv != "" {
+			return conv
+		}
+	}
+
+	words := reWord.FindAllString(declPrefix(d, headers), -1)
+	for i := len(words) - 1; i >= 0; i-- {
+		if conv, ok := callConvs[words[i]]; ok {
+			return conv
+		}
+	}
+	return ""
+}
+
+// specCallConv returns the calling convention attribute among declaration
+// specifiers, typedef VOID CALLBACK TIMERPROC(...). cc does not reliably
+// keep it with the type of the typedef.
+func specCallConv(ds *cc.DeclarationSpecifiers) string {
+	for ; ds != nil; ds = ds.DeclarationSpecifiers {
+		if ds.Case != cc.DeclarationSpecifiersAttr {
+			continue
+		}
+		for l := ds.AttributeSpecifierList; l != nil; l = l.AttributeSpecifierList {
+			for v := l.AttributeSpecifier.AttributeValueList; v != nil; v = v.AttributeValueList {
+				attr := v.AttributeValue
+				if attr.Case != cc.AttributeValueExpr || attr.Token.SrcStr() != "cc" ||
+					attr.ArgumentExpressionList == nil {
+					continue
+				}
+				if val, ok := attr.ArgumentExpressionList.AssignmentExpression.Value().(cc.StringValue); ok {
+					return strings.Replace(string(val), "\x00", "", -1)
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// declPrefix returns the source text preceding the name of a declarator,
+// back to the end of the previous declaration or directive. Kernel routines
+// spread it over several lines: _IRQL_requires_max_(...) NTKERNELAPI VOID.
+func declPrefix(d *cc.Declarator, headers *headerSource) string {
+	tok := d.NameTok()
+	pos := tok.Position()
+	lines := headers.lines(pos.Filename)
+	if pos.Line < 1 || pos.Line > len(lines) {
+		return ""
+	}
+
+	line := lines[pos.Line-1]
+	if pos.Column >= 1 && pos.Column <= len(line)+1 {
+		line = line[:pos.Column-1]
+	}
+	prefix := []string{strings.TrimSpace(line)}
+	for i := pos.Line - 2; i >= 0 && len(prefix) < 16; i-- {
+		l := strings.TrimSpace(lines[i])
+		if l == "" || strings.HasPrefix(l, "#") || strings.HasSuffix(l, ";") ||
+			strings.HasSuffix(l, "{") || strings.HasSuffix(l, "}") {
+			break
+		}
+		prefix = append([]string{l}, prefix...)
+	}
+	return strings.TrimSpace(strings.Join(prefix, " "))
+}
+
+// headerSource reads the headers of a translation unit, from the filesystem
+// it was translated from.
+type headerSource struct {
+	fsys  fs.FS
+	cache map[string][]string
+}
+
+func newHeaderSource(fsys fs.FS) *headerSource {
+	return &headerSource{fsys: fsys, cache: make(map[string][]string)}
+}
+
+// lines returns the lines of a header, read once and cached.
+func (h *headerSource) lines(filename string) []string {
+	lines, ok := h.cache[filename]
+	if !ok {
+		lines, _ = utils.ReadLinesFS(h.fsys, filename)
+		h.cache[filename] = lines
+	}
+	return lines
+}
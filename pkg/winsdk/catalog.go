@@ -0,0 +1,52 @@
+// Copyright 2018 Saferwall. All rights reserved.
+// Use of this source code is governed by Apache v2 license
+// license that can be found in the LICENSE file.
+
+package winsdk
+
+import (
+	"github.com/saferwall/winsdk2json/internal/analysis"
+)
+
+// GUIDIndex maps a GUID to its symbolic names: Lookup takes its registry
+// form, LookupBytes the 16 bytes of its in-memory layout as read from a
+// REFIID or REFCLSID parameter.
+type GUIDIndex = analysis.GUIDCatalog
+
+// IOCTLIndex maps a control code to its definition: Lookup returns its
+// name, Decode splits it into the fields of the CTL_CODE macro.
+type IOCTLIndex = analysis.IOCTLCatalog
+
+// NewGUIDIndex indexes GUIDs, i.e: Database.GUIDs or the content of
+// guids.json.
+func NewGUIDIndex(guids []GUID) GUIDIndex {
+	return analysis.NewGUIDCatalog(guids)
+}
+
+// NewIOCTLIndex indexes control codes, i.e: Database.IOCTLs or the content
+// of ioctls.json.
+func NewIOCTLIndex(catalog IOCTLCatalog) *IOCTLIndex {
+	return analysis.NewIOCTLCatalog(catalog)
+}
+
+// GUIDFromBytes formats the in-memory layout of a GUID into its registry
+// form.
+func GUIDFromBytes(b []byte) (string, error) {
+	return analysis.GUIDFromBytes(b)
+}
+
+// DecodeIOCTL splits a control code into the fields of the CTL_CODE macro.
+// Device types are named from deviceTypes, which can be nil.
+func DecodeIOCTL(code uint32, deviceTypes map[uint32]string) IOCTL {
+	return analysis.DecodeIOCTL(code, deviceTypes)
+}
+
+// GUIDIndex indexes the GUIDs of the headers.
+func (db *Database) GUIDIndex() GUIDIndex {
+	return NewGUIDIndex(db.GUIDs)
+}
+
+// IOCTLIndex indexes the control codes of the headers.
+func (db *Database) IOCTLIndex() *IOCTLIndex {
+	return NewIOCTLIndex(db.IOCTLs)
+}
@@ -0,0 +1,118 @@
+// Copyright 2018 Saferwall. All rights reserved.
+// Use of this source code is governed by Apache v2 license
+// license that can be found in the LICENSE file.
+
+package winsdk
+
+import (
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/saferwall/winsdk2json/internal/entity"
+	"github.com/saferwall/winsdk2json/internal/utils"
+	"modernc.org/cc/v4"
+)
+
+var (
+	// DEFINE_GUID(IID_IFoo, 0x12345678, 0x1234, 0x1234, 0x12, ...), the
+	// EXTERN_GUID and DEFINE_KNOWN_FOLDER macros take the same arguments.
+	reDefineGUID = regexp.MustCompile(`\b(?:DEFINE_GUID|EXTERN_GUID|DEFINE_KNOWN_FOLDER)\(\s*(\w+)\s*,` +
+		strings.Repeat(`\s*(0[xX][0-9A-Fa-f]+|\d+)[uUlL]*\s*,`, 11) + `?`)
+
+	// The C++ flavor of the MIDL generated headers gives the IIDs and the
+	// CLSIDs: MIDL_INTERFACE("9556dc99-...") and class DECLSPEC_UUID("...").
+	reMIDLInterface = regexp.MustCompile(
+		`\bMIDL_INTERFACE\(\s*"([0-9A-Fa-f-]{36})"\s*\)\s*(\w+)\s*(?::\s*public\s+(\w+))?`)
+	reDeclspecUUID = regexp.MustCompile(
+		`\b(?:class|struct)\s+DECLSPEC_UUID\(\s*"([0-9A-Fa-f-]{36})"\s*\)\s*(\w+)`)
+)
+
+// extractGUIDs collects the GUIDs defined by the headers that took part in
+// the translation, read from the filesystem it was translated from.
+func extractGUIDs(fsys fs.FS, ast *cc.AST) []entity.W32GUID {
+
+	var guids []entity.W32GUID
+	seen := make(map[string]bool)
+	add := func(guid, name, header string) {
+		guid = strings.ToUpper(guid)
+		if seen[guid+name] {
+			return
+		}
+		seen[guid+name] = true
+		guids = append(guids, entity.W32GUID{GUID: guid, Name: name, Header: header})
+	}
+
+	for _, source := range sourceFiles(ast) {
+		data, err := fs.ReadFile(fsys, source)
+		if err != nil {
+			continue
+		}
+		src := string(data)
+		header := utils.HeaderName(source)
+
+		for _, m := range reDefineGUID.FindAllStringSubmatch(src, -1) {
+			if guid, err := formatGUID(m[2:]); err == nil {
+				add(guid, m[1], header)
+			}
+		}
+		for _, m := range reMIDLInterface.FindAllStringSubmatch(src, -1) {
+			add(m[1], "IID_"+m[2], header)
+		}
+		for _, m := range reDeclspecUUID.FindAllStringSubmatch(src, -1) {
+			add(m[1], "CLSID_"+m[2], header)
+		}
+	}
+
+	sort.Slice(guids, func(i, j int) bool {
+		if guids[i].Name != guids[j].Name {
+			return guids[i].Name < guids[j].Name
+		}
+		return guids[i].GUID < guids[j].GUID
+	})
+	return guids
+}
+
+// formatGUID formats the 11 numbers of a GUID initializer into its registry
+// form: 00000000-0000-0000-C000-000000000046.
+func formatGUID(parts []string) (string, error) {
+	if len(parts) != 11 {
+		return "", fmt.Errorf("a GUID is made of 11 numbers, got %d", len(parts))
+	}
+	var v [11]uint64
+	for i, part := range parts {
+		n, err := strconv.ParseUint(strings.TrimSpace(part), 0, 32)
+		if err != nil {
+			return "", err
+		}
+		v[i] = n
+	}
+	return fmt.Sprintf("%08X-%04X-%04X-%02X%02X-%02X%02X%02X%02X%02X%02X",
+		v[0], v[1], v[2], v[3], v[4], v[5], v[6], v[7], v[8], v[9], v[10]), nil
+}
+
+// sourceFiles returns the sorted list of files that declared something or
+// defined a macro during the translation.
+func sourceFiles(ast *cc.AST) []string {
+	files := make(map[string]bool)
+	for _, nodes := range ast.Scope.Nodes {
+		for _, n := range nodes {
+			files[n.Position().Filename] = true
+		}
+	}
+	for _, m := range ast.Macros {
+		files[m.Name.Position().Filename] = true
+	}
+
+	var sources []string
+	for f := range files {
+		if f != "" && !strings.HasPrefix(f, "<") {
+			sources = append(sources, f)
+		}
+	}
+	sort.Strings(sources)
+	return sources
+}
@@ -0,0 +1,101 @@
+// Copyright 2018 Saferwall. All rights reserved.
+// Use of this source code is governed by Apache v2 license
+// license that can be found in the LICENSE file.
+
+package winsdk
+
+import (
+	"io/fs"
+
+	"github.com/saferwall/winsdk2json/internal/analysis"
+	"github.com/saferwall/winsdk2json/internal/entity"
+	"modernc.org/cc/v4"
+)
+
+// extractInterfaces collects the COM interfaces declared in C style: an
+// interface is a structure holding a single lpVtbl pointer to its vtable.
+// The IIDs are taken from the GUIDs defined by the headers.
+func extractInterfaces(fsys fs.FS, ast *cc.AST, guids []entity.W32GUID) map[string]entity.W32Interface {
+
+	ifaces := make(map[string]entity.W32Interface)
+	headers := newHeaderSource(fsys)
+	sources := make(map[string]bool)
+	iids := make(map[string]string)
+	for _, g := range guids {
+		iids[g.Name] = g.GUID
+	}
+
+	for s := range ast.Structs {
+		if s.IsIncomplete() || s.NumFields() != 1 {
+			continue
+		}
+		f := s.FieldByIndex(0)
+		if f.Name() != "lpVtbl" {
+			continue
+		}
+		ptr, ok := f.Type().(*cc.PointerType)
+		if !ok {
+			continue
+		}
+		vtbl, ok := ptr.Elem().(*cc.StructType)
+		if !ok || vtbl.IsIncomplete() {
+			continue
+		}
+
+		tag := s.Tag()
+		iface := entity.W32Interface{Name: tag.SrcStr()}
+		if _, ok := ifaces[iface.Name]; ok || iface.Name == "" {
+			continue
+		}
+		iface.Header = headerOf(tag)
+		iface.IID = iids["IID_"+iface.Name]
+		sources[tag.Position().Filename] = true
+
+		iface.Methods = make([]entity.W32Method, 0, vtbl.NumFields())
+		for i := 0; i < vtbl.NumFields(); i++ {
+			field := vtbl.FieldByIndex(i)
+			ft, _ := funcType(field.Type())
+			if ft == nil {
+				continue
+			}
+			method := entity.W32Method{
+				Index:   i,
+				Name:    field.Name(),
+				RetType: typeName(ft.Result(), false),
+			}
+			if d := field.Declarator(); d != nil {
+				method.CallingConvention = callConv(d, headers)
+			}
+			method.Params = make([]entity.W32APIParam, 0, len(ft.Parameters()))
+			for _, p := range ft.Parameters() {
+				param := entity.W32APIParam{Name: p.Name(), Type: typeName(p.Type(), false)}
+				if param.Type == "void" && param.Name == "" {
+					continue
+				}
+				if p.Declarator != nil {
+					param.Annotation, param.Post = paramAnnotation(p.Declarator.Type().Attributes())
+				}
+				method.Params = append(method.Params, param)
+			}
+			iface.Methods = append(iface.Methods, method)
+		}
+		ifaces[iface.Name] = iface
+	}
+
+	// The base interfaces are only spelled in the header sources.
+	for source := range sources {
+		data, err := fs.ReadFile(fsys, source)
+		if err != nil {
+			continue
+		}
+		for _, m := range reMIDLInterface.FindAllStringSubmatch(string(data), -1) {
+			if iface, ok := ifaces[m[2]]; ok && iface.Base == "" {
+				iface.Base = m[3]
+				ifaces[m[2]] = iface
+			}
+		}
+	}
+
+	analysis.InferBaseInterfaces(ifaces)
+	return ifaces
+}
@@ -0,0 +1,97 @@
+// Copyright 2018 Saferwall. All rights reserved.
+// Use of this source code is governed by Apache v2 license
+// license that can be found in the LICENSE file.
+
+package winsdk
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/saferwall/winsdk2json/internal/analysis"
+	"github.com/saferwall/winsdk2json/internal/entity"
+	"github.com/saferwall/winsdk2json/internal/utils"
+	"modernc.org/cc/v4"
+)
+
+// deviceCharacteristics are the FILE_DEVICE_* flags of the device
+// characteristics, they are not device types.
+var deviceCharacteristics = []string{
+	"FILE_DEVICE_SECURE_OPEN",
+	"FILE_DEVICE_IS_MOUNTED",
+	"FILE_DEVICE_ALLOW_APPCONTAINER_TRAVERSAL",
+	"FILE_DEVICE_REQUIRE_SECURITY_CHECK",
+}
+
+// extractIOCTLs collects the macros defined through CTL_CODE along with the
+// FILE_DEVICE_* device types. It relies on the macros being evaluated by the
+// translation.
+func extractIOCTLs(ast *cc.AST) entity.W32IOCTLCatalog {
+
+	catalog := entity.W32IOCTLCatalog{DeviceTypes: make(map[uint32]string)}
+
+	for name, m := range ast.Macros {
+		if m.IsFnLike || !strings.HasPrefix(name, "FILE_DEVICE_") ||
+			utils.StringInSlice(name, deviceCharacteristics) {
+			continue
+		}
+		if v, ok := macroValue(m); ok && v <= 0xFFFF {
+			if other, ok := catalog.DeviceTypes[uint32(v)]; !ok || name < other {
+				catalog.DeviceTypes[uint32(v)] = name
+			}
+		}
+	}
+
+	for name, m := range ast.Macros {
+		if m.IsFnLike || !usesCtlCode(m, ast.Macros) {
+			continue
+		}
+		v, ok := macroValue(m)
+		if !ok {
+			continue
+		}
+		ioctl := analysis.DecodeIOCTL(uint32(v), catalog.DeviceTypes)
+		ioctl.Name = name
+		ioctl.Header = utils.HeaderName(m.Position().Filename)
+		catalog.Codes = append(catalog.Codes, ioctl)
+	}
+
+	sort.Slice(catalog.Codes, func(i, j int) bool {
+		return catalog.Codes[i].Name < catalog.Codes[j].Name
+	})
+	return catalog
+}
+
+// usesCtlCode reports whether a macro expands to CTL_CODE, directly or
+// through a wrapper macro like _STORAGE_CTL_CODE.
+func usesCtlCode(m *cc.Macro, macros map[string]*cc.Macro) bool {
+	if callsCtlCode(m) {
+		return true
+	}
+	for _, tok := range m.ReplacementList() {
+		if wrapper, ok := macros[tok.SrcStr()]; ok && wrapper != m && callsCtlCode(wrapper) {
+			return true
+		}
+	}
+	return false
+}
+
+func callsCtlCode(m *cc.Macro) bool {
+	for _, tok := range m.ReplacementList() {
+		if tok.SrcStr() == "CTL_CODE" {
+			return true
+		}
+	}
+	return false
+}
+
+// macroValue returns the integer value of an evaluated macro.
+func macroValue(m *cc.Macro) (uint64, bool) {
+	switch v := m.Value().(type) {
+	case cc.Int64Value:
+		return uint64(uint32(v)), true
+	case cc.UInt64Value:
+		return uint64(v), true
+	}
+	return 0, false
+}
@@ -0,0 +1,37 @@
+// Copyright 2018 Saferwall. All rights reserved.
+// Use of this source code is governed by Apache v2 license
+// license that can be found in the LICENSE file.
+
+package winsdk
+
+import (
+	"modernc.org/cc/v4"
+)
+
+// defaultNTDDIVersion is the NTDDI_VERSION targeted by the kernel headers
+// when none is given: Windows 10.
+const defaultNTDDIVersion = "0x0A000000"
+
+// kernelPredefines returns the macros the WDK build defines for drivers
+// targeting a Windows version, i.e WIN10 or 0x0A000000.
+func kernelPredefines(ntddi string) (string, error) {
+	if ntddi == "" {
+		ntddi = defaultNTDDIVersion
+	}
+	version, err := ntddiPredefines(ntddi)
+	if err != nil {
+		return "", err
+	}
+	return "#define _KERNEL_MODE 1\n" + version, nil
+}
+
+// isFuncDefined reports whether a function has a body in the translation
+// unit, like the FORCEINLINE helpers of wdm.h.
+func isFuncDefined(ast *cc.AST, name string) bool {
+	for _, node := range ast.Scope.Nodes[name] {
+		if d, ok := node.(*cc.Declarator); ok && d.IsFuncDef() {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,29 @@
+// Copyright 2018 Saferwall. All rights reserved.
+// Use of this source code is governed by Apache v2 license
+// license that can be found in the LICENSE file.
+
+package winsdk
+
+import (
+	"fmt"
+	"io"
+	"sync"
+)
+
+// logger writes the progress messages of a parse to Options.Log, the
+// concurrent translations share it.
+type logger struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// printf writes a message on its own line, or discards it when there is no
+// writer.
+func (l *logger) printf(format string, args ...interface{}) {
+	if l == nil || l.w == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	fmt.Fprintf(l.w, format+"\n", args...)
+}
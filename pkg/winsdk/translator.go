@@ -0,0 +1,753 @@
+// Copyright 2018 Saferwall. All rights reserved.
+// Use of this source code is governed by Apache v2 license
+// license that can be found in the LICENSE file.
+
+package winsdk
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/saferwall/winsdk2json/internal/analysis"
+	"github.com/saferwall/winsdk2json/internal/cache"
+	"github.com/saferwall/winsdk2json/internal/entity"
+	"github.com/saferwall/winsdk2json/internal/overlay"
+	"github.com/saferwall/winsdk2json/internal/sdk"
+	"github.com/saferwall/winsdk2json/internal/utils"
+	"github.com/saferwall/winsdk2json/internal/vfs"
+	"github.com/xlab/c-for-go/translator"
+	"modernc.org/cc/v4"
+)
+
+// session holds the settings of a parse, shared by its translation units
+// and architecture passes. They only read it, the state of each translation
+// is its own, so they can run concurrently.
+type session struct {
+	// The headers, served to cc and to the extractors reading their sources.
+	// The SDK include names are case insensitive.
+	fs *vfs.FS
+	// The Windows SDK version and MSVC toolset found by useSDK, and their
+	// include directories.
+	sdkVersion     string
+	toolsetVersion string
+	include        string
+	toolset        string
+	profile        string
+	arch           string
+	ntddi          string
+	// The phnt headers directory, version and mode.
+	phnt        string
+	phntVersion string
+	phntMode    string
+	// The sdk-api docs directory.
+	docs string
+	// Extra #define directives appended to the predefined macros.
+	predefined   string
+	includePaths []string
+	patches      *overlay.Overlay
+	resilient    bool
+	typesOnly    bool
+	// The translation unit whose AST is dumped, if any.
+	dumpUnit string
+	dumpAST  io.Writer
+	log      *logger
+	// The translated models, and the hash of the executable invalidating
+	// them when the translation changes. The cache is nil when disabled.
+	cache *cache.Cache
+	tool  string
+}
+
+// maxRecoveries bounds the number of times a translation unit is translated
+// again after skipping the declarations cc failed on.
+const maxRecoveries = 64
+
+// newSession validates the options and finds the headers they target.
+func newSession(opts Options) (*session, error) {
+
+	if len(opts.Sources) == 0 {
+		return nil, ErrNoSources
+	}
+	if opts.Include == "" {
+		return nil, fmt.Errorf("the Windows SDK include directory is required")
+	}
+	if opts.Jobs < 0 {
+		return nil, fmt.Errorf("jobs must not be negative: %d", opts.Jobs)
+	}
+	s := &session{
+		profile:      opts.Profile,
+		arch:         opts.Arch,
+		ntddi:        opts.NTDDIVersion,
+		phnt:         opts.Phnt,
+		phntVersion:  opts.PhntVersion,
+		phntMode:     opts.PhntMode,
+		docs:         opts.Docs,
+		predefined:   utils.Predefines(opts.Macros),
+		includePaths: opts.IncludePaths,
+		resilient:    opts.Resilient,
+		typesOnly:    opts.TypesOnly,
+		dumpAST:      opts.DumpAST,
+		log:          &logger{w: opts.Log},
+	}
+	if s.profile == "" {
+		s.profile = ProfileUser
+	}
+	if s.profile != ProfileUser && s.profile != ProfileKernel {
+		return nil, fmt.Errorf("unknown profile: %q", s.profile)
+	}
+	if s.arch == "" {
+		s.arch = "amd64"
+	}
+	if _, ok := archPredefines[s.arch]; !ok {
+		return nil, fmt.Errorf("unsupported architecture: %s", s.arch)
+	}
+	for _, arch := range opts.ExtraArchs {
+		if _, ok := archPredefines[arch]; !ok {
+			return nil, fmt.Errorf("unsupported architecture: %s", arch)
+		}
+	}
+	if s.phntMode == "" {
+		s.phntMode = "user"
+	}
+	if s.dumpAST != nil {
+		s.dumpUnit = opts.Sources[0].Name
+	}
+	if err := opts.merger().Validate(); err != nil {
+		return nil, err
+	}
+
+	s.fs = vfs.New(func(name string, matches []string) {
+		s.log.printf("ambiguous include %s matches %s", name, strings.Join(matches, ", "))
+	})
+	if err := s.useSDK(opts.Include, opts.SDKVersion, opts.MSVC, opts.Toolset); err != nil {
+		s.fs.Close()
+		return nil, err
+	}
+	if opts.Patches != "" {
+		patches, err := overlay.Load(opts.Patches)
+		if err != nil {
+			s.fs.Close()
+			return nil, err
+		}
+		s.patches = patches
+		s.fs.SetPatch(patches.Apply)
+	}
+	if opts.CacheDir != "" {
+		// A new build of the tool may translate differently.
+		exe, err := os.Executable()
+		if err == nil {
+			s.tool, err = cache.HashFile(exe)
+		}
+		if err == nil {
+			s.cache, err = cache.Open(opts.CacheDir)
+		}
+		if err != nil {
+			s.fs.Close()
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// mergeDatabases merges the definitions of several translation units, and
+// returns the conflicting ones.
+func mergeDatabases(units []*Database, merger *analysis.Merger) (*Database, []entity.W32Conflict) {
+
+	var apis [][]entity.W32API
+	var types []map[string]entity.W32Type
+	var callbacks []map[string]entity.W32Callback
+	var interfaces []map[string]entity.W32Interface
+	var guids [][]entity.W32GUID
+	var ioctls []entity.W32IOCTLCatalog
+	var functions []map[string]string
+	for _, unit := range units {
+		apis = append(apis, unit.APIs)
+		types = append(types, unit.Types)
+		callbacks = append(callbacks, unit.Callbacks)
+		interfaces = append(interfaces, unit.Interfaces)
+		guids = append(guids, unit.GUIDs)
+		ioctls = append(ioctls, unit.IOCTLs)
+		functions = append(functions, unit.Functions)
+	}
+
+	db := &Database{Functions: merger.MergeFunctions(functions)}
+	var conflicts, c []entity.W32Conflict
+	db.APIs, c = merger.MergeAPIs(apis)
+	conflicts = append(conflicts, c...)
+	db.Types, c = merger.MergeTypes(types)
+	conflicts = append(conflicts, c...)
+	db.Callbacks, c = merger.MergeCallbacks(callbacks)
+	conflicts = append(conflicts, c...)
+	db.Interfaces, c = merger.MergeInterfaces(interfaces)
+	conflicts = append(conflicts, c...)
+	db.GUIDs, c = merger.MergeGUIDs(guids)
+	conflicts = append(conflicts, c...)
+	db.IOCTLs, c = merger.MergeIOCTLs(ioctls)
+	conflicts = append(conflicts, c...)
+	for _, unit := range units {
+		db.Diagnostics = append(db.Diagnostics, unit.Diagnostics...)
+	}
+	return db, conflicts
+}
+
+// useSDK translates the headers of a Windows SDK version and MSVC toolset
+// found under root, the newest ones unless requested. It fails when the
+// headers of the profile are missing.
+func (s *session) useSDK(root, version, msvc, toolset string) error {
+	layout, err := sdk.Discover(s.fs, root, version, msvc, toolset)
+	if err != nil {
+		return err
+	}
+	required := []string{"um", "shared", "ucrt"}
+	if s.profile == ProfileKernel {
+		required = []string{"km", "km/crt", "shared"}
+	}
+	if err := layout.Require(s.fs, required...); err != nil {
+		return err
+	}
+
+	s.sdkVersion = layout.Version
+	s.toolsetVersion = layout.Toolset
+	s.include = layout.Include
+	s.toolset = layout.ToolsetInclude
+	return nil
+}
+
+// translate translates a source for an architecture, unit identifies it in
+// the diagnostics. Only the types and the declared functions are extracted
+// when typesOnly is set.
+func (s *session) translate(unit, arch string, source []byte, typesOnly bool) (*Database, error) {
+
+	config, err := s.newConfig(arch, s.phntVersion, s.ntddi)
+	if err != nil {
+		return nil, err
+	}
+
+	// The AST is only dumped when the unit is translated.
+	dump := s.dumpAST != nil && unit == s.dumpUnit
+	kind := "unit"
+	if typesOnly {
+		kind = "types"
+	}
+	key := s.cacheKey(kind, arch, config, source)
+	if !dump {
+		if db, ok := s.loadCached(unit, key); ok {
+			return db, nil
+		}
+	}
+
+	var sources []cc.Source
+	sources = append(sources, cc.Source{Name: "<predefined>", Value: config.Predefined})
+	sources = append(sources, cc.Source{Name: "<builtin>", Value: cc.Builtin})
+	sources = append(sources, cc.Source{Name: "saferwall.c", Value: source})
+
+	deps := cache.NewRecorder()
+	ast, diagnostics, err := s.ccTranslate(unit, config, sources, deps)
+	if err != nil {
+		return nil, &TranslateError{Unit: unit, Diagnostics: diagnostics, Err: err}
+	}
+
+	if dump {
+		if _, err := io.WriteString(s.dumpAST, ast.TranslationUnit.String()); err != nil {
+			return nil, fmt.Errorf("failed to write ast: %v", err)
+		}
+	}
+
+	db := &Database{
+		Types:       extractTypes(ast),
+		Functions:   declaredFunctions(ast),
+		Diagnostics: diagnostics,
+	}
+	if !typesOnly {
+		if err := s.extractAPIs(db, config.FS, ast, deps); err != nil {
+			return nil, err
+		}
+	}
+	s.storeCached(unit, key, deps, db)
+	return db, nil
+}
+
+// extractAPIs extracts the APIs, callbacks, COM interfaces, GUIDs and
+// control codes of a translation unit, its headers are read from fsys. The
+// sdk-api docs read are recorded by deps.
+func (s *session) extractAPIs(db *Database, fsys fs.FS, ast *cc.AST, deps *cache.Recorder) error {
+
+	// Use c-for-go to translate the AST to high level objects.
+	myTranslator, err := translator.New(&translator.Config{})
+	if err != nil {
+		return fmt.Errorf("failed to create new translator: %v", err)
+	}
+	myTranslator.Learn(ast)
+
+	// The extractors read the headers as cc did, skipped declarations
+	// included.
+	callbacks := extractCallbacks(fsys, ast)
+	headers := newHeaderSource(fsys)
+
+	// Walk through all declarations and create list of APIs.
+	var w32apis []entity.W32API
+	for _, d := range myTranslator.Declares() {
+		if strings.HasPrefix(d.Name, "__builtin_") {
+			continue
+		}
+
+		funcSpec, ok := d.Spec.(*translator.CFunctionSpec)
+		if !ok {
+			continue
+		}
+
+		var w32api entity.W32API
+
+		retSpec, ok := funcSpec.Return.(*translator.CTypeSpec)
+		if !ok {
+			// We are dealing with functions that return type is void.
+			w32api.RetType = "void"
+		} else {
+			// API return type.
+			w32api.RetType = retSpec.Raw
+			if retSpec.Raw == "" {
+				w32api.RetType = retSpec.Base
+			}
+		}
+
+		funcDecl := ast.Scope.Nodes[d.Name][0].(*cc.Declarator)
+
+		w32api.Name = d.Name
+		w32api.Header = utils.HeaderName(d.Position.Filename)
+		switch {
+		case s.profile == ProfileKernel:
+			// Inline routines are not exported by the kernel images.
+			if isFuncDefined(ast, d.Name) {
+				continue
+			}
+			w32api.DLL = analysis.KernelImage(d.Name, w32api.Header, declPrefix(funcDecl, headers))
+		case s.isPhntHeader(d.Position.Filename):
+			w32api.DLL = analysis.NativeDLL(d.Name)
+		}
+
+		// The sdk-api docs give the DLL and the return value section, they
+		// are optional when the DLL is known otherwise.
+		deps.Add(utils.APIDocPath(d.Position.Filename, d.Name, s.docs))
+		doc, err := utils.ReadAPIDoc(d.Position.Filename, d.Name, s.docs)
+		if w32api.DLL == "" {
+			if err != nil {
+				s.log.printf("failed to get the DLL name for: %s [%s]", d.Name, d.Position.Filename)
+				continue
+			}
+			w32api.DLL = utils.DocDLLName(doc)
+		}
+
+		w32api.CallingConvention = callConv(funcDecl, headers)
+		ft := funcDecl.Type().(*cc.FunctionType)
+
+		// The _Success_ annotation sits with the declaration specifiers, it
+		// ends up either on the function or on its return type.
+		w32api.Success = funcAttr(ft, "success")
+		w32api.IRQL = irqlAnnotation(ft)
+
+		w32api.Params = make([]entity.W32APIParam, len(funcSpec.Params))
+		for idx, param := range funcSpec.Params {
+			var w32apiParam entity.W32APIParam
+			w32apiParam.Name = param.Name
+
+			switch param.Spec.(type) {
+			case *translator.CTypeSpec:
+				paramSpec := param.Spec.(*translator.CTypeSpec)
+				w32apiParam.Type = paramSpec.Raw
+				if paramSpec.Raw == "" {
+					w32apiParam.Type = paramSpec.Base
+				}
+				for i := uint8(1); i < paramSpec.Pointers; i++ {
+					w32apiParam.Type = w32apiParam.Type + "*"
+				}
+			case *translator.CStructSpec:
+				paramSpec := param.Spec.(*translator.CStructSpec)
+				w32apiParam.Type = paramSpec.Raw
+				for i := uint8(0); i < paramSpec.Pointers; i++ {
+					w32apiParam.Type = w32apiParam.Type + "*"
+				}
+				if strings.HasPrefix(w32apiParam.Type, "LP") {
+					w32apiParam.Type = w32apiParam.Type[:len(w32apiParam.Type)-1]
+				}
+				if len(paramSpec.Members) == 1 && paramSpec.Members[0].Name == "unused" {
+					w32apiParam.Type = w32apiParam.Type[:len(w32apiParam.Type)-1]
+				}
+
+			case *translator.CEnumSpec:
+				paramSpec := param.Spec.(*translator.CEnumSpec)
+				w32apiParam.Type = paramSpec.Tag
+			}
+
+			paramDecl := ft.Parameters()[idx]
+			if paramDecl.Declarator == nil {
+				w32api.Params[idx] = w32apiParam // even though incomplete
+				continue
+			}
+
+			t := paramDecl.Declarator.Type()
+			// if pointerType, ok := t.(*cc.PointerType); ok {
+			// 	t = pointerType.Elem()
+			// }
+
+			w32apiParam.Annotation, w32apiParam.Post = paramAnnotation(t.Attributes())
+			if _, ok := callbacks[analysis.BaseTypeName(w32apiParam.Type)]; ok {
+				w32apiParam.Callback = analysis.BaseTypeName(w32apiParam.Type)
+			}
+			w32api.Params[idx] = w32apiParam
+		}
+
+		// Derive the success/failure rule from the return value section.
+		w32api.RetSemantics = analysis.ClassifyReturn(w32api, utils.DocSection(doc, "returns"))
+
+		w32apis = append(w32apis, w32api)
+	}
+
+	analysis.LinkNativeAliases(w32apis)
+
+	db.APIs = w32apis
+	db.Callbacks = callbacks
+	db.GUIDs = extractGUIDs(fsys, ast)
+	db.Interfaces = extractInterfaces(fsys, ast, db.GUIDs)
+	db.IOCTLs = extractIOCTLs(ast)
+	return nil
+}
+
+// recovery is the state of a translation unit in resilient mode: the
+// declarations skipped, as line ranges keyed by the host path of their
+// header, and the errors they were skipped for.
+type recovery struct {
+	fsys        *vfs.FS
+	log         *logger
+	unit        string
+	skipped     map[string][][2]int
+	diagnostics []entity.W32Diagnostic
+}
+
+// ccTranslate translates a unit, named unit in the diagnostics. In resilient
+// mode, the declarations cc fails on are blanked in memory and the unit is
+// translated again, until it succeeds or the failing declarations can not be
+// isolated. The skipped declarations only affect this unit, the
+// configuration filesystem is replaced by a view of the headers without
+// them. The files opened are recorded by deps, unless it is nil.
+func (s *session) ccTranslate(unit string, config *cc.Config, sources []cc.Source, deps *cache.Recorder) (*cc.AST, []entity.W32Diagnostic, error) {
+
+	if !s.resilient {
+		if deps != nil {
+			config.FS = deps.Wrap(config.FS)
+		}
+		ast, err := cc.Translate(config, sources)
+		return ast, nil, err
+	}
+
+	r := &recovery{fsys: s.fs, log: s.log, unit: unit, skipped: make(map[string][][2]int)}
+	config.FS = s.fs.Patched(r.patch)
+	if deps != nil {
+		config.FS = deps.Wrap(config.FS)
+	}
+	for i := 0; ; i++ {
+		ast, err := cc.Translate(config, sources)
+		if err == nil || i == maxRecoveries {
+			return ast, r.diagnostics, err
+		}
+
+		// The errors following a syntax error are mostly caused by it, only
+		// the first one is recovered from at a time.
+		errs := analysis.ParseCCErrors(err)
+		if _, perr := cc.Parse(config, sources); perr != nil {
+			errs = analysis.ParseCCErrors(perr)
+			for len(errs) > 1 && errs[0].File == "" {
+				errs = errs[1:]
+			}
+			errs = errs[:1]
+		}
+		if !r.skipDeclarations(config.FS, errs) {
+			return nil, r.diagnostics, err
+		}
+	}
+}
+
+// skipDeclarations records the declarations holding the errors cc reported
+// to skip them, and reports whether any was found. The errors outside the
+// headers, or in a preprocessor directive, can not be recovered from.
+func (r *recovery) skipDeclarations(fsys fs.FS, errs []analysis.CCError) bool {
+
+	var progress bool
+	headers := make(map[string][]byte)
+	for _, e := range errs {
+		if e.File == "" {
+			continue
+		}
+		name, err := r.fsys.Resolve(e.File)
+		if err != nil {
+			continue
+		}
+		data, ok := headers[name]
+		if !ok {
+			if data, err = fs.ReadFile(fsys, name); err != nil {
+				continue
+			}
+			headers[name] = data
+		}
+		first, last, ok := analysis.DeclarationExtent(data, e.Line)
+		if !ok {
+			continue
+		}
+		text := analysis.DeclarationText(data, first, last)
+		if text == "" {
+			// Already skipped, the error is elsewhere.
+			continue
+		}
+
+		lines := [2]int{first, last}
+		if !containsLines(r.skipped[name], lines) {
+			r.skipped[name] = append(r.skipped[name], lines)
+			r.log.printf("skipping %s:%d-%d in %s: %s", utils.HeaderName(name), first, last, r.unit, e.Msg)
+		}
+		r.diagnostics = append(r.diagnostics, entity.W32Diagnostic{
+			Unit:    r.unit,
+			Header:  utils.HeaderName(name),
+			File:    name,
+			Line:    e.Line,
+			Column:  e.Column,
+			Error:   e.Msg,
+			Notes:   e.Notes,
+			Skipped: &entity.W32Skipped{FromLine: first, ToLine: last, Text: text},
+		})
+		progress = true
+	}
+	return progress
+}
+
+func containsLines(ranges [][2]int, lines [2]int) bool {
+	for _, r := range ranges {
+		if r == lines {
+			return true
+		}
+	}
+	return false
+}
+
+// patch blanks the skipped declarations of a header when it is read.
+func (r *recovery) patch(name string, data []byte) []byte {
+	for _, lines := range r.skipped[name] {
+		data = analysis.BlankLines(data, lines[0], lines[1])
+	}
+	return data
+}
+
+// archPredefines are the macros the MSVC compiler defines for each target
+// architecture.
+var archPredefines = map[string][]string{
+	"amd64": {"_AMD64_", "_M_AMD64", "_M_X64", "_WIN64"},
+	"386":   {"_X86_", "_M_IX86 600"},
+	"arm64": {"_ARM64_", "_M_ARM64", "_WIN64"},
+}
+
+// newConfig creates the cc configuration used to translate the Windows
+// headers for an architecture: amd64, 386 or arm64. The headers target the
+// given NTDDI_VERSION, or their default one when it is empty.
+func (s *session) newConfig(arch, phntVersion, ntddi string) (*cc.Config, error) {
+
+	predefines, ok := archPredefines[arch]
+	if !ok {
+		return nil, fmt.Errorf("unsupported architecture: %s", arch)
+	}
+
+	config, err := cc.NewConfig(runtime.GOOS, runtime.GOARCH)
+	if err != nil {
+		return nil, err
+	}
+
+	// Type sizes and alignments follow the Windows ABI: long is 4 bytes.
+	config.ABI, err = cc.NewABI("windows", arch)
+	if err != nil {
+		return nil, err
+	}
+
+	config.HostSysIncludePaths = config.HostSysIncludePaths[:0]
+	config.IncludePaths = config.IncludePaths[:0]
+	config.SysIncludePaths = config.SysIncludePaths[:0]
+
+	if s.profile == ProfileKernel {
+		config.SysIncludePaths = append(config.SysIncludePaths, s.include+"/km")
+		config.SysIncludePaths = append(config.SysIncludePaths, s.include+"/km/crt")
+		config.SysIncludePaths = append(config.SysIncludePaths, s.include+"/shared")
+		config.SysIncludePaths = append(config.SysIncludePaths, s.toolset)
+	} else {
+		config.SysIncludePaths = append(config.SysIncludePaths, s.include+"/um")
+		config.SysIncludePaths = append(config.SysIncludePaths, s.include+"/shared")
+		config.SysIncludePaths = append(config.SysIncludePaths, s.toolset)
+		config.SysIncludePaths = append(config.SysIncludePaths, s.include+"/ucrt")
+		config.SysIncludePaths = append(config.SysIncludePaths, s.include+"/winrt")
+		if s.phnt != "" {
+			config.SysIncludePaths = append(config.SysIncludePaths, s.phnt)
+		}
+	}
+	config.HostSysIncludePaths = config.SysIncludePaths
+	config.FS = s.fs
+
+	// The extra directories are searched first by #include "...", the
+	// headers under assets include the shared SAL remapping this way.
+	config.IncludePaths = append(append(config.IncludePaths, s.includePaths...), config.SysIncludePaths...)
+
+	config.Predefined += "\n#define __int64 long long\n"
+	config.Predefined += "#define __iamcu__\n"
+	config.Predefined += "#define __int32 int\n"
+	config.Predefined += "#define NTDDI_WIN7 0x06010000\n"
+	config.Predefined += "#define __forceinline __attribute__((always_inline))\n"
+	for _, predefine := range predefines {
+		config.Predefined += "#define " + predefine + "\n"
+	}
+	config.Predefined += "#define __unaligned\n"
+	config.Predefined += "#define _MSC_FULL_VER 192930133\n"
+
+	// The calling conventions are kept as attributes of the function types,
+	// and the SDK macros like WINAPI expand to them.
+	config.Predefined += "#define _STDCALL_SUPPORTED\n"
+	config.Predefined += "#define __stdcall __attribute__((cc(\"__stdcall\")))\n"
+	config.Predefined += "#define __cdecl __attribute__((cc(\"__cdecl\")))\n"
+	config.Predefined += "#define __fastcall __attribute__((cc(\"__fastcall\")))\n"
+
+	if s.profile == ProfileKernel {
+		kernel, err := kernelPredefines(ntddi)
+		if err != nil {
+			return nil, err
+		}
+		config.Predefined += kernel
+	} else {
+		config.Predefined += "#define WIN32_LEAN_AND_MEAN\n"
+		config.Predefined += phntPredefines(phntVersion, s.phntMode)
+		if ntddi != "" {
+			version, err := ntddiPredefines(ntddi)
+			if err != nil {
+				return nil, err
+			}
+			config.Predefined += version
+		}
+	}
+
+	config.Predefined += s.predefined
+
+	// Evaluate object-like macros, control codes are built with CTL_CODE.
+	config.EvalAllMacros = true
+	return config, nil
+}
+
+// phntPredefines selects the phnt headers flavor: the targeted Windows
+// version, i.e PHNT_WIN11 or 114, and the user or kernel mode.
+func phntPredefines(version, mode string) string {
+	var predefined string
+	if version != "" {
+		if _, err := strconv.Atoi(version); err != nil && !strings.HasPrefix(version, "PHNT_") {
+			version = "PHNT_" + version
+		}
+		predefined += "#define PHNT_VERSION " + strings.ToUpper(version) + "\n"
+	}
+	switch strings.ToLower(mode) {
+	case "kernel":
+		predefined += "#define PHNT_MODE PHNT_MODE_KERNEL\n"
+	case "user":
+		predefined += "#define PHNT_MODE PHNT_MODE_USER\n"
+	}
+	return predefined
+}
+
+// ntddiPredefines targets a Windows version: NTDDI_VERSION and the matching
+// _WIN32_WINNT. The version is either a sdkddkver.h name like WIN10_RS5 or a
+// number like 0x0A000006.
+func ntddiPredefines(ntddi string) (string, error) {
+	version, ok := analysis.ParseNTDDI(ntddi)
+	if !ok {
+		return "", fmt.Errorf("invalid NTDDI_VERSION: %s", ntddi)
+	}
+	var predefined string
+	predefined += fmt.Sprintf("#define NTDDI_VERSION 0x%08X\n", version)
+	predefined += fmt.Sprintf("#define _WIN32_WINNT 0x%04X\n", version>>16)
+	return predefined, nil
+}
+
+// isPhntHeader reports whether a header is part of the phnt headers, none
+// is when they are not translated.
+func (s *session) isPhntHeader(filename string) bool {
+	if s.phnt == "" {
+		return false
+	}
+	root, err := filepath.Abs(s.phnt)
+	if err != nil {
+		return false
+	}
+	file, err := filepath.Abs(filename)
+	if err != nil {
+		return false
+	}
+	rel, err := filepath.Rel(root, file)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// paramAnnotation returns the SAL annotation of a parameter along with its
+// post-condition, i.e: _Out_writes_(nSize) and _Post_invalid_.
+func paramAnnotation(attr *cc.Attributes) (string, string) {
+	if attr == nil {
+		return "", ""
+	}
+
+	anno := attrString(attr, "anno")
+	annoSize := attrString(attr, "size")
+	if annoSize != "" {
+		attrCount := attrString(attr, "count")
+		if attrCount != "" {
+			anno = fmt.Sprintf("%s(%s,%s)", anno, annoSize, attrCount)
+		} else {
+			anno = fmt.Sprintf("%s(%s)", anno, annoSize)
+		}
+	}
+	return anno, attrString(attr, "post")
+}
+
+// funcAttr returns the string value of a custom attribute attached to a
+// function. Annotations sitting with the declaration specifiers, like
+// _Success_ or _IRQL_requires_max_, end up either on the function or on its
+// return type.
+func funcAttr(ft *cc.FunctionType, name string) string {
+	if val := attrString(ft.Attributes(), name); val != "" {
+		return val
+	}
+	return attrString(ft.Result().Attributes(), name)
+}
+
+// irqlAnnotation returns the IRQL annotations of a kernel routine, or nil if
+// it has none.
+func irqlAnnotation(ft *cc.FunctionType) *entity.W32IRQL {
+	irql := entity.W32IRQL{
+		Max:      funcAttr(ft, "irql_max"),
+		Min:      funcAttr(ft, "irql_min"),
+		Requires: funcAttr(ft, "irql"),
+		Raises:   funcAttr(ft, "irql_raises"),
+	}
+	if irql == (entity.W32IRQL{}) {
+		return nil
+	}
+	return &irql
+}
+
+// attrString returns the string value of a custom attribute like
+// __attribute__((anno("_In_"))), or an empty string if it is not set.
+func attrString(attr *cc.Attributes, name string) string {
+	if attr == nil {
+		return ""
+	}
+	vals := attr.AttrValue(name)
+	if len(vals) == 0 {
+		return ""
+	}
+	val, ok := vals[0].(cc.StringValue)
+	if !ok {
+		return ""
+	}
+	return strings.Replace(string(val), "\x00", "", -1)
+}
@@ -0,0 +1,281 @@
+// Copyright 2018 Saferwall. All rights reserved.
+// Use of this source code is governed by Apache v2 license
+// license that can be found in the LICENSE file.
+
+package winsdk
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/saferwall/winsdk2json/internal/entity"
+	"github.com/saferwall/winsdk2json/internal/utils"
+	"modernc.org/cc/v4"
+)
+
+// fielder is implemented by both structures and unions.
+type fielder interface {
+	cc.Type
+	NumFields() int
+	FieldByIndex(int) *cc.Field
+}
+
+// extractTypes walks the AST and collects every typedef, tagged structure,
+// union and enumeration, keyed by name: FILETIME, struct _FILETIME, ...
+func extractTypes(ast *cc.AST) map[string]entity.W32Type {
+
+	types := make(map[string]entity.W32Type)
+
+	for s := range ast.Structs {
+		registerTagged(types, s)
+	}
+	for u := range ast.Unions {
+		registerTagged(types, u)
+	}
+
+	for tu := ast.TranslationUnit; tu != nil; tu = tu.TranslationUnit {
+		ed := tu.ExternalDeclaration
+		if ed == nil || ed.Case != cc.ExternalDeclarationDecl {
+			continue
+		}
+		decl := ed.Declaration
+		if decl.DeclarationSpecifiers == nil {
+			continue
+		}
+
+		// enum _FOO { ... }; declares the enumeration without a typedef.
+		registerTagged(types, decl.DeclarationSpecifiers.Type())
+
+		for l := decl.InitDeclaratorList; l != nil; l = l.InitDeclaratorList {
+			d := l.InitDeclarator.Declarator
+			if d == nil || !d.IsTypename() {
+				continue
+			}
+			name := d.Name()
+			if _, ok := types[name]; ok || strings.HasPrefix(name, "__builtin_") {
+				continue
+			}
+			types[name] = typedefType(d, decl.DeclarationSpecifiers)
+		}
+	}
+
+	return types
+}
+
+// typedefType describes a typedef declarator. Typedefs of anonymous
+// structures, unions or enumerations hold the definition itself, the other
+// ones point to their target type.
+func typedefType(d *cc.Declarator, ds *cc.DeclarationSpecifiers) entity.W32Type {
+
+	t := d.Type()
+	w32type := entity.W32Type{
+		Name:   d.Name(),
+		Kind:   entity.TypeKindTypedef,
+		Size:   t.Size(),
+		Header: utils.HeaderName(d.Position().Filename),
+	}
+
+	if ft, _ := funcType(t); ft != nil {
+		// Described by the callbacks table.
+		w32type.Kind = entity.TypeKindFunc
+		return w32type
+	}
+
+	direct := d.Pointer == nil && d.DirectDeclarator != nil &&
+		d.DirectDeclarator.Case == cc.DirectDeclaratorIdent
+	if !direct {
+		w32type.Target = typeName(t, true)
+		return w32type
+	}
+
+	switch t.(type) {
+	case *cc.StructType, *cc.UnionType, *cc.EnumType:
+		if tagName(t) == "" {
+			def := taggedType(t)
+			def.Name = w32type.Name
+			def.Header = w32type.Header
+			return def
+		}
+		w32type.Target = typeName(t, true)
+	default:
+		// The typedef name of the target got replaced by the new one, get it
+		// back from the declaration specifiers.
+		w32type.Target = specTypeName(ds)
+		if w32type.Target == "" {
+			w32type.Target = typeName(t, true)
+		}
+	}
+	return w32type
+}
+
+// registerTagged adds a complete tagged structure, union or enumeration to
+// the types table.
+func registerTagged(types map[string]entity.W32Type, t cc.Type) {
+	if t == nil || t.IsIncomplete() || tagName(t) == "" {
+		return
+	}
+	switch t.(type) {
+	case *cc.StructType, *cc.UnionType, *cc.EnumType:
+	default:
+		return
+	}
+	name := typeName(t, true)
+	if _, ok := types[name]; ok {
+		return
+	}
+	types[name] = taggedType(t)
+}
+
+// taggedType describes the layout of a structure or union, or the values of
+// an enumeration.
+func taggedType(t cc.Type) entity.W32Type {
+
+	w32type := entity.W32Type{Name: typeName(t, true), Size: t.Size()}
+
+	switch x := t.(type) {
+	case *cc.StructType:
+		w32type.Kind = entity.TypeKindStruct
+		tag := x.Tag()
+		w32type.Header = headerOf(tag)
+		w32type.Members = members(x)
+	case *cc.UnionType:
+		w32type.Kind = entity.TypeKindUnion
+		tag := x.Tag()
+		w32type.Header = headerOf(tag)
+		w32type.Members = members(x)
+	case *cc.EnumType:
+		w32type.Kind = entity.TypeKindEnum
+		tag := x.Tag()
+		w32type.Header = headerOf(tag)
+		for _, e := range x.Enumerators() {
+			var value int64
+			switch v := e.Value().(type) {
+			case cc.Int64Value:
+				value = int64(v)
+			case cc.UInt64Value:
+				value = int64(v)
+			}
+			w32type.Values = append(w32type.Values, entity.W32EnumValue{
+				Name: e.Token.SrcStr(), Value: value})
+		}
+	}
+	return w32type
+}
+
+// members returns the fields of a structure or union, anonymous nested
+// structures and unions are described inline.
+func members(t fielder) []entity.W32TypeMember {
+	var m []entity.W32TypeMember
+	for i := 0; i < t.NumFields(); i++ {
+		f := t.FieldByIndex(i)
+		ft := f.Type()
+		member := entity.W32TypeMember{
+			Name:   f.Name(),
+			Type:   typeName(ft, false),
+			Offset: f.Offset(),
+			Size:   ft.Size(),
+		}
+		if f.IsBitfield() {
+			member.Bits = f.ValueBits()
+			member.BitOffset = f.OffsetBits()
+		}
+		if nested, ok := ft.(fielder); ok && ft.Typedef() == nil && tagName(ft) == "" {
+			def := taggedType(nested)
+			def.Name = ""
+			member.Type = def.Kind
+			member.Def = &def
+		}
+		m = append(m, member)
+	}
+	return m
+}
+
+// typeName returns the C spelling of a type, using typedef names when
+// available. When top is set, the typedef name of t itself is ignored.
+func typeName(t cc.Type, top bool) string {
+	if !top {
+		if td := t.Typedef(); td != nil {
+			return td.Name()
+		}
+	}
+
+	switch x := t.(type) {
+	case *cc.PointerType:
+		return typeName(x.Elem(), false) + "*"
+	case *cc.ArrayType:
+		return fmt.Sprintf("%s[%d]", typeName(x.Elem(), false), x.Len())
+	case *cc.StructType:
+		return strings.TrimSpace("struct " + tagName(t))
+	case *cc.UnionType:
+		return strings.TrimSpace("union " + tagName(t))
+	case *cc.EnumType:
+		return strings.TrimSpace("enum " + tagName(t))
+	}
+	return t.String()
+}
+
+// tagName returns the tag of a structure, union or enumeration.
+func tagName(t cc.Type) string {
+	var tag cc.Token
+	switch x := t.(type) {
+	case *cc.StructType:
+		tag = x.Tag()
+	case *cc.UnionType:
+		tag = x.Tag()
+	case *cc.EnumType:
+		tag = x.Tag()
+	}
+	return tag.SrcStr()
+}
+
+// specTypeName returns the type spelled by declaration specifiers, i.e:
+// ULONG or unsigned long, without the qualifiers.
+func specTypeName(ds *cc.DeclarationSpecifiers) string {
+	var words []string
+	for ; ds != nil; ds = ds.DeclarationSpecifiers {
+		if ds.Case != cc.DeclarationSpecifiersTypeSpec || ds.TypeSpecifier == nil {
+			continue
+		}
+		ts := ds.TypeSpecifier
+		switch ts.Case {
+		case cc.TypeSpecifierTypeName:
+			return ts.Token.SrcStr()
+		case cc.TypeSpecifierStructOrUnion, cc.TypeSpecifierEnum:
+			return ""
+		default:
+			words = append(words, ts.Token.SrcStr())
+		}
+	}
+	return strings.Join(words, " ")
+}
+
+func headerOf(tok cc.Token) string {
+	filename := tok.Position().Filename
+	if filename == "" {
+		return ""
+	}
+	return utils.HeaderName(filename)
+}
+
+// declaredFunctions returns the functions declared by the headers, mapped to
+// the header declaring them.
+func declaredFunctions(ast *cc.AST) map[string]string {
+	functions := make(map[string]string)
+	for name, nodes := range ast.Scope.Nodes {
+		if strings.HasPrefix(name, "__builtin_") {
+			continue
+		}
+		for _, node := range nodes {
+			d, ok := node.(*cc.Declarator)
+			if !ok || d.IsTypename() || strings.HasPrefix(d.Position().Filename, "<") {
+				continue
+			}
+			if _, ok := d.Type().(*cc.FunctionType); !ok {
+				continue
+			}
+			functions[name] = utils.HeaderName(d.Position().Filename)
+			break
+		}
+	}
+	return functions
+}
@@ -0,0 +1,249 @@
+// Copyright 2018 Saferwall. All rights reserved.
+// Use of this source code is governed by Apache v2 license
+// license that can be found in the LICENSE file.
+
+// Package winsdk translates the Windows SDK headers into a model of the
+// Win32 APIs, types, callbacks, COM interfaces, GUIDs and control codes they
+// declare.
+//
+//	db, err := winsdk.Parse(ctx, winsdk.Options{
+//		Include: "./winsdk/10.0.22000.0",
+//		Docs:    "./sdk-api",
+//		Sources: []winsdk.Source{{Name: "assets/header.h"}},
+//	})
+package winsdk
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/saferwall/winsdk2json/internal/analysis"
+	"github.com/saferwall/winsdk2json/internal/entity"
+	"github.com/saferwall/winsdk2json/internal/overlay"
+	"github.com/saferwall/winsdk2json/internal/utils"
+)
+
+// Header profiles.
+const (
+	ProfileUser   = "user"   // The Win32 API headers.
+	ProfileKernel = "kernel" // The ntoskrnl, hal and fltmgr headers.
+)
+
+// Merge precedences.
+const (
+	PrecedenceFirst = analysis.PrecedenceFirst // The definition of the first source is kept.
+	PrecedenceLast  = analysis.PrecedenceLast  // The definition of the last source is kept.
+)
+
+// The model of the headers.
+type (
+	API          = entity.W32API
+	APIParam     = entity.W32APIParam
+	RetSemantics = entity.W32APIRetSemantics
+	RetCheck     = entity.W32APIRetCheck
+	IRQL         = entity.W32IRQL
+	Type         = entity.W32Type
+	TypeMember   = entity.W32TypeMember
+	EnumValue    = entity.W32EnumValue
+	Callback     = entity.W32Callback
+	Interface    = entity.W32Interface
+	Method       = entity.W32Method
+	GUID         = entity.W32GUID
+	IOCTL        = entity.W32IOCTL
+	IOCTLCatalog = entity.W32IOCTLCatalog
+	Diagnostic   = entity.W32Diagnostic
+	Skipped      = entity.W32Skipped
+	Conflict     = entity.W32Conflict
+	PatchStatus  = overlay.PatchStatus
+	MergeRule    = analysis.MergeRule
+)
+
+// ErrNoSources is returned by Parse when there is nothing to translate.
+var ErrNoSources = errors.New("no sources to translate")
+
+// TranslateError is returned by Parse when cc fails to translate a source.
+type TranslateError struct {
+	// The source, or the source and architecture of a pass translating the
+	// types for another one.
+	Unit string
+	// The declarations skipped before giving up in resilient mode.
+	Diagnostics []Diagnostic
+	Err         error
+}
+
+func (e *TranslateError) Error() string {
+	return fmt.Sprintf("translating %s failed: %v", e.Unit, e.Err)
+}
+
+func (e *TranslateError) Unwrap() error {
+	return e.Err
+}
+
+// Source is a translation unit, usually a file including the headers.
+type Source struct {
+	// The path of the source, it identifies it in the diagnostics and the
+	// merge rules.
+	Name string
+	// The content of the source, read from Name when nil.
+	Code []byte
+}
+
+// Merge tells which definition is kept when several sources define the same
+// API, type, callback, interface, GUID or control code.
+type Merge struct {
+	// PrecedenceFirst or PrecedenceLast, defaults to the first.
+	Precedence string
+	// Rules overriding the precedence, the first matching one applies.
+	Rules []MergeRule
+}
+
+// Options configures a translation.
+type Options struct {
+	// The Windows Kits directory, its Include directory or the include
+	// directory of a single version, i.e: Include/10.0.22000.0.
+	Include string
+	// The SDK version, defaults to the newest one.
+	SDKVersion string
+	// The directory holding the MSVC toolsets, defaults to the SDK one.
+	MSVC string
+	// The MSVC toolset version, defaults to the newest one.
+	Toolset string
+	// The sdk-api docs directory, giving the DLL of the Win32 APIs.
+	Docs string
+	// The phnt headers directory, the Windows version they target, i.e:
+	// WIN11 or 114, and their mode: user, the default, or kernel.
+	Phnt        string
+	PhntVersion string
+	PhntMode    string
+	// The architecture: amd64, the default, 386 or arm64.
+	Arch string
+	// Other architectures to translate the types of the first source for,
+	// they are returned in Database.ArchTypes.
+	ExtraArchs []string
+	// The headers profile: ProfileUser, the default, or ProfileKernel.
+	Profile string
+	// The NTDDI_VERSION, i.e: WIN10_RS5 or 0x0A000006.
+	NTDDIVersion string
+	// Extra macros to predefine, either NAME or NAME=VALUE.
+	Macros []string
+	// Extra directories searched first by #include "...".
+	IncludePaths []string
+	// The translation units, translated concurrently and merged.
+	Sources []Source
+	Merge   Merge
+	// A directory of YAML files patching the headers in memory.
+	Patches string
+	// Skip the declarations cc fails on instead of failing, they are listed
+	// in Database.Diagnostics.
+	Resilient bool
+	// The number of translations running at once, defaults to the number
+	// of CPUs. Each one holds its AST in memory.
+	Jobs int
+	// The directory caching the translated models, the cache is disabled
+	// when empty.
+	CacheDir string
+	// Only extract the types and the declared functions.
+	TypesOnly bool
+	// Receives the AST of the first source, when set.
+	DumpAST io.Writer
+	// Receives the progress messages, one per line: cache hits, skipped
+	// declarations, ambiguous includes ... They are discarded when nil.
+	Log io.Writer
+}
+
+// Database is the model of the translated headers.
+type Database struct {
+	// The Windows SDK version and MSVC toolset translated.
+	SDKVersion string               `json:"sdk_version,omitempty"`
+	Toolset    string               `json:"toolset,omitempty"`
+	APIs       []API                `json:"apis"`
+	Types      map[string]Type      `json:"types"`
+	Callbacks  map[string]Callback  `json:"callbacks"`
+	Interfaces map[string]Interface `json:"interfaces"`
+	GUIDs      []GUID               `json:"guids"`
+	IOCTLs     IOCTLCatalog         `json:"ioctls"`
+	// The functions declared by the headers, inline ones included, mapped
+	// to the header declaring them.
+	Functions map[string]string `json:"functions"`
+	// The types of the first source for Options.ExtraArchs.
+	ArchTypes map[string]map[string]Type `json:"arch_types,omitempty"`
+	// The errors recovered from in resilient mode.
+	Diagnostics []Diagnostic `json:"diagnostics"`
+	// The definitions differing between the sources, when there are
+	// several.
+	Conflicts []Conflict `json:"conflicts,omitempty"`
+	// Whether each patch still applies.
+	Patches []PatchStatus `json:"patches,omitempty"`
+}
+
+// Parse translates the sources of the options, along with the types of the
+// first one for the extra architectures, and merges them. The translations
+// not started yet are skipped once the context is done.
+func Parse(ctx context.Context, opts Options) (*Database, error) {
+
+	s, err := newSession(opts)
+	if err != nil {
+		return nil, err
+	}
+	defer s.fs.Close()
+
+	codes := make([][]byte, len(opts.Sources))
+	for i, source := range opts.Sources {
+		codes[i] = source.Code
+		if codes[i] == nil {
+			if codes[i], err = os.ReadFile(source.Name); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// The results are stored by index, and merged in the sources order.
+	units := make([]*Database, len(opts.Sources))
+	archs := make([]*Database, len(opts.ExtraArchs))
+	err = utils.Parallel(ctx, len(units)+len(archs), opts.Jobs, func(i int) error {
+		var err error
+		if i < len(units) {
+			units[i], err = s.translate(opts.Sources[i].Name, s.arch, codes[i], s.typesOnly)
+			return err
+		}
+		i -= len(units)
+		arch := opts.ExtraArchs[i]
+		archs[i], err = s.translate(opts.Sources[0].Name+" "+arch, arch, codes[0], true)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	db := units[0]
+	if len(units) > 1 {
+		var conflicts []Conflict
+		db, conflicts = mergeDatabases(units, opts.merger())
+		db.Conflicts = append([]Conflict{}, conflicts...)
+	}
+	for i, arch := range opts.ExtraArchs {
+		if db.ArchTypes == nil {
+			db.ArchTypes = make(map[string]map[string]Type)
+		}
+		db.ArchTypes[arch] = archs[i].Types
+		db.Diagnostics = append(db.Diagnostics, archs[i].Diagnostics...)
+	}
+	db.SDKVersion = s.sdkVersion
+	db.Toolset = s.toolsetVersion
+	if s.patches != nil {
+		db.Patches = s.patches.Report()
+	}
+	return db, nil
+}
+
+// merger returns the merger of the sources.
+func (opts Options) merger() *analysis.Merger {
+	m := &analysis.Merger{Precedence: opts.Merge.Precedence, Rules: opts.Merge.Rules}
+	for _, source := range opts.Sources {
+		m.Sources = append(m.Sources, source.Name)
+	}
+	return m
+}
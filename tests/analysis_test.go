@@ -0,0 +1,1806 @@
+// Copyright 2018 Saferwall. All rights reserved.
+// Use of this source code is governed by Apache v2 license
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/saferwall/winsdk2json/internal/analysis"
+	"github.com/saferwall/winsdk2json/internal/cache"
+	"github.com/saferwall/winsdk2json/internal/config"
+	"github.com/saferwall/winsdk2json/internal/entity"
+	"github.com/saferwall/winsdk2json/internal/overlay"
+	"github.com/saferwall/winsdk2json/internal/sdk"
+	"github.com/saferwall/winsdk2json/internal/utils"
+	"github.com/saferwall/winsdk2json/internal/vfs"
+	"github.com/saferwall/winsdk2json/pkg/winsdk"
+)
+
+var classifyReturnTests = []struct {
+	api entity.W32API
+	doc string
+	out entity.W32APIRetSemantics
+}{
+	{entity.W32API{Name: "CreateFileW", RetType: "HANDLE"},
+		"If the function fails, the return value is <b>INVALID_HANDLE_VALUE</b>. To get extended error information, call <a href=\"/windows/desktop/api/errhandlingapi/nf-errhandlingapi-getlasterror\">GetLastError</a>.",
+		entity.W32APIRetSemantics{Kind: entity.RetKindHandle, SetsLastError: true, Source: entity.RetSourceDoc,
+			Failure: &entity.W32APIRetCheck{Op: "==", Value: -1, Symbol: "INVALID_HANDLE_VALUE"}}},
+	{entity.W32API{Name: "OpenProcess", RetType: "HANDLE"}, "",
+		entity.W32APIRetSemantics{Kind: entity.RetKindHandle, SetsLastError: true, Source: entity.RetSourceType,
+			Failure: &entity.W32APIRetCheck{Op: "==", Value: 0, Symbol: "NULL"}}},
+	{entity.W32API{Name: "RegOpenKeyExW", RetType: "LSTATUS"}, "",
+		entity.W32APIRetSemantics{Kind: entity.RetKindErrCode, Source: entity.RetSourceType,
+			Failure: &entity.W32APIRetCheck{Op: "!=", Value: 0, Symbol: "ERROR_SUCCESS"}}},
+	{entity.W32API{Name: "RegGetValueW", RetType: "WIN32_ERROR"}, "",
+		entity.W32APIRetSemantics{Kind: entity.RetKindErrCode, Source: entity.RetSourceType,
+			Failure: &entity.W32APIRetCheck{Op: "!=", Value: 0, Symbol: "ERROR_SUCCESS"}}},
+	{entity.W32API{Name: "CoCreateInstance", RetType: "HRESULT"}, "",
+		entity.W32APIRetSemantics{Kind: entity.RetKindHRESULT, Source: entity.RetSourceType,
+			Failure: &entity.W32APIRetCheck{Op: "<", Value: 0}}},
+	{entity.W32API{Name: "ReadFile", RetType: "BOOL", Success: "return != FALSE"}, "",
+		entity.W32APIRetSemantics{Kind: entity.RetKindBool, SetsLastError: true, Source: entity.RetSourceAnno,
+			Failure: &entity.W32APIRetCheck{Op: "==", Value: 0, Symbol: "FALSE"}}},
+	{entity.W32API{Name: "GetFileAttributesW", RetType: "DWORD"},
+		"If the function fails, the return value is <b>INVALID_FILE_ATTRIBUTES</b>. To get extended error information, call <b>GetLastError</b>.",
+		entity.W32APIRetSemantics{Kind: entity.RetKindValue, SetsLastError: true, Source: entity.RetSourceDoc,
+			Failure: &entity.W32APIRetCheck{Op: "==", Value: 0xFFFFFFFF, Symbol: "INVALID_FILE_ATTRIBUTES"}}},
+	{entity.W32API{Name: "GetModuleFileNameW", RetType: "DWORD"},
+		"If the function fails, the return value is 0 (zero). To get extended error information, call GetLastError.",
+		entity.W32APIRetSemantics{Kind: entity.RetKindValue, SetsLastError: true, Source: entity.RetSourceDoc,
+			Failure: &entity.W32APIRetCheck{Op: "==", Value: 0}}},
+	{entity.W32API{Name: "Sleep", RetType: "void"}, "",
+		entity.W32APIRetSemantics{Kind: entity.RetKindVoid, Source: entity.RetSourceType}},
+}
+
+func TestClassifyReturn(t *testing.T) {
+	for _, tt := range classifyReturnTests {
+		t.Run(tt.api.Name, func(t *testing.T) {
+			got := analysis.ClassifyReturn(tt.api, tt.doc)
+			if !reflect.DeepEqual(*got, tt.out) {
+				t.Errorf("TestClassifyReturn(%s) got %+v, want %+v", tt.api.Name, got, tt.out)
+			}
+		})
+	}
+}
+
+func TestBuildLifetimes(t *testing.T) {
+	apis := []entity.W32API{
+		{Name: "CreateFileW", RetType: "HANDLE"},
+		{Name: "FindFirstFileW", RetType: "HANDLE"},
+		{Name: "CloseHandle", RetType: "BOOL", Params: []entity.W32APIParam{
+			{Annotation: "_In_", Post: "_Post_ptr_invalid_", Type: "HANDLE", Name: "hObject"}}},
+		{Name: "ReadFile", RetType: "BOOL", Params: []entity.W32APIParam{
+			{Annotation: "_In_", Type: "HANDLE", Name: "hFile"}}},
+		{Name: "RegOpenKeyExW", RetType: "LSTATUS", Params: []entity.W32APIParam{
+			{Annotation: "_In_", Type: "HKEY", Name: "hKey"},
+			{Annotation: "_Out_", Type: "PHKEY", Name: "phkResult"}}},
+		{Name: "RegCloseKey", RetType: "LSTATUS", Params: []entity.W32APIParam{
+			{Annotation: "_In_", Type: "HKEY", Name: "hKey"}}},
+		{Name: "InternetOpenW", RetType: "HINTERNET"},
+		{Name: "InternetCloseHandle", RetType: "BOOL", Params: []entity.W32APIParam{
+			{Annotation: "_In_", Type: "HINTERNET", Name: "hInternet"}}},
+		{Name: "GetModuleHandleW", RetType: "HMODULE"},
+		{Name: "CreateWidget", RetType: "HWIDGET"},
+	}
+
+	want := map[string]*entity.Lifetime{
+		"HANDLE": {
+			Type: "HANDLE",
+			Producers: []entity.LifetimeProducer{
+				{API: "CreateFileW", ReleasedBy: []string{"CloseHandle"}},
+				{API: "FindFirstFileW", ReleasedBy: []string{"FindClose"}},
+			},
+			Consumers:   []string{"ReadFile"},
+			Destructors: []string{"CloseHandle"},
+		},
+		"HKEY": {
+			Type: "HKEY",
+			Producers: []entity.LifetimeProducer{
+				{API: "RegOpenKeyExW", Param: "phkResult", ReleasedBy: []string{"RegCloseKey"}},
+			},
+			Consumers:   []string{"RegOpenKeyExW"},
+			Destructors: []string{"RegCloseKey"},
+		},
+		"HINTERNET": {
+			Type: "HINTERNET",
+			Producers: []entity.LifetimeProducer{
+				{API: "InternetOpenW", ReleasedBy: []string{"InternetCloseHandle"}},
+			},
+			Destructors: []string{"InternetCloseHandle"},
+		},
+		"HMODULE": {
+			Type:      "HMODULE",
+			Producers: []entity.LifetimeProducer{{API: "GetModuleHandleW", Borrowed: true}},
+		},
+		"HWIDGET": {
+			Type:      "HWIDGET",
+			Producers: []entity.LifetimeProducer{{API: "CreateWidget"}},
+		},
+	}
+
+	got := analysis.BuildLifetimes(apis)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("TestBuildLifetimes() got %v, want %v", got, want)
+	}
+
+	// A borrowed handle and one whose releaser is unknown differ once
+	// serialized.
+	borrowed, _ := json.Marshal(got["HMODULE"].Producers[0])
+	unknown, _ := json.Marshal(got["HWIDGET"].Producers[0])
+	if string(borrowed) != `{"api":"GetModuleHandleW","borrowed":true}` || string(unknown) != `{"api":"CreateWidget"}` {
+		t.Errorf("producers serialized as %s and %s", borrowed, unknown)
+	}
+}
+
+func TestBuildTypeClosure(t *testing.T) {
+	types := map[string]entity.W32Type{
+		"LPFILETIME": {Name: "LPFILETIME", Kind: entity.TypeKindTypedef, Target: "struct _FILETIME*"},
+		"struct _FILETIME": {Name: "struct _FILETIME", Kind: entity.TypeKindStruct, Members: []entity.W32TypeMember{
+			{Name: "dwLowDateTime", Type: "DWORD"},
+			{Name: "dwHighDateTime", Type: "DWORD"}}},
+		"DWORD":                  {Name: "DWORD", Kind: entity.TypeKindTypedef, Target: "unsigned long"},
+		"HANDLE":                 {Name: "HANDLE", Kind: entity.TypeKindTypedef, Target: "void*"},
+		"BOOL":                   {Name: "BOOL", Kind: entity.TypeKindTypedef, Target: "int"},
+		"UNUSED":                 {Name: "UNUSED", Kind: entity.TypeKindTypedef, Target: "int"},
+		"LPTHREAD_START_ROUTINE": {Name: "LPTHREAD_START_ROUTINE", Kind: entity.TypeKindFunc},
+		"LPVOID":                 {Name: "LPVOID", Kind: entity.TypeKindTypedef, Target: "void*"},
+	}
+	callbacks := map[string]entity.W32Callback{
+		"LPTHREAD_START_ROUTINE": {Name: "LPTHREAD_START_ROUTINE", RetType: "DWORD", Params: []entity.W32APIParam{
+			{Annotation: "_In_", Type: "LPVOID", Name: "lpThreadParameter"}}},
+	}
+	apis := []entity.W32API{
+		{Name: "GetFileTime", RetType: "BOOL", Params: []entity.W32APIParam{
+			{Type: "HANDLE", Name: "hFile"},
+			{Type: "LPFILETIME", Name: "lpCreationTime"},
+			{Type: "PLARGE_INTEGER", Name: "lpFileSize"}}},
+		{Name: "CreateThread", RetType: "HANDLE", Params: []entity.W32APIParam{
+			{Type: "LPTHREAD_START_ROUTINE", Name: "lpStartAddress", Callback: "LPTHREAD_START_ROUTINE"}}},
+	}
+
+	got := analysis.BuildTypeClosure(apis, types, callbacks)
+	var names []string
+	for _, typ := range got.Types {
+		names = append(names, typ.Name)
+	}
+	want := []string{"BOOL", "DWORD", "HANDLE", "LPFILETIME", "LPTHREAD_START_ROUTINE", "LPVOID", "struct _FILETIME"}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("TestBuildTypeClosure() got types %v, want %v", names, want)
+	}
+	if !reflect.DeepEqual(got.Unresolved, []string{"PLARGE_INTEGER"}) {
+		t.Errorf("TestBuildTypeClosure() got unresolved %v, want [PLARGE_INTEGER]", got.Unresolved)
+	}
+}
+
+func TestInferBaseInterfaces(t *testing.T) {
+	methods := func(names ...string) []entity.W32Method {
+		var m []entity.W32Method
+		for i, name := range names {
+			m = append(m, entity.W32Method{Index: i, Name: name})
+		}
+		return m
+	}
+	ifaces := map[string]entity.W32Interface{
+		"IUnknown":   {Name: "IUnknown", Methods: methods("QueryInterface", "AddRef", "Release")},
+		"IDispatch":  {Name: "IDispatch", Methods: methods("QueryInterface", "AddRef", "Release", "GetTypeInfoCount")},
+		"IDispatch2": {Name: "IDispatch2", Methods: methods("QueryInterface", "AddRef", "Release", "GetTypeInfoCount", "Invoke")},
+		"IPersist":   {Name: "IPersist", Base: "IUnknown", Methods: methods("QueryInterface", "AddRef", "Release", "GetClassID")},
+	}
+
+	analysis.InferBaseInterfaces(ifaces)
+	want := map[string]string{"IUnknown": "", "IDispatch": "IUnknown", "IDispatch2": "IDispatch", "IPersist": "IUnknown"}
+	for name, base := range want {
+		if got := ifaces[name].Base; got != base {
+			t.Errorf("TestInferBaseInterfaces(%s) got %q, want %q", name, got, base)
+		}
+	}
+}
+
+func TestGUIDCatalog(t *testing.T) {
+	c := analysis.NewGUIDCatalog([]entity.W32GUID{
+		{GUID: "4590F811-1D3A-11D0-891F-00AA004B2E24", Name: "CLSID_WbemLocator", Header: "WbemCli.h"},
+		{GUID: "00000000-0000-0000-C000-000000000046", Name: "IID_IUnknown", Header: "Unknwn.h"},
+	})
+
+	if name, _ := c.Lookup("{4590f811-1d3a-11d0-891f-00aa004b2e24}"); name != "CLSID_WbemLocator" {
+		t.Errorf("TestGUIDCatalog() Lookup got %q, want CLSID_WbemLocator", name)
+	}
+	raw := []byte{0, 0, 0, 0, 0, 0, 0, 0, 0xc0, 0, 0, 0, 0, 0, 0, 0x46}
+	if name, _ := c.LookupBytes(raw); name != "IID_IUnknown" {
+		t.Errorf("TestGUIDCatalog() LookupBytes got %q, want IID_IUnknown", name)
+	}
+	if _, ok := c.Lookup("11111111-2222-3333-4444-555555555555"); ok {
+		t.Errorf("TestGUIDCatalog() Lookup found an unknown GUID")
+	}
+}
+
+func TestDecodeIOCTL(t *testing.T) {
+	deviceTypes := map[uint32]string{9: "FILE_DEVICE_FILE_SYSTEM"}
+	got := analysis.DecodeIOCTL(0x000900A8, deviceTypes)
+	want := entity.W32IOCTL{Code: 0x000900A8, DeviceType: 9, DeviceTypeName: "FILE_DEVICE_FILE_SYSTEM",
+		Function: 42, Method: "METHOD_BUFFERED", Access: "FILE_ANY_ACCESS"}
+	if got != want {
+		t.Errorf("TestDecodeIOCTL() got %+v, want %+v", got, want)
+	}
+
+	got = analysis.DecodeIOCTL(0x0022C007, nil)
+	want = entity.W32IOCTL{Code: 0x0022C007, DeviceType: 0x22, Function: 1,
+		Method: "METHOD_NEITHER", Access: "FILE_READ_ACCESS | FILE_WRITE_ACCESS"}
+	if got != want {
+		t.Errorf("TestDecodeIOCTL() got %+v, want %+v", got, want)
+	}
+}
+
+func TestIndexes(t *testing.T) {
+	// The services decoding the runtime values read the model back.
+	var db winsdk.Database
+	data := `{"guids": [{"guid": "00000000-0000-0000-C000-000000000046", "name": "IID_IUnknown", "header": "Unknwn.h"}],
+		"ioctls": {"device_types": {"9": "FILE_DEVICE_FILE_SYSTEM"},
+			"codes": [{"code": 589992, "name": "FSCTL_GET_REPARSE_POINT", "device_type": 9, "function": 42}]}}`
+	if err := json.Unmarshal([]byte(data), &db); err != nil {
+		t.Fatal(err)
+	}
+
+	raw := []byte{0, 0, 0, 0, 0, 0, 0, 0, 0xc0, 0, 0, 0, 0, 0, 0, 0x46}
+	if name, ok := db.GUIDIndex().LookupBytes(raw); !ok || name != "IID_IUnknown" {
+		t.Errorf("GUIDIndex().LookupBytes() got %q, %v, want IID_IUnknown", name, ok)
+	}
+	if guid, _ := winsdk.GUIDFromBytes(raw); guid != "00000000-0000-0000-C000-000000000046" {
+		t.Errorf("GUIDFromBytes() got %s", guid)
+	}
+
+	ioctls := db.IOCTLIndex()
+	if name, ok := ioctls.Lookup(0x000900A8); !ok || name != "FSCTL_GET_REPARSE_POINT" {
+		t.Errorf("IOCTLIndex().Lookup() got %q, %v, want FSCTL_GET_REPARSE_POINT", name, ok)
+	}
+	if got := ioctls.Decode(0x000900AC); got.DeviceTypeName != "FILE_DEVICE_FILE_SYSTEM" || got.Function != 43 || got.Name != "" {
+		t.Errorf("IOCTLIndex().Decode() got %+v", got)
+	}
+	if got := winsdk.DecodeIOCTL(0x0022C007, nil); got.Method != "METHOD_NEITHER" {
+		t.Errorf("DecodeIOCTL() got %+v", got)
+	}
+}
+
+func TestNativeAPIs(t *testing.T) {
+	dlls := map[string]string{
+		"NtCreateFile":            "ntdll.dll",
+		"ZwClose":                 "ntdll.dll",
+		"RtlAllocateHeap":         "ntdll.dll",
+		"LdrLoadDll":              "ntdll.dll",
+		"NtUserSetWindowsHookEx":  "win32u.dll",
+		"NtGdiBitBlt":             "win32u.dll",
+		"SamConnect":              "samlib.dll",
+		"WinStationEnumerateW":    "winsta.dll",
+		"Ntohs":                   "",
+		"PhGetProcessInformation": "",
+	}
+	for name, want := range dlls {
+		if got := analysis.NativeDLL(name); got != want {
+			t.Errorf("NativeDLL(%s) got %q, want %q", name, got, want)
+		}
+	}
+
+	apis := []entity.W32API{{Name: "NtClose"}, {Name: "ZwClose"}, {Name: "ZwNotDeclared"}}
+	analysis.LinkNativeAliases(apis)
+	if apis[1].Alias != "NtClose" || apis[0].Alias != "" || apis[2].Alias != "" {
+		t.Errorf("LinkNativeAliases() got %+v", apis)
+	}
+}
+
+func TestBuildStructLayout(t *testing.T) {
+	peb := func(size int64, members ...entity.W32TypeMember) entity.W32Type {
+		return entity.W32Type{Name: "struct _PEB", Kind: entity.TypeKindStruct, Size: size, Members: members}
+	}
+	targets := []analysis.LayoutTarget{
+		{Name: "WIN7/amd64", Def: peb(0x380,
+			entity.W32TypeMember{Name: "BeingDebugged", Type: "BOOLEAN", Offset: 2, Size: 1},
+			entity.W32TypeMember{Name: "Ldr", Type: "PPEB_LDR_DATA", Offset: 0x18, Size: 8})},
+		{Name: "WIN10/amd64", Def: peb(0x7c8,
+			entity.W32TypeMember{Name: "BeingDebugged", Type: "BOOLEAN", Offset: 2, Size: 1},
+			entity.W32TypeMember{Name: "Ldr", Type: "PPEB_LDR_DATA", Offset: 0x18, Size: 8},
+			entity.W32TypeMember{Type: "union", Offset: 0x7b8, Size: 8, Def: &entity.W32Type{Kind: entity.TypeKindUnion,
+				Members: []entity.W32TypeMember{{Name: "LeapSecondFlags", Type: "ULONG", Size: 4}}}})},
+		{Name: "WIN7/386", Def: peb(0x248,
+			entity.W32TypeMember{Name: "BeingDebugged", Type: "BOOLEAN", Offset: 2, Size: 1},
+			entity.W32TypeMember{Name: "Ldr", Type: "PPEB_LDR_DATA", Offset: 0xc, Size: 4})},
+	}
+
+	got := analysis.BuildStructLayout("PEB", targets)
+	if len(got.Members) != 3 {
+		t.Fatalf("TestBuildStructLayout() got %d members, want 3", len(got.Members))
+	}
+	if ldr := got.Members[1]; ldr.Layouts["WIN7/386"].Offset != 0xc || len(ldr.Changes) != 0 {
+		t.Errorf("TestBuildStructLayout() got Ldr %+v", ldr)
+	}
+	leap := got.Members[2]
+	want := []string{"added in WIN10/amd64 at 0x7b8"}
+	if leap.Name != "LeapSecondFlags" || !reflect.DeepEqual(leap.Changes, want) {
+		t.Errorf("TestBuildStructLayout() got %+v, want changes %v", leap, want)
+	}
+}
+
+func TestKernelImage(t *testing.T) {
+	tests := []struct {
+		name, header, decl, want string
+	}{
+		{"KeBugCheck", "wdm.h", "_IRQL_requires_max_(HIGH_LEVEL) NTKERNELAPI DECLSPEC_NORETURN VOID", "ntoskrnl.exe"},
+		{"KeStallExecutionProcessor", "wdm.h", "_IRQL_requires_max_(HIGH_LEVEL) NTHALAPI VOID", "hal.dll"},
+		{"FltRegisterFilter", "fltKernel.h", "_Must_inspect_result_ _IRQL_requires_max_(APC_LEVEL) NTSTATUS FLTAPI", "fltmgr.sys"},
+		{"FltGetVolumeName", "fltKernel.h", "NTSTATUS", "fltmgr.sys"},
+		{"HalGetBusData", "ntddk.h", "ULONG", "hal.dll"},
+		{"ZwClose", "wdm.h", "_IRQL_requires_max_(PASSIVE_LEVEL) NTSYSAPI NTSTATUS NTAPI", "ntoskrnl.exe"},
+	}
+	for _, tt := range tests {
+		if got := analysis.KernelImage(tt.name, tt.header, tt.decl); got != tt.want {
+			t.Errorf("KernelImage(%s) got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestBuildMinVersions(t *testing.T) {
+	point := entity.W32Type{Name: "POINT", Kind: entity.TypeKindStruct,
+		Members: []entity.W32TypeMember{{Name: "x", Type: "LONG"}}}
+	point2 := point
+	point2.Members = append(point2.Members, entity.W32TypeMember{Name: "y", Type: "LONG", Offset: 4})
+	mode := entity.W32Type{Name: "MODE", Kind: entity.TypeKindEnum,
+		Values: []entity.W32EnumValue{{Name: "MODE_A"}}}
+	mode2 := mode
+	mode2.Values = append(mode2.Values, entity.W32EnumValue{Name: "MODE_B", Value: 1})
+
+	passes := []analysis.VersionPass{
+		{Name: "WIN7", NTDDI: 0x06010000,
+			Functions: map[string]string{"CreateFileW": "fileapi.h"},
+			Types:     map[string]entity.W32Type{"POINT": point, "MODE": mode}},
+		{Name: "WIN8", NTDDI: 0x06020000,
+			Functions: map[string]string{"CreateFileW": "fileapi.h", "CreateFile2": "fileapi.h"},
+			Types:     map[string]entity.W32Type{"POINT": point2, "MODE": mode2}},
+	}
+	mv := analysis.BuildMinVersions(passes)
+	analysis.CrossCheckMinVersions(&mv, passes, map[string]string{
+		"CreateFileW": "Windows XP [desktop apps | UWP apps]",
+		"CreateFile2": "Windows 10, version 1809 [desktop apps | UWP apps]",
+	})
+
+	want := entity.W32MinVersions{
+		Versions: []string{"WIN7", "WIN8"},
+		APIs: []entity.W32MinVersion{
+			{Name: "CreateFile2", Header: "fileapi.h", Version: "WIN8",
+				Documented: "Windows 10, version 1809 [desktop apps | UWP apps]"},
+			{Name: "CreateFileW", Header: "fileapi.h", Version: "WIN7",
+				Documented: "Windows XP [desktop apps | UWP apps]"},
+		},
+		Types:   []entity.W32MinVersion{{Name: "MODE", Version: "WIN7"}, {Name: "POINT", Version: "WIN7"}},
+		Members: []entity.W32MinVersion{{Name: "POINT.y", Version: "WIN8"}},
+		Values:  []entity.W32MinVersion{{Name: "MODE_B", Version: "WIN8"}},
+	}
+	if !reflect.DeepEqual(mv, want) {
+		t.Errorf("BuildMinVersions() got %+v, want %+v", mv, want)
+	}
+
+	// Documented in Windows 8.1, translated first in Windows 7.
+	mv.APIs[1].Documented = ""
+	analysis.CrossCheckMinVersions(&mv, passes, map[string]string{"CreateFileW": "Windows 8.1"})
+	if !mv.APIs[1].Mismatch {
+		t.Errorf("CrossCheckMinVersions() got no mismatch for %+v", mv.APIs[1])
+	}
+
+	tests := []struct {
+		minClient string
+		want      uint32
+	}{
+		{"Windows 10, version 1809 [desktop apps only]", 0x0A000006},
+		{"Windows 10, version 2004 [desktop apps only]", 0x0A000008},
+		{"Windows 10, version 21H2 [desktop apps | UWP apps]", 0x0A000008},
+		{"Windows 11 [desktop apps only]", 0x0A00000B},
+	}
+	for _, tt := range tests {
+		if got, ok := analysis.DocumentedNTDDI(tt.minClient); !ok || got != tt.want {
+			t.Errorf("DocumentedNTDDI(%q) got %#x, want %#x", tt.minClient, got, tt.want)
+		}
+	}
+}
+
+func TestDiff(t *testing.T) {
+	oldAPIs := []entity.W32API{
+		{Name: "CreateFileW", DLL: "kernel32.dll", RetType: "HANDLE", Params: []entity.W32APIParam{
+			{Name: "lpName", Type: "LPCWSTR", Annotation: "_In_"},
+			{Name: "dwAccess", Type: "DWORD", Annotation: "_In_"}}},
+		{Name: "GetVersion", DLL: "kernel32.dll", RetType: "DWORD"},
+		{Name: "CloseHandle", DLL: "kernel32.dll", RetType: "BOOL", Params: []entity.W32APIParam{
+			{Name: "h", Type: "HANDLE"}}},
+		{Name: "Sleep", DLL: "kernel32.dll", RetType: "void"},
+		{Name: "Beep", DLL: "kernel32.dll", RetType: "BOOL"},
+	}
+	newAPIs := []entity.W32API{
+		{Name: "CreateFileW", DLL: "kernel32.dll", RetType: "HANDLE", Params: []entity.W32APIParam{
+			{Name: "lpFileName", Type: "LPCWSTR", Annotation: "_In_"},
+			{Name: "dwAccess", Type: "ULONG", Annotation: "_In_opt_"}}},
+		{Name: "CreateFile2", DLL: "kernel32.dll", RetType: "HANDLE"},
+		{Name: "CloseHandle", DLL: "kernelbase.dll", RetType: "BOOL", Params: []entity.W32APIParam{
+			{Name: "hObject", Type: "HANDLE"}}},
+		{Name: "Sleep", DLL: "kernel32.dll", RetType: "void", Params: []entity.W32APIParam{
+			{Name: "dwMilliseconds", Type: "DWORD"}}},
+		// Exported by a second DLL, Beep did not move.
+		{Name: "Beep", DLL: "kernel32.dll", RetType: "BOOL"},
+		{Name: "Beep", DLL: "KernelBase.dll", RetType: "BOOL"},
+	}
+	got := analysis.DiffAPIs(oldAPIs, newAPIs)
+	want := []entity.W32Change{
+		{Name: "kernel32.dll!CreateFile2", Kind: entity.ChangeAdded},
+		{Name: "kernel32.dll!CreateFileW", Kind: entity.ChangeChanged, Breaking: true, Details: []string{
+			"parameter 1 renamed from lpName to lpFileName",
+			`parameter dwAccess type changed from "DWORD" to "ULONG"`,
+			`parameter dwAccess annotation changed from "_In_" to "_In_opt_"`}},
+		{Name: "kernel32.dll!GetVersion", Kind: entity.ChangeRemoved, Breaking: true},
+		{Name: "kernel32.dll!Sleep", Kind: entity.ChangeChanged, Breaking: true, Details: []string{
+			"parameter 1 dwMilliseconds added"}},
+		{Name: "kernelbase.dll!Beep", Kind: entity.ChangeAdded},
+		{Name: "kernelbase.dll!CloseHandle", Kind: entity.ChangeMoved, Breaking: true, Details: []string{
+			`dll changed from "kernel32.dll" to "kernelbase.dll"`,
+			"parameter 1 renamed from h to hObject"}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("DiffAPIs() got %+v, want %+v", got, want)
+	}
+
+	var md strings.Builder
+	if err := analysis.WriteDiffMarkdown(&md, []entity.W32Diff{{From: "A", To: "B", APIs: got}}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(md.String(), "2 added, 1 removed, 2 changed, 1 moved.\n") {
+		t.Errorf("WriteDiffMarkdown() got %s", md.String())
+	}
+
+	oldTypes := map[string]entity.W32Type{
+		"POINT": {Name: "POINT", Kind: entity.TypeKindStruct, Size: 8, Members: []entity.W32TypeMember{
+			{Name: "x", Type: "LONG", Size: 4}, {Name: "y", Type: "LONG", Offset: 4, Size: 4}}},
+		"MODE": {Name: "MODE", Kind: entity.TypeKindEnum, Values: []entity.W32EnumValue{{Name: "MODE_A"}}},
+	}
+	newTypes := map[string]entity.W32Type{
+		"POINT": {Name: "POINT", Kind: entity.TypeKindStruct, Size: 16, Members: []entity.W32TypeMember{
+			{Name: "x", Type: "LONG", Size: 4}, {Name: "z", Type: "LONG", Offset: 4, Size: 4},
+			{Name: "y", Type: "LONG64", Offset: 8, Size: 8}}},
+		"MODE": {Name: "MODE", Kind: entity.TypeKindEnum, Values: []entity.W32EnumValue{{Name: "MODE_A", Value: 1}}},
+	}
+	got = analysis.DiffTypes(oldTypes, newTypes)
+	want = []entity.W32Change{
+		{Name: "MODE", Kind: entity.ChangeChanged, Breaking: true, Details: []string{"value MODE_A changed from 0 to 1"}},
+		{Name: "POINT", Kind: entity.ChangeChanged, Breaking: true, Details: []string{
+			"size changed from 8 to 16", "member y moved from 0x4 to 0x8", "member z added at 0x4"}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("DiffTypes() got %+v, want %+v", got, want)
+	}
+
+	// Appended enumeration values are compatible.
+	newTypes["MODE"] = entity.W32Type{Name: "MODE", Kind: entity.TypeKindEnum,
+		Values: []entity.W32EnumValue{{Name: "MODE_A"}, {Name: "MODE_B", Value: 1}}}
+	if c := analysis.DiffTypes(oldTypes, newTypes)[0]; c.Breaking || c.Details[0] != "value MODE_B added" {
+		t.Errorf("DiffTypes() got %+v", c)
+	}
+
+	var b strings.Builder
+	if err := analysis.WriteDiffMarkdown(&b, []entity.W32Diff{{From: "A", To: "B", Types: got}}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(b.String(), "- **changed** `POINT` (breaking)\n  - size changed from 8 to 16\n") {
+		t.Errorf("WriteDiffMarkdown() got %s", b.String())
+	}
+}
+
+func TestMinifyAPIs(t *testing.T) {
+	typedef := func(name, target string) entity.W32Type {
+		return entity.W32Type{Name: name, Kind: entity.TypeKindTypedef, Target: target}
+	}
+	types := map[string]entity.W32Type{
+		"CHAR":          typedef("CHAR", "char"),
+		"WCHAR":         typedef("WCHAR", "wchar_t"),
+		"BYTE":          typedef("BYTE", "unsigned char"),
+		"DWORD":         typedef("DWORD", "unsigned long"),
+		"LPDWORD":       typedef("LPDWORD", "DWORD*"),
+		"LPSTR":         typedef("LPSTR", "CHAR*"),
+		"LPCWSTR":       typedef("LPCWSTR", "WCHAR*"),
+		"LPVOID":        typedef("LPVOID", "void*"),
+		"HANDLE":        typedef("HANDLE", "void*"),
+		"HKEY":          typedef("HKEY", "struct HKEY__*"),
+		"struct HKEY__": {Name: "struct HKEY__", Kind: entity.TypeKindStruct, Size: 4},
+	}
+
+	kinds := map[string][2]uint8{
+		"LPCWSTR":      {entity.DataWideStr, 0},
+		"LPSTR":        {entity.DataASCIIStr, 0},
+		"const char *": {entity.DataASCIIStr, 0},
+		"LPSTR*":       {entity.DataArrASCIIStr, 0},
+		"DWORD":        {entity.DataScalar, 4},
+		"LPDWORD":      {entity.DataPtrScalar, 4},
+		"BYTE*":        {entity.DataBytePtr, 0},
+		"HKEY":         {entity.DataVoidPtr, 0},
+		"HKEY*":        {entity.DataPtrScalar, 0},
+		"LPOVERLAPPED": {entity.DataStruct, 0},
+	}
+	for typ, want := range kinds {
+		if kind, size := analysis.DataKind(typ, types); kind != want[0] || size != want[1] {
+			t.Errorf("DataKind(%s) got (%d, %d), want %v", typ, kind, size, want)
+		}
+	}
+
+	apis := map[string]map[string]entity.W32API{"kernel32.dll": {"ReadFile": {
+		Name: "ReadFile", DLL: "kernel32.dll", RetType: "BOOL", Params: []entity.W32APIParam{
+			{Annotation: "_In_", Type: "HANDLE", Name: "hFile"},
+			{Annotation: "_Out_writes_bytes_to_opt_(nNumberOfBytesToRead,*lpNumberOfBytesRead)", Type: "LPVOID", Name: "lpBuffer"},
+			{Annotation: "_In_", Type: "DWORD", Name: "nNumberOfBytesToRead"},
+			{Annotation: "_Out_opt_", Type: "LPDWORD", Name: "lpNumberOfBytesRead"},
+			{Annotation: "_Inout_opt_", Type: "LPOVERLAPPED", Name: "lpOverlapped"},
+		}}}}
+	got := analysis.MinifyAPIs(apis, []string{"ReadFile"}, types)
+	want := entity.W32APIMini{PropertyCount: 6, CustomHook: true, Params: []entity.W32APIParamMini{
+		{Annotation: entity.ParamIn, Type: entity.DataVoidPtr, Name: "hFile"},
+		{Annotation: entity.ParamOut, Type: entity.DataBytePtr, Name: "lpBuffer", BufferSizeOrIndex: 3},
+		{Annotation: entity.ParamIn, Type: entity.DataScalar, Name: "nNumberOfBytesToRead", BufferSizeOrIndex: 4},
+		{Annotation: entity.ParamOut, Type: entity.DataPtrScalar, Name: "lpNumberOfBytesRead", BufferSizeOrIndex: 4},
+		{Annotation: entity.ParamInOut, Type: entity.DataStruct, Name: "lpOverlapped"},
+	}}
+	if !reflect.DeepEqual(got["kernel32.dll"]["ReadFile"], want) {
+		t.Errorf("MinifyAPIs() got %+v, want %+v", got["kernel32.dll"]["ReadFile"], want)
+	}
+
+	x64 := map[string]entity.W32Type{"struct _S": {Name: "struct _S", Kind: entity.TypeKindStruct, Size: 16,
+		Members: []entity.W32TypeMember{{Name: "h", Type: "HANDLE", Size: 8}, {Name: "n", Type: "DWORD", Offset: 8, Size: 4}}}}
+	for k, v := range types {
+		x64[k] = v
+	}
+	x86 := map[string]entity.W32Type{"struct _S": {Name: "struct _S", Kind: entity.TypeKindStruct, Size: 8,
+		Members: []entity.W32TypeMember{{Name: "h", Type: "HANDLE", Size: 4}, {Name: "n", Type: "DWORD", Offset: 4, Size: 4}}}}
+	structs := analysis.MinifyStructs([]string{"struct _S", "DWORD"}, x86, x64)
+	wantStructs := []entity.W32StructMini{{Name: "struct _S", X86Size: 8, X64Size: 16, Members: []entity.W32StructMemberMini{
+		{Name: "h", X86Size: 4, X64Size: 8, Type: entity.DataVoidPtr},
+		{Name: "n", X86Offset: 4, X86Size: 4, X64Offset: 8, X64Size: 4, Type: entity.DataScalar},
+	}}}
+	if !reflect.DeepEqual(structs, wantStructs) {
+		t.Errorf("MinifyStructs() got %+v, want %+v", structs, wantStructs)
+	}
+}
+
+func TestConfig(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, data string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	conf, err := config.Load(write("winsdk2json.yaml", `
+sdk:
+  include: sdk/Include/10.0.19041.0
+  msvc: vs/VC/Tools/MSVC
+target:
+  arch: 386
+  ntddi_version: WIN10_RS5
+macros:
+  - _DEBUG
+  - WINVER=0x0A00
+include_paths:
+  - headers
+outputs:
+  dir: /tmp/out
+  apis: apis-x86.json
+`))
+	if err != nil {
+		t.Fatalf("Load() failed: %v", err)
+	}
+	if err := conf.Resolve(); err != nil {
+		t.Fatalf("Resolve() failed: %v", err)
+	}
+	if want := filepath.Join(dir, "sdk/Include/10.0.19041.0"); conf.SDK.Include != want {
+		t.Errorf("include got %s, want %s", conf.SDK.Include, want)
+	}
+	if want := filepath.Join(dir, "vs/VC/Tools/MSVC"); conf.SDK.MSVC != want {
+		t.Errorf("msvc got %s, want %s", conf.SDK.MSVC, want)
+	}
+	if want := []string{filepath.Join("assets", "header.h")}; !reflect.DeepEqual(conf.Sources, want) {
+		t.Errorf("sources got %v, want %v", conf.Sources, want)
+	}
+	if want := []string{filepath.Join(dir, "headers")}; !reflect.DeepEqual(conf.IncludePaths, want) {
+		t.Errorf("include paths got %v, want %v", conf.IncludePaths, want)
+	}
+	// The defaults the file does not set stay relative to the working
+	// directory, like the default sources.
+	if want := "./assets/hookapis.md"; conf.Hooks.APIs != want {
+		t.Errorf("hooks got %s, want %s", conf.Hooks.APIs, want)
+	}
+	if got := conf.Output(conf.Outputs.APIs); got != "/tmp/out/apis-x86.json" {
+		t.Errorf("apis output got %s", got)
+	}
+	if got := conf.Output(conf.Outputs.Types); got != "/tmp/out/types.json" {
+		t.Errorf("types output got %s", got)
+	}
+	if got, want := conf.Predefined(), "#define _DEBUG \n#define WINVER 0x0A00\n"; got != want {
+		t.Errorf("Predefined() got %q, want %q", got, want)
+	}
+
+	conf, err = config.Load(write("kernel.json", `{"target": {"profile": "kernel"}}`))
+	if err != nil {
+		t.Fatalf("Load() failed: %v", err)
+	}
+	if err := conf.Resolve(); err != nil {
+		t.Fatalf("Resolve() failed: %v", err)
+	}
+	if want := []string{filepath.Join("assets", "header-km.h")}; !reflect.DeepEqual(conf.Sources, want) {
+		t.Errorf("kernel sources got %v, want %v", conf.Sources, want)
+	}
+	if want := []string{"assets"}; !reflect.DeepEqual(conf.IncludePaths, want) {
+		t.Errorf("kernel include paths got %v, want %v", conf.IncludePaths, want)
+	}
+	if conf.SDK.Include != config.Default().SDK.Include {
+		t.Errorf("include got %s, want the default one", conf.SDK.Include)
+	}
+
+	if _, err := config.Load(write("typo.yaml", "target:\n  archs: amd64\n")); err == nil {
+		t.Errorf("Load() accepted an unknown key")
+	}
+	invalid := []string{
+		"target:\n  arch: mips\n",
+		"target:\n  profile: driver\n",
+		"target:\n  ntddi_version: WIN99\n",
+		"macros: [\"1BAD\"]\n",
+		"sources: [\"\"]\n",
+		"jobs: -1\n",
+	}
+	for _, data := range invalid {
+		conf, err := config.Load(write("invalid.yaml", data))
+		if err != nil {
+			t.Fatalf("Load(%q) failed: %v", data, err)
+		}
+		if err := conf.Resolve(); err == nil {
+			t.Errorf("Resolve() accepted %q", data)
+		}
+	}
+}
+
+func TestDiscoverSDK(t *testing.T) {
+	t.Setenv("VCToolsInstallDir", "")
+	root := t.TempDir()
+	for _, dir := range []string{
+		"Include/10.0.9999.0/shared",
+		"Include/10.0.19041.0/um",
+		"Include/10.0.19041.0/shared",
+		"Include/10.0.19041.0/ucrt",
+		"Include/10.0.22000.0/um",
+		"Include/10.0.22000.0/shared",
+		"Include/14.16.27023/include",
+		"Include/14.29.30133/include",
+		"Include/notes",
+		"VS/VC/Tools/MSVC/14.38.33130/include",
+	} {
+		if err := os.MkdirAll(filepath.Join(root, dir), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	include := filepath.Join(root, "Include")
+	host := vfs.New(nil)
+
+	versions, dir, err := sdk.Versions(host, root)
+	if err != nil {
+		t.Fatalf("Versions() failed: %v", err)
+	}
+	if want := []string{"10.0.9999.0", "10.0.19041.0", "10.0.22000.0"}; !reflect.DeepEqual(versions, want) || dir != include {
+		t.Errorf("Versions() got %v in %s, want %v in %s", versions, dir, want, include)
+	}
+
+	tests := []struct {
+		root, version, msvc, toolset string
+		out                          sdk.Layout
+	}{
+		{root, "", "", "", sdk.Layout{Version: "10.0.22000.0", Include: filepath.Join(include, "10.0.22000.0"),
+			Toolset: "14.29.30133", ToolsetInclude: filepath.Join(include, "14.29.30133", "include")}},
+		{include, "10.0.19041.0", "", "14.16.27023", sdk.Layout{Version: "10.0.19041.0", Include: filepath.Join(include, "10.0.19041.0"),
+			Toolset: "14.16.27023", ToolsetInclude: filepath.Join(include, "14.16.27023", "include")}},
+		{filepath.Join(include, "10.0.19041.0"), "", filepath.Join(root, "VS"), "", sdk.Layout{Version: "10.0.19041.0",
+			Include: filepath.Join(include, "10.0.19041.0"), Toolset: "14.38.33130",
+			ToolsetInclude: filepath.Join(root, "VS/VC/Tools/MSVC/14.38.33130/include")}},
+	}
+	for _, tt := range tests {
+		layout, err := sdk.Discover(host, tt.root, tt.version, tt.msvc, tt.toolset)
+		if err != nil {
+			t.Errorf("Discover(%s, %s) failed: %v", tt.root, tt.version, err)
+			continue
+		}
+		if *layout != tt.out {
+			t.Errorf("Discover(%s, %s) got %+v, want %+v", tt.root, tt.version, *layout, tt.out)
+		}
+	}
+
+	layout, _ := sdk.Discover(host, root, "", "", "")
+	if err := layout.Require(host, "um", "shared", "ucrt"); err == nil || !strings.Contains(err.Error(), "ucrt") {
+		t.Errorf("Require() got %v, want the missing ucrt headers", err)
+	}
+	for _, args := range [][4]string{
+		{root, "10.0.17763.0", "", ""},
+		{root, "", "", "14.00.00000"},
+		{root, "", filepath.Join(root, "missing"), ""},
+		{filepath.Join(root, "missing"), "", "", ""},
+		{filepath.Join(root, "VS"), "", "", ""},
+	} {
+		if _, err := sdk.Discover(host, args[0], args[1], args[2], args[3]); err == nil {
+			t.Errorf("Discover(%q) did not fail", args)
+		}
+	}
+}
+
+func TestVFS(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]string{
+		"Include/um/Windows.h":     "windows",
+		"Include/um/WinDef.h":      "windef upper",
+		"Include/um/windef.h":      "windef lower",
+		"Include/shared/basetsd.h": "basetsd",
+		"include/ucrt/stdio.h":     "stdio",
+	}
+	for name, data := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var reported []string
+	headers := vfs.New(func(name string, matches []string) {
+		reported = append(reported, name)
+	})
+	tests := []struct {
+		in, out string
+	}{
+		{"Include/um/Windows.h", "windows"},
+		{"include/UM/windows.h", "windows"},
+		{"Include/um/WinDef.h", "windef upper"},
+		{"Include/UM/WINDEF.H", "windef upper"},
+		{`Include\um\..\Shared\BaseTsd.h`, "basetsd"},
+		{"INCLUDE/ucrt/stdio.h", "stdio"},
+	}
+	for _, tt := range tests {
+		data, err := fs.ReadFile(headers, filepath.Join(root, tt.in))
+		if err != nil {
+			t.Errorf("ReadFile(%s) failed: %v", tt.in, err)
+			continue
+		}
+		if string(data) != tt.out {
+			t.Errorf("ReadFile(%s) got %q, want %q", tt.in, data, tt.out)
+		}
+	}
+	if _, err := headers.Open(filepath.Join(root, "Include/um/winnt.h")); err == nil {
+		t.Errorf("Open() of a missing header succeeded")
+	}
+
+	var names []string
+	for _, a := range headers.Ambiguities() {
+		names = append(names, strings.TrimPrefix(a.Name, root))
+	}
+	want := []string{filepath.FromSlash("/Include/um/windef.h"), filepath.FromSlash("/include")}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("Ambiguities() got %v, want %v", names, want)
+	}
+	if len(reported) != len(want) {
+		t.Errorf("reported %d ambiguities, want %d", len(reported), len(want))
+	}
+}
+
+func TestVFSArchives(t *testing.T) {
+	t.Setenv("VCToolsInstallDir", "")
+	root := t.TempDir()
+	files := map[string]string{
+		"Include/10.0.22621.0/um/Windows.h":     "#include <winbase.h>\n",
+		"Include/10.0.22621.0/um/WinBase.h":     "int WINAPI Beep(int, int);\n",
+		"Include/10.0.22621.0/shared/basetsd.h": "typedef int INT32;\n",
+		"Include/10.0.22621.0/ucrt/stdio.h":     "int printf(const char *, ...);\n",
+		"Include/14.36.32532/include/vadefs.h":  "typedef char *va_list;\n",
+	}
+	writeArchive := func(name string, prefix string) string {
+		path := filepath.Join(root, name)
+		out, err := os.Create(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer out.Close()
+
+		var w io.Writer = out
+		if strings.HasSuffix(name, ".gz") {
+			gz := gzip.NewWriter(out)
+			defer gz.Close()
+			w = gz
+		}
+		if strings.Contains(name, ".tar") {
+			tw := tar.NewWriter(w)
+			defer tw.Close()
+			for file, data := range files {
+				hdr := &tar.Header{Name: prefix + file, Mode: 0o644, Size: int64(len(data)), Typeflag: tar.TypeReg}
+				if err := tw.WriteHeader(hdr); err != nil {
+					t.Fatal(err)
+				}
+				tw.Write([]byte(data))
+			}
+			return path
+		}
+		zw := zip.NewWriter(w)
+		defer zw.Close()
+		for file, data := range files {
+			fw, err := zw.Create(prefix + file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			fw.Write([]byte(data))
+		}
+		return path
+	}
+	for file, data := range files {
+		path := filepath.Join(root, "unpacked", file)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	roots := []string{
+		filepath.Join(root, "unpacked"),
+		writeArchive("sdk.zip", ""),
+		writeArchive("Microsoft.Windows.SDK.CPP.10.0.22621.755.nupkg", "c/"),
+		writeArchive("sdk.tar", ""),
+		writeArchive("sdk.tar.gz", "./"),
+	}
+	headers := vfs.New(nil)
+	defer headers.Close()
+	for _, r := range roots {
+		msvc := ""
+		if strings.HasSuffix(r, ".nupkg") {
+			msvc = filepath.Join(root, "unpacked", "Include")
+		}
+		layout, err := sdk.Discover(headers, r, "", msvc, "")
+		if err != nil {
+			t.Errorf("Discover(%s) failed: %v", r, err)
+			continue
+		}
+		if err := layout.Require(headers, "um", "shared", "ucrt"); err != nil {
+			t.Errorf("Require(%s) failed: %v", r, err)
+		}
+		if layout.Version != "10.0.22621.0" || layout.Toolset != "14.36.32532" {
+			t.Errorf("Discover(%s) got %+v", r, *layout)
+		}
+
+		entries, err := fs.ReadDir(headers, filepath.Join(layout.Include, "UM"))
+		if err != nil || len(entries) != 2 || entries[0].Name() != "WinBase.h" || entries[1].Name() != "Windows.h" {
+			t.Errorf("ReadDir(%s) got %v, %v", r, entries, err)
+		}
+		for file, want := range files {
+			name := filepath.Join(layout.Include, "..", "..", strings.ToLower(file))
+			data, err := fs.ReadFile(headers, name)
+			if err != nil || string(data) != want {
+				t.Errorf("ReadFile(%s) got %q, %v, want %q", name, data, err, want)
+			}
+		}
+	}
+}
+
+func TestOverlay(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, data string) string {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	write("patches/01-winnt.yaml", `
+patches:
+  - name: winnt-align
+    header: WinNT.h
+    reason: cc rejects __declspec(align) on typedefs
+    find: |
+      typedef struct DECLSPEC_ALIGN(16) _M128A {
+    replace: |
+      typedef struct _M128A {
+  - header: winnt.h
+    find: "#error removed in this SDK"
+    replace: ""
+`)
+	write("patches/02-winbase.yml", `
+patches:
+  - name: winbase-inline
+    header: winbase.h
+    find: __inline
+    replace: inline
+`)
+	write("patches/README.md", "not a patch")
+	header := write("um/winnt.h", "#pragma once\r\ntypedef struct DECLSPEC_ALIGN(16) _M128A {\r\n    ULONGLONG Low;\r\n} M128A;\r\n")
+
+	patches, err := overlay.Load(filepath.Join(dir, "patches"))
+	if err != nil {
+		t.Fatalf("Load() failed: %v", err)
+	}
+	headers := vfs.New(nil)
+	headers.SetPatch(patches.Apply)
+	data, err := fs.ReadFile(headers, strings.Replace(header, "winnt.h", "WINNT.H", 1))
+	if err != nil {
+		t.Fatalf("ReadFile() failed: %v", err)
+	}
+	if want := "#pragma once\r\ntypedef struct _M128A {\r\n    ULONGLONG Low;\r\n} M128A;\r\n"; string(data) != want {
+		t.Errorf("patched header got %q, want %q", data, want)
+	}
+
+	want := []overlay.PatchStatus{
+		{Name: "winnt-align", Header: "WinNT.h", Status: overlay.StatusApplied, Count: 1},
+		{Name: "01-winnt.yaml#2", Header: "winnt.h", Status: overlay.StatusStale},
+		{Name: "winbase-inline", Header: "winbase.h", Status: overlay.StatusUnused},
+	}
+	if got := patches.Report(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Report() got %+v, want %+v", got, want)
+	}
+
+	write("invalid/patch.yaml", "patches:\n  - header: winnt.h\n")
+	if _, err := overlay.Load(filepath.Join(dir, "invalid")); err == nil {
+		t.Errorf("Load() accepted a patch without find")
+	}
+}
+
+func TestRecovery(t *testing.T) {
+	src := []byte("#pragma once\r\n" + // 1
+		"#ifdef __cplusplus\r\n" + // 2
+		"extern \"C\" {\r\n" + // 3
+		"#endif\r\n" + // 4
+		"BOOL GoodOne(int a);\r\n" + // 5
+		"BOOL BadParse(int a, /* ) */\r\n" + // 6
+		"              badtype b);\r\n" + // 7
+		"typedef struct _S {\r\n" + // 8
+		"    int a;\r\n" + // 9
+		"#define S_MAX \\\r\n" + // 10
+		"    16\r\n" + // 11
+		"    int b[S_MAX];\r\n" + // 12
+		"} S, *PS;\r\n" + // 13
+		"FORCEINLINE VOID Inline(VOID)\r\n" + // 14
+		"{\r\n" + // 15
+		"    Call(\"}\");\r\n" + // 16
+		"}\r\n" + // 17
+		"#ifdef __cplusplus\r\n" + // 18
+		"}\r\n" + // 19
+		"#endif\r\n") // 20
+
+	extents := []struct {
+		line        int
+		first, last int
+		ok          bool
+	}{
+		{1, 0, 0, false},
+		{5, 5, 5, true},
+		{7, 6, 7, true},
+		{4, 0, 0, false},
+		{12, 8, 13, true},
+		{16, 14, 17, true},
+		{19, 0, 0, false},
+	}
+	for _, tt := range extents {
+		first, last, ok := analysis.DeclarationExtent(src, tt.line)
+		if first != tt.first || last != tt.last || ok != tt.ok {
+			t.Errorf("DeclarationExtent(%d) got %d-%d %v, want %d-%d %v",
+				tt.line, first, last, ok, tt.first, tt.last, tt.ok)
+		}
+	}
+
+	if got := analysis.DeclarationText(src, 6, 7); got != "BOOL BadParse(int a, badtype b);" {
+		t.Errorf("DeclarationText() got %q", got)
+	}
+
+	blanked := analysis.BlankLines(src, 8, 13)
+	if len(blanked) != len(src) {
+		t.Fatalf("BlankLines() changed the length from %d to %d", len(src), len(blanked))
+	}
+	lines := strings.Split(string(blanked), "\r\n")
+	want := map[int]string{
+		5: "BOOL GoodOne(int a);", 8: "", 9: "", 10: "#define S_MAX \\", 11: "    16",
+		12: "", 13: "", 14: "FORCEINLINE VOID Inline(VOID)",
+	}
+	for line, text := range want {
+		if got := strings.TrimRight(lines[line-1], " "); got != text {
+			t.Errorf("BlankLines() line %d got %q, want %q", line, got, text)
+		}
+	}
+
+	errs := analysis.ParseCCErrors(errors.New(strings.Join([]string{
+		`C:\sdk\um\a.h:7:15: unexpected identifier, expected ')'`,
+		`-: unexpected <EOF>, expected '}'`,
+		`/sdk/um/a.h:12:11: undefined: S_MAX`,
+	}, "\n")))
+	wantErrs := []analysis.CCError{
+		{File: `C:\sdk\um\a.h`, Line: 7, Column: 15, Msg: "unexpected identifier, expected ')'",
+			Notes: []string{"-: unexpected <EOF>, expected '}'"}},
+		{File: "/sdk/um/a.h", Line: 12, Column: 11, Msg: "undefined: S_MAX"},
+	}
+	if !reflect.DeepEqual(errs, wantErrs) {
+		t.Errorf("ParseCCErrors() got %+v, want %+v", errs, wantErrs)
+	}
+}
+
+func TestMerge(t *testing.T) {
+	sources := []string{"assets/header.h", "assets/header2.h"}
+	units := [][]entity.W32API{
+		{
+			{Name: "InternetOpenW", DLL: "wininet.dll", Header: "wininet.h", RetType: "HINTERNET"},
+			{Name: "CloseHandle", DLL: "kernel32.dll", Header: "handleapi.h", RetType: "BOOL"},
+			{Name: "WinHttpOpen", DLL: "winhttp.dll", Header: "winhttp.h", RetType: "HINTERNET",
+				Params: []entity.W32APIParam{{Name: "pszAgentW", Type: "LPCWSTR"}}},
+		},
+		{
+			{Name: "CloseHandle", DLL: "kernel32.dll", Header: "handleapi.h", RetType: "BOOL"},
+			{Name: "WinHttpOpen", DLL: "winhttp.dll", Header: "winhttp.h", RetType: "HINTERNET",
+				Params: []entity.W32APIParam{{Name: "pszAgent", Type: "LPCWSTR"}}},
+			{Name: "InternetOpenW", DLL: "WinINet.dll", Header: "wininet.h", RetType: "HINTERNET"},
+			{Name: "HttpOpenRequestW", DLL: "wininet.dll", Header: "wininet.h", RetType: "HINTERNET"},
+		},
+	}
+
+	merger := &analysis.Merger{Sources: sources}
+	apis, conflicts := merger.MergeAPIs(units)
+	var names []string
+	for _, api := range apis {
+		names = append(names, api.DLL+"!"+api.Name)
+	}
+	want := []string{"wininet.dll!InternetOpenW", "kernel32.dll!CloseHandle",
+		"winhttp.dll!WinHttpOpen", "wininet.dll!HttpOpenRequestW"}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("MergeAPIs() got %v, want %v", names, want)
+	}
+	wantConflicts := []entity.W32Conflict{
+		{Kind: entity.ConflictAPI, Key: "wininet.dll!InternetOpenW", Kept: sources[0], Dropped: sources[1],
+			Details: []string{`dll changed from "wininet.dll" to "WinINet.dll"`}},
+		{Kind: entity.ConflictAPI, Key: "winhttp.dll!WinHttpOpen", Kept: sources[0], Dropped: sources[1],
+			Details: []string{"parameter 1 renamed from pszAgentW to pszAgent"}},
+	}
+	if !reflect.DeepEqual(conflicts, wantConflicts) {
+		t.Errorf("MergeAPIs() conflicts got %+v, want %+v", conflicts, wantConflicts)
+	}
+
+	// The rules take precedence over the precedence.
+	merger = &analysis.Merger{Sources: sources, Precedence: analysis.PrecedenceLast, Rules: []analysis.MergeRule{
+		{Header: "WinHTTP.h", Source: "./assets/header.h"},
+	}}
+	if err := merger.Validate(); err != nil {
+		t.Fatalf("Validate() failed: %v", err)
+	}
+	apis, conflicts = merger.MergeAPIs(units)
+	got := map[string]string{}
+	for _, api := range apis {
+		if len(api.Params) > 0 {
+			got[api.Name] = api.Params[0].Name
+		} else {
+			got[api.Name] = api.DLL
+		}
+	}
+	if got["WinHttpOpen"] != "pszAgentW" || got["InternetOpenW"] != "WinINet.dll" {
+		t.Errorf("MergeAPIs() with rules got %v", got)
+	}
+	if len(conflicts) != 2 || conflicts[0].Kept != sources[1] || conflicts[1].Kept != sources[0] {
+		t.Errorf("MergeAPIs() with rules conflicts got %+v", conflicts)
+	}
+
+	types, conflicts := merger.MergeTypes([]map[string]entity.W32Type{
+		{"POINT": {Name: "POINT", Kind: entity.TypeKindStruct, Size: 8}},
+		{"POINT": {Name: "POINT", Kind: entity.TypeKindStruct, Size: 16}, "SIZE": {Name: "SIZE"}},
+	})
+	if len(types) != 2 || types["POINT"].Size != 16 {
+		t.Errorf("MergeTypes() got %+v", types)
+	}
+	wantConflicts = []entity.W32Conflict{{Kind: entity.ConflictType, Key: "POINT", Kept: sources[1],
+		Dropped: sources[0], Details: []string{"size changed from 16 to 8"}}}
+	if !reflect.DeepEqual(conflicts, wantConflicts) {
+		t.Errorf("MergeTypes() conflicts got %+v, want %+v", conflicts, wantConflicts)
+	}
+
+	guids, conflicts := merger.MergeGUIDs([][]entity.W32GUID{
+		{{Name: "IID_IUnknown", GUID: "00000000-0000-0000-C000-000000000046"}},
+		{{Name: "IID_IUnknown", GUID: "00000000-0000-0000-c000-000000000046"}},
+	})
+	wantConflicts = []entity.W32Conflict{{Kind: entity.ConflictGUID, Key: "IID_IUnknown", Kept: sources[1],
+		Dropped: sources[0], Details: []string{
+			`guid changed from "00000000-0000-0000-c000-000000000046" to "00000000-0000-0000-C000-000000000046"`}}}
+	if len(guids) != 1 || !reflect.DeepEqual(conflicts, wantConflicts) {
+		t.Errorf("MergeGUIDs() got %+v %+v, want %+v", guids, conflicts, wantConflicts)
+	}
+
+	functions := merger.MergeFunctions([]map[string]string{
+		{"WinHttpOpen": "winhttp.h", "CloseHandle": "winbase.h"},
+		{"WinHttpOpen": "WinHTTP2.h", "CloseHandle": "handleapi.h", "InternetOpenW": "wininet.h"},
+	})
+	wantFunctions := map[string]string{"WinHttpOpen": "winhttp.h", "CloseHandle": "handleapi.h", "InternetOpenW": "wininet.h"}
+	if !reflect.DeepEqual(functions, wantFunctions) {
+		t.Errorf("MergeFunctions() got %v, want %v", functions, wantFunctions)
+	}
+
+	for _, m := range []*analysis.Merger{
+		{Sources: sources, Precedence: "newest"},
+		{Sources: sources, Rules: []analysis.MergeRule{{Name: "Win[Http*", Source: sources[0]}}},
+		{Sources: sources, Rules: []analysis.MergeRule{{Name: "WinHttp*", Source: "assets/header3.h"}}},
+	} {
+		if err := m.Validate(); err == nil {
+			t.Errorf("Validate() accepted %+v", m)
+		}
+	}
+}
+
+func TestPatchedFS(t *testing.T) {
+	dir := t.TempDir()
+	header := filepath.Join(dir, "um", "winnt.h")
+	if err := os.MkdirAll(filepath.Dir(header), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(header, []byte("A B C"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	headers := vfs.New(nil)
+	headers.SetPatch(func(name string, data []byte) []byte {
+		return []byte(strings.Replace(string(data), "A", "a", 1))
+	})
+
+	// Each translation reads the headers through its own view, the views
+	// are read concurrently and do not see each other's patches.
+	const views = 8
+	got := make([]string, views)
+	var wg sync.WaitGroup
+	for i := 0; i < views; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			view := headers.Patched(func(name string, data []byte) []byte {
+				if name != header {
+					t.Errorf("patch got name %s, want %s", name, header)
+				}
+				return []byte(strings.Replace(string(data), "B", string(rune('0'+i)), 1))
+			})
+			data, err := fs.ReadFile(view, filepath.Join(dir, "UM", "WinNT.h"))
+			if err != nil {
+				t.Errorf("ReadFile() failed: %v", err)
+			}
+			got[i] = string(data)
+		}(i)
+	}
+	wg.Wait()
+	for i, data := range got {
+		if want := "a " + string(rune('0'+i)) + " C"; data != want {
+			t.Errorf("view %d got %q, want %q", i, data, want)
+		}
+	}
+
+	data, err := fs.ReadFile(headers, header)
+	if err != nil {
+		t.Fatalf("ReadFile() failed: %v", err)
+	}
+	if want := "a B C"; string(data) != want {
+		t.Errorf("headers got %q, want %q", data, want)
+	}
+}
+
+func TestCache(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, data string) string {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	header := write("um/winnt.h", "typedef long LONG;\n")
+	shadow := filepath.Join(dir, "assets", "winnt.h")
+
+	c, err := cache.Open(filepath.Join(dir, "cache"))
+	if err != nil {
+		t.Fatalf("Open() failed: %v", err)
+	}
+	headers := vfs.New(nil)
+
+	// The translation opens the headers through the recorder, the include
+	// paths searched before the one holding a header are recorded too.
+	deps := cache.NewRecorder()
+	fsys := deps.Wrap(headers)
+	if _, err := fsys.Open(shadow); err == nil {
+		t.Fatalf("Open(%s) succeeded", shadow)
+	}
+	if _, err := fs.ReadFile(fsys, header); err != nil {
+		t.Fatalf("ReadFile() failed: %v", err)
+	}
+	if got, want := deps.Names(), []string{shadow, header}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Names() got %v, want %v", got, want)
+	}
+
+	type model struct{ Types []string }
+	key := cache.Key("amd64", "#define _AMD64_\n", "#include <winnt.h>\n")
+	if key == cache.Key("386", "#define _AMD64_\n", "#include <winnt.h>\n") {
+		t.Errorf("Key() ignores the settings")
+	}
+	if err := c.Store(key, headers, deps.Names(), model{Types: []string{"LONG"}}); err != nil {
+		t.Fatalf("Store() failed: %v", err)
+	}
+
+	load := func() (model, bool) {
+		var m model
+		ok, err := c.Load(key, headers, &m)
+		if err != nil {
+			t.Fatalf("Load() failed: %v", err)
+		}
+		return m, ok
+	}
+	if m, ok := load(); !ok || !reflect.DeepEqual(m.Types, []string{"LONG"}) {
+		t.Errorf("Load() got %+v, %v", m, ok)
+	}
+	if _, ok := load(); !ok {
+		t.Errorf("Load() missed an unchanged entry")
+	}
+
+	write("um/winnt.h", "typedef long LONG;\ntypedef int INT;\n")
+	if _, ok := load(); ok {
+		t.Errorf("Load() hit after a header changed")
+	}
+	if err := c.Store(key, headers, deps.Names(), model{Types: []string{"INT", "LONG"}}); err != nil {
+		t.Fatalf("Store() failed: %v", err)
+	}
+	if _, ok := load(); !ok {
+		t.Errorf("Load() missed an updated entry")
+	}
+	write("assets/winnt.h", "typedef short LONG;\n")
+	if _, ok := load(); ok {
+		t.Errorf("Load() hit after a header was shadowed")
+	}
+
+	var m model
+	if ok, err := c.Load(cache.Key("missing"), headers, &m); ok || err != nil {
+		t.Errorf("Load() of a missing key got %v, %v", ok, err)
+	}
+
+	// An include path added ahead shadows a header the cached translation
+	// never looked up.
+	sdk := fakeSDK(t, nil)
+	older := write("older/point.h", "typedef struct _POINT { long x; } POINT;\n")
+	newer := write("newer/point.h", "typedef struct _POINT { long x; long y; } POINT;\n")
+	parse := func(includePaths ...string) (*winsdk.Database, string) {
+		var log bytes.Buffer
+		db, err := winsdk.Parse(context.Background(), winsdk.Options{
+			Include:      sdk,
+			IncludePaths: includePaths,
+			Sources:      []winsdk.Source{{Name: "point.c", Code: []byte("#include \"point.h\"\n")}},
+			CacheDir:     filepath.Join(dir, "parse-cache"),
+			Log:          &log,
+		})
+		if err != nil {
+			t.Fatalf("Parse() failed: %v", err)
+		}
+		return db, log.String()
+	}
+	parse(filepath.Dir(older))
+	if _, log := parse(filepath.Dir(older)); !strings.Contains(log, "using the cached translation of point.c") {
+		t.Errorf("Parse() missed the cache, log: %s", log)
+	}
+	db, log := parse(filepath.Dir(newer), filepath.Dir(older))
+	if strings.Contains(log, "using the cached translation") {
+		t.Errorf("Parse() hit the cache after an include path was added")
+	}
+	if got := db.Types["POINT"].Size; got != 8 {
+		t.Errorf("POINT size got %d, want the 8 bytes of %s", got, newer)
+	}
+}
+
+func TestParallel(t *testing.T) {
+	results := make([]int, 8)
+	err := utils.Parallel(context.Background(), len(results), 2, func(i int) error {
+		results[i] = i * i
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Parallel() failed: %v", err)
+	}
+	if want := []int{0, 1, 4, 9, 16, 25, 36, 49}; !reflect.DeepEqual(results, want) {
+		t.Errorf("Parallel() got %v, want %v", results, want)
+	}
+
+	// A single job runs the calls in order, the ones following a failure
+	// are skipped.
+	var calls []int
+	err = utils.Parallel(context.Background(), 4, 1, func(i int) error {
+		calls = append(calls, i)
+		if i >= 1 {
+			return fmt.Errorf("call %d failed", i)
+		}
+		return nil
+	})
+	if err == nil || err.Error() != "call 1 failed" {
+		t.Errorf("Parallel() got error %v, want call 1 failed", err)
+	}
+	if len(calls) != 2 {
+		t.Errorf("Parallel() ran %v after a failure", calls)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = utils.Parallel(ctx, 4, 0, func(i int) error {
+		t.Errorf("Parallel() called %d after the context was canceled", i)
+		return nil
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Parallel() got error %v, want %v", err, context.Canceled)
+	}
+}
+
+// fakeSDK creates a Windows SDK 10.0.22000.0 along with an MSVC toolset,
+// holding the given um headers, and returns its Windows Kits directory.
+func fakeSDK(t *testing.T, headers map[string]string) string {
+	dir := t.TempDir()
+	include := filepath.Join(dir, "Include", "10.0.22000.0")
+	for _, name := range []string{"um", "shared", "ucrt"} {
+		if err := os.MkdirAll(filepath.Join(include, name), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "VC", "Tools", "MSVC", "14.29.30133", "include"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for name, data := range headers {
+		if err := os.WriteFile(filepath.Join(include, "um", name), []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestParse(t *testing.T) {
+	dir := fakeSDK(t, map[string]string{
+		"point.h": "typedef struct _POINT { long x; void *p; } POINT;\n" +
+			"int GetPoint(POINT *pt);\n" +
+			"#ifdef BROKEN\nint Broken(undefined_t a);\n#endif\n",
+	})
+
+	ctx := context.Background()
+	if _, err := winsdk.Parse(ctx, winsdk.Options{Include: dir}); !errors.Is(err, winsdk.ErrNoSources) {
+		t.Errorf("Parse() without sources got error %v, want %v", err, winsdk.ErrNoSources)
+	}
+	opts := winsdk.Options{
+		Include:    dir,
+		Sources:    []winsdk.Source{{Name: "point.c", Code: []byte("#include <point.h>\n")}},
+		ExtraArchs: []string{"386"},
+	}
+	if _, err := winsdk.Parse(ctx, winsdk.Options{Include: dir, Sources: opts.Sources, Arch: "mips"}); err == nil {
+		t.Errorf("Parse() accepted an unsupported architecture")
+	}
+
+	db, err := winsdk.Parse(ctx, opts)
+	if err != nil {
+		t.Fatalf("Parse() failed: %v", err)
+	}
+	if db.SDKVersion != "10.0.22000.0" || db.Toolset != "14.29.30133" {
+		t.Errorf("Parse() translated SDK %s and toolset %s", db.SDKVersion, db.Toolset)
+	}
+	if got := db.Functions["GetPoint"]; got != "point.h" {
+		t.Errorf("Functions[GetPoint] got %q, want point.h", got)
+	}
+	if got, want := db.Types["POINT"].Size, int64(16); got != want {
+		t.Errorf("amd64 POINT size got %d, want %d", got, want)
+	}
+	if got, want := db.ArchTypes["386"]["POINT"].Size, int64(8); got != want {
+		t.Errorf("386 POINT size got %d, want %d", got, want)
+	}
+
+	// The errors of cc are returned along with the failing source.
+	opts.Macros = []string{"BROKEN"}
+	_, err = winsdk.Parse(ctx, opts)
+	var terr *winsdk.TranslateError
+	if !errors.As(err, &terr) {
+		t.Fatalf("Parse() of a broken header got error %v, want a TranslateError", err)
+	}
+	if terr.Unit != "point.c" && terr.Unit != "point.c 386" {
+		t.Errorf("TranslateError.Unit got %q", terr.Unit)
+	}
+}
+
+func TestArchPasses(t *testing.T) {
+	// The SDK headers pick their definitions by architecture.
+	dir := fakeSDK(t, map[string]string{
+		"context.h": "#if defined(_AMD64_) && defined(_X86_)\n#error both architectures are defined\n#endif\n" +
+			"#ifdef _AMD64_\ntypedef struct _CONTEXT { void *p; long long rip; } CONTEXT;\n" +
+			"#else\ntypedef struct _CONTEXT { void *p; long eip; } CONTEXT;\n#endif\n",
+	})
+
+	// The architecture macros are predefined for each pass, the main
+	// translation unit must not define its own.
+	data, err := os.ReadFile(filepath.Join("..", "assets", "header.h"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	prelude := string(data)
+	if i := strings.Index(prelude, "#include"); i >= 0 {
+		prelude = prelude[:i]
+	}
+
+	db, err := winsdk.Parse(context.Background(), winsdk.Options{
+		Include:    dir,
+		Sources:    []winsdk.Source{{Name: "header.h", Code: []byte(prelude + "#include <context.h>\n")}},
+		ExtraArchs: []string{"386"},
+	})
+	if err != nil {
+		t.Fatalf("Parse() failed: %v", err)
+	}
+	x86 := db.ArchTypes["386"]["struct _CONTEXT"]
+	if got, want := x86.Size, int64(8); got != want {
+		t.Errorf("386 CONTEXT size got %d, want %d", got, want)
+	}
+	if len(x86.Members) != 2 || x86.Members[0].Size != 4 || x86.Members[1].Name != "eip" {
+		t.Errorf("386 CONTEXT members got %+v, want a 4 bytes pointer and eip", x86.Members)
+	}
+	if got, want := db.Types["struct _CONTEXT"].Size, int64(16); got != want {
+		t.Errorf("amd64 CONTEXT size got %d, want %d", got, want)
+	}
+}
+
+func TestPhntHeaders(t *testing.T) {
+	dir := fakeSDK(t, map[string]string{
+		"winrtl.h": "void RtlCaptureContext2(void *context);\n",
+	})
+	docs := filepath.Join(dir, "sdk-api")
+	doc := filepath.Join(docs, "sdk-api-src", "content", "winrtl", "nf-winrtl-rtlcapturecontext2.md")
+	if err := os.MkdirAll(filepath.Dir(doc), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(doc, []byte("---\nreq.dll: Kernel32.dll\n---\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	phnt := filepath.Join(dir, "phnt")
+	if err := os.MkdirAll(phnt, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(phnt, "ntrtl.h"), []byte("int RtlGetVersion2(void *info);\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// The SDK lies under the working directory, its headers are not phnt
+	// ones when no phnt directory is given.
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	dlls := func(phnt, source string) map[string]string {
+		db, err := winsdk.Parse(context.Background(), winsdk.Options{
+			Include: dir,
+			Docs:    docs,
+			Phnt:    phnt,
+			Sources: []winsdk.Source{{Name: "rtl.c", Code: []byte(source)}},
+		})
+		if err != nil {
+			t.Fatalf("Parse() failed: %v", err)
+		}
+		dlls := make(map[string]string)
+		for _, api := range db.APIs {
+			dlls[api.Name] = api.DLL
+		}
+		return dlls
+	}
+	if got := dlls("", "#include <winrtl.h>\n")["RtlCaptureContext2"]; got != "kernel32.dll" {
+		t.Errorf("RtlCaptureContext2 without phnt got DLL %q, want kernel32.dll", got)
+	}
+	got := dlls(phnt, "#include <winrtl.h>\n#include <ntrtl.h>\n")
+	if got["RtlCaptureContext2"] != "kernel32.dll" || got["RtlGetVersion2"] != "ntdll.dll" {
+		t.Errorf("DLLs with phnt got %v", got)
+	}
+}
+
+func TestBuildGraph(t *testing.T) {
+	apis := []entity.W32API{
+		{Name: "CreateProcessW", DLL: "kernel32.dll", RetType: "BOOL", Params: []entity.W32APIParam{
+			{Annotation: "_In_opt_", Type: "LPCWSTR", Name: "lpApplicationName"},
+			{Annotation: "_Out_", Type: "LPPROCESS_INFORMATION", Name: "lpProcessInformation"}}},
+		{Name: "CloseHandle", DLL: "kernel32.dll", RetType: "BOOL", Params: []entity.W32APIParam{
+			{Annotation: "_In_", Type: "HANDLE", Name: "hObject"}}},
+		{Name: "CloseHandle", DLL: "kernelbase.dll", RetType: "BOOL", Params: []entity.W32APIParam{
+			{Annotation: "_In_", Type: "HANDLE", Name: "hObject"}}},
+		{Name: "CloseHandle", DLL: "kernel32.dll", RetType: "BOOL"},
+	}
+	types := map[string]entity.W32Type{
+		"LPPROCESS_INFORMATION": {Name: "LPPROCESS_INFORMATION", Kind: entity.TypeKindTypedef,
+			Target: "struct _PROCESS_INFORMATION *"},
+		"struct _PROCESS_INFORMATION": {Name: "struct _PROCESS_INFORMATION", Kind: entity.TypeKindStruct,
+			Members: []entity.W32TypeMember{
+				{Name: "hProcess", Type: "HANDLE"},
+				{Name: "dwProcessId", Type: "DWORD"},
+				{Def: &entity.W32Type{Kind: entity.TypeKindUnion, Members: []entity.W32TypeMember{
+					{Name: "Thread", Type: "HANDLE"}}}},
+			}},
+	}
+
+	g := analysis.BuildGraph(apis, types, false)
+	var nodes []string
+	for _, n := range g.Nodes {
+		nodes = append(nodes, n.ID)
+	}
+	wantNodes := []string{
+		"api:kernel32.dll!CloseHandle", "api:kernel32.dll!CreateProcessW", "api:kernelbase.dll!CloseHandle",
+		"type:HANDLE", "type:LPCWSTR", "type:LPPROCESS_INFORMATION", "type:struct _PROCESS_INFORMATION",
+	}
+	if !reflect.DeepEqual(nodes, wantNodes) {
+		t.Errorf("BuildGraph() nodes got %v, want %v", nodes, wantNodes)
+	}
+	wantEdges := []analysis.GraphEdge{
+		{From: "type:LPCWSTR", To: "api:kernel32.dll!CreateProcessW", Dir: analysis.EdgeIn, Param: "lpApplicationName"},
+		{From: "api:kernel32.dll!CreateProcessW", To: "type:LPPROCESS_INFORMATION", Dir: analysis.EdgeOut, Param: "lpProcessInformation"},
+		{From: "type:HANDLE", To: "api:kernel32.dll!CloseHandle", Dir: analysis.EdgeIn, Param: "hObject"},
+		{From: "type:HANDLE", To: "api:kernelbase.dll!CloseHandle", Dir: analysis.EdgeIn, Param: "hObject"},
+		{From: "type:LPPROCESS_INFORMATION", To: "type:struct _PROCESS_INFORMATION", Dir: analysis.EdgeAlias},
+		{From: "type:struct _PROCESS_INFORMATION", To: "type:HANDLE", Dir: analysis.EdgeMember, Param: "hProcess"},
+		{From: "type:struct _PROCESS_INFORMATION", To: "type:HANDLE", Dir: analysis.EdgeMember, Param: "Thread"},
+	}
+	if !reflect.DeepEqual(g.Edges, wantEdges) {
+		t.Errorf("BuildGraph() edges got %+v, want %+v", g.Edges, wantEdges)
+	}
+}
+
+func TestWriteDOT(t *testing.T) {
+	g := &analysis.Graph{
+		Nodes: []analysis.GraphNode{
+			{ID: "api:ntdll.dll!RtlInitUnicodeString", Kind: analysis.NodeAPI, Name: "RtlInitUnicodeString"},
+			{ID: `type:A"B\C`, Kind: analysis.NodeType, Name: "A\"B\\C\u00a0\x01"},
+		},
+		Edges: []analysis.GraphEdge{
+			{From: `type:A"B\C`, To: "api:ntdll.dll!RtlInitUnicodeString", Dir: analysis.EdgeIn, Param: "Source\nString"},
+		},
+	}
+	var b strings.Builder
+	if err := g.WriteDOT(&b); err != nil {
+		t.Fatalf("WriteDOT() failed: %v", err)
+	}
+
+	// DOT has no \u or \x escapes, the characters are written as is: only
+	// the quotes, the backslashes and the line breaks are escaped.
+	want := "digraph winsdk {\n" +
+		"  rankdir=LR;\n" +
+		"  \"api:ntdll.dll!RtlInitUnicodeString\" [label=\"RtlInitUnicodeString\", shape=box];\n" +
+		"  \"type:A\\\"B\\\\C\" [label=\"A\\\"B\\\\C\u00a0\x01\", shape=ellipse];\n" +
+		"  \"type:A\\\"B\\\\C\" -> \"api:ntdll.dll!RtlInitUnicodeString\" [label=\"Source\\nString (in)\"];\n" +
+		"}\n"
+	if got := b.String(); got != want {
+		t.Errorf("WriteDOT() got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestExtractIOCTLs(t *testing.T) {
+	dir := fakeSDK(t, map[string]string{
+		"devioctl.h": "#define CTL_CODE(DeviceType, Function, Method, Access) \\\n" +
+			"    (((DeviceType) << 16) | ((Access) << 14) | ((Function) << 2) | (Method))\n" +
+			"#define FILE_DEVICE_DISK 0x00000007\n" +
+			"#define FILE_DEVICE_MASS_STORAGE 0x0000002d\n" +
+			"#define FILE_DEVICE_SECURE_OPEN 0x00000100\n" +
+			"#define METHOD_BUFFERED 0\n" +
+			"#define FILE_ANY_ACCESS 0\n" +
+			"#define IOCTL_DISK_BASE FILE_DEVICE_DISK\n" +
+			"#define IOCTL_DISK_GET_DRIVE_GEOMETRY CTL_CODE(IOCTL_DISK_BASE, 0x0000, METHOD_BUFFERED, FILE_ANY_ACCESS)\n" +
+			"#define _STORAGE_CTL_CODE(f) CTL_CODE(FILE_DEVICE_MASS_STORAGE, f, METHOD_BUFFERED, FILE_ANY_ACCESS)\n" +
+			"#define IOCTL_STORAGE_CHECK_VERIFY _STORAGE_CTL_CODE(0x0200)\n",
+	})
+	db, err := winsdk.Parse(context.Background(), winsdk.Options{
+		Include: dir,
+		Sources: []winsdk.Source{{Name: "ioctl.c", Code: []byte("#include <devioctl.h>\n")}},
+	})
+	if err != nil {
+		t.Fatalf("Parse() failed: %v", err)
+	}
+
+	codes := make(map[string]uint32)
+	for _, ioctl := range db.IOCTLs.Codes {
+		codes[ioctl.Name] = ioctl.Code
+	}
+	want := map[string]uint32{"IOCTL_DISK_GET_DRIVE_GEOMETRY": 0x00070000, "IOCTL_STORAGE_CHECK_VERIFY": 0x002D0800}
+	if !reflect.DeepEqual(codes, want) {
+		t.Errorf("IOCTLs got %v, want %v", codes, want)
+	}
+	wantTypes := map[uint32]string{7: "FILE_DEVICE_DISK", 0x2d: "FILE_DEVICE_MASS_STORAGE"}
+	if !reflect.DeepEqual(db.IOCTLs.DeviceTypes, wantTypes) {
+		t.Errorf("DeviceTypes got %v, want %v", db.IOCTLs.DeviceTypes, wantTypes)
+	}
+}
+
+func TestExtractInterfaces(t *testing.T) {
+	// The WMI interfaces are pulled in by the main translation unit.
+	data, err := os.ReadFile(filepath.Join("..", "assets", "header.h"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "#include <wbemcli.h>") {
+		t.Errorf("header.h does not include wbemcli.h")
+	}
+
+	dir := fakeSDK(t, map[string]string{
+		"wbemcli.h": "typedef long HRESULT;\ntypedef const char *BSTR;\n" +
+			"typedef struct IUnknown IUnknown;\ntypedef struct IWbemServices IWbemServices;\n" +
+			"#if defined(__cplusplus) && !defined(CINTERFACE)\n" +
+			"MIDL_INTERFACE(\"9556dc99-828c-11cf-a37e-00aa003240c7\")\nIWbemServices : public IUnknown\n{\n};\n" +
+			"#else\n" +
+			"typedef struct IUnknownVtbl {\n" +
+			"    HRESULT (*QueryInterface)(IUnknown *This, const void *riid, void **ppvObject);\n" +
+			"    unsigned long (*AddRef)(IUnknown *This);\n" +
+			"    unsigned long (*Release)(IUnknown *This);\n" +
+			"} IUnknownVtbl;\n" +
+			"struct IUnknown { IUnknownVtbl *lpVtbl; };\n" +
+			"typedef struct IWbemServicesVtbl {\n" +
+			"    HRESULT (*QueryInterface)(IWbemServices *This, const void *riid, void **ppvObject);\n" +
+			"    unsigned long (*AddRef)(IWbemServices *This);\n" +
+			"    unsigned long (*Release)(IWbemServices *This);\n" +
+			"    HRESULT (*OpenNamespace)(IWbemServices *This, const BSTR strNamespace, long lFlags);\n" +
+			"    HRESULT (*CancelAsyncCall)(IWbemServices *This, void *pSink);\n" +
+			"    HRESULT (*QueryObjectSink)(IWbemServices *This, long lFlags, void **ppResponseHandler);\n" +
+			"    HRESULT (*GetObject)(IWbemServices *This, const BSTR strObjectPath, long lFlags);\n" +
+			"} IWbemServicesVtbl;\n" +
+			"struct IWbemServices { IWbemServicesVtbl *lpVtbl; };\n" +
+			"#endif\n",
+	})
+	db, err := winsdk.Parse(context.Background(), winsdk.Options{
+		Include: dir,
+		Sources: []winsdk.Source{{Name: "wmi.c", Code: []byte("#include <wbemcli.h>\n")}},
+	})
+	if err != nil {
+		t.Fatalf("Parse() failed: %v", err)
+	}
+
+	iface, ok := db.Interfaces["IWbemServices"]
+	if !ok {
+		t.Fatalf("IWbemServices was not extracted from %v", db.Interfaces)
+	}
+	if iface.Base != "IUnknown" || iface.Header != "wbemcli.h" {
+		t.Errorf("IWbemServices got base %q and header %q", iface.Base, iface.Header)
+	}
+	var methods []string
+	for i, m := range iface.Methods {
+		if m.Index != i {
+			t.Errorf("IWbemServices.%s got index %d, want %d", m.Name, m.Index, i)
+		}
+		methods = append(methods, m.Name)
+	}
+	want := []string{"QueryInterface", "AddRef", "Release", "OpenNamespace", "CancelAsyncCall", "QueryObjectSink", "GetObject"}
+	if !reflect.DeepEqual(methods, want) {
+		t.Errorf("IWbemServices vtable got %v, want %v", methods, want)
+	}
+	if p := iface.Methods[3].Params; len(p) != 3 || p[0].Name != "This" || p[1].Name != "strNamespace" {
+		t.Errorf("IWbemServices.OpenNamespace params got %+v", p)
+	}
+}
+
+func TestExtractCallbacks(t *testing.T) {
+	dir := fakeSDK(t, map[string]string{
+		"winuser.h": "typedef long LRESULT;\ntypedef unsigned int UINT;\n" +
+			"#define CALLBACK __stdcall\n#define WINAPIV __cdecl\n#define STDAPICALLTYPE __stdcall\n" +
+			"typedef LRESULT (CALLBACK* WNDPROC)(void *hwnd, UINT msg);\n" +
+			"typedef LRESULT (CALLBACK\n    *HOOKPROC)(int code);\n" +
+			"typedef void (WINAPIV *VARPROC)(int n, ...);\n" +
+			"typedef void\nSTDAPICALLTYPE\nTIMERPROC_T(UINT id);\n" +
+			"typedef TIMERPROC_T *PTIMERPROC;\n" +
+			"typedef int (*PLAINPROC)(int);\n",
+	})
+	db, err := winsdk.Parse(context.Background(), winsdk.Options{
+		Include: dir,
+		Sources: []winsdk.Source{{Name: "user.c", Code: []byte("#include <winuser.h>\n")}},
+	})
+	if err != nil {
+		t.Fatalf("Parse() failed: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		conv    string
+		pointer bool
+		params  int
+	}{
+		{"WNDPROC", "__stdcall", true, 2},
+		{"HOOKPROC", "__stdcall", true, 1},
+		{"VARPROC", "__cdecl", true, 1},
+		{"TIMERPROC_T", "__stdcall", false, 1},
+		{"PTIMERPROC", "__stdcall", true, 1},
+		{"PLAINPROC", "", true, 1},
+	}
+	for _, tt := range tests {
+		got, ok := db.Callbacks[tt.name]
+		if !ok {
+			t.Errorf("Callbacks[%s] was not extracted", tt.name)
+			continue
+		}
+		if got.CallingConvention != tt.conv || got.Pointer != tt.pointer || len(got.Params) != tt.params {
+			t.Errorf("Callbacks[%s] got %q, pointer %v and %d params, want %q, %v and %d",
+				tt.name, got.CallingConvention, got.Pointer, len(got.Params), tt.conv, tt.pointer, tt.params)
+		}
+	}
+	if got := db.Callbacks["VARPROC"]; !got.Variadic {
+		t.Errorf("Callbacks[VARPROC] is not variadic")
+	}
+	if got := db.Callbacks["WNDPROC"]; got.RetType != "LRESULT" || got.Header != "winuser.h" {
+		t.Errorf("Callbacks[WNDPROC] got return type %q and header %q", got.RetType, got.Header)
+	}
+}
+
+func TestAPIDocs(t *testing.T) {
+	dir := fakeSDK(t, map[string]string{
+		"fileapi.h": "typedef int BOOL;\nBOOL FlushThing(void *h);\nBOOL LockThing(void *h);\n",
+	})
+	docs := filepath.Join(dir, "sdk-api")
+	content := filepath.Join(docs, "sdk-api-src", "content", "fileapi")
+	if err := os.MkdirAll(content, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for name, doc := range map[string]string{
+		"flushthing": "---\nreq.dll: Kernel32.dll\n---\n\n## -returns\n\n" +
+			"If the function fails, the return value is zero. To get extended error information, call **GetLastError**.\n",
+		// The remarks mention GetLastError, the return value does not set it.
+		"lockthing": "---\nreq.dll: KernelBase.dll\n---\n\n## -returns\n\n" +
+			"If the function fails, the return value is zero.\n\n" +
+			"## -remarks\n\nDo not call GetLastError after LockThing.\n",
+	} {
+		if err := os.WriteFile(filepath.Join(content, "nf-fileapi-"+name+".md"), []byte(doc), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	db, err := winsdk.Parse(context.Background(), winsdk.Options{
+		Include: dir,
+		Docs:    docs,
+		Sources: []winsdk.Source{{Name: "file.c", Code: []byte("#include <fileapi.h>\n")}},
+	})
+	if err != nil {
+		t.Fatalf("Parse() failed: %v", err)
+	}
+	apis := make(map[string]entity.W32API)
+	for _, api := range db.APIs {
+		apis[api.Name] = api
+	}
+	tests := []struct {
+		name      string
+		dll       string
+		lastError bool
+	}{
+		{"FlushThing", "kernel32.dll", true},
+		{"LockThing", "kernelbase.dll", false},
+	}
+	for _, tt := range tests {
+		api, ok := apis[tt.name]
+		if !ok || api.RetSemantics == nil {
+			t.Errorf("%s was not extracted with its return semantics", tt.name)
+			continue
+		}
+		if api.DLL != tt.dll || api.RetSemantics.SetsLastError != tt.lastError {
+			t.Errorf("%s got DLL %q and last error %v, want %q and %v",
+				tt.name, api.DLL, api.RetSemantics.SetsLastError, tt.dll, tt.lastError)
+		}
+	}
+}